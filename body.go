@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseSizeTag parses maxbody tag like "1MB", "512KB" or "100". It returns 0 if tag is empty, which means no limit.
+func parseSizeTag(tag string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(tag))
+	if s == "" {
+		return 0, nil
+	}
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(s[:len(s)-len(u.suffix)]), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 || n > (1<<62)/unit {
+		return 0, fmt.Errorf("invalid maxbody tag %q", tag)
+	}
+	return n * unit, nil
+}
+
+// getMaxBodyTag returns the maxbody of field tag, or service tag if field doesn't set.
+func getMaxBodyTag(serviceTag, fieldTag reflect.StructTag) (int64, error) {
+	tag := fieldTag.Get("maxbody")
+	if tag == "" {
+		tag = serviceTag.Get("maxbody")
+	}
+	return parseSizeTag(tag)
+}
+
+// maxBodyReader is http.MaxBytesReader recording the error when the limit is exceeded,
+// so it's detected even if an unmarshaller doesn't keep the error.
+type maxBodyReader struct {
+	io.ReadCloser
+	err *http.MaxBytesError
+}
+
+func (r *maxBodyReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if e := (*http.MaxBytesError)(nil); errors.As(err, &e) {
+		r.err = e
+	}
+	return n, err
+}
+
+// limitRequestBody limits the body of request r to maxBody bytes (0 means no limit), for decoding input
+// and handlers reading Request().Body directly. It returns error if Content-Length is larger than maxBody.
+func limitRequestBody(w http.ResponseWriter, r *http.Request, maxBody int64) error {
+	if maxBody <= 0 || r.Body == nil {
+		return nil
+	}
+	if r.ContentLength > maxBody {
+		return &http.MaxBytesError{Limit: maxBody}
+	}
+	r.Body = &maxBodyReader{ReadCloser: http.MaxBytesReader(w, r.Body, maxBody)}
+	return nil
+}
+
+// returnBodyError answers err of reading request body, 413 if the body is larger than maxbody tag,
+// otherwise 400.
+func returnBodyError(ctx Context, err error) {
+	tooLarge := (*http.MaxBytesError)(nil)
+	if r, ok := ctx.Request().Body.(*maxBodyReader); ok && r.err != nil {
+		tooLarge = r.err
+	}
+	if tooLarge != nil || errors.As(err, &tooLarge) {
+		returnError(ctx, http.StatusRequestEntityTooLarge, "request body is larger than %d bytes", tooLarge.Limit)
+		return
+	}
+	returnError(ctx, http.StatusBadRequest, "decode request body error: %s", err)
+}
+
+// decodeRequestBody decodes body of ctx's request to type t with marshaller.
+// An empty body is decoded as nil if t is a pointer, otherwise it's a bad request.
+// The body is limited by limitRequestBody before, and it answers 413 if body is larger than the limit.
+// It returns false if decoding failed, and the error was returned to ctx already.
+func decodeRequestBody(ctx Context, t reflect.Type, marshaller Marshaller) (reflect.Value, bool) {
+	r := ctx.Request()
+	var body io.Reader = r.Body
+	if body == nil {
+		body = strings.NewReader("")
+	}
+	buf := bufio.NewReader(body)
+	if _, err := buf.Peek(1); err == io.EOF {
+		if t.Kind() == reflect.Ptr {
+			return reflect.Zero(t), true
+		}
+		returnError(ctx, http.StatusBadRequest, "request body is empty")
+		return reflect.Value{}, false
+	}
+
+	unmarshaller, ok := getRequestMarshaller(marshaller, r)
+	if !ok {
+		returnError(ctx, http.StatusUnsupportedMediaType, "unsupported content type %s", r.Header.Get("Content-Type"))
+		return reflect.Value{}, false
+	}
+	_, params := parseHeaderField(r, "Content-Type")
+	charset := params["charset"]
+	if _, ok := normalizeCharset(charset); charset != "" && !ok {
+		returnError(ctx, http.StatusUnsupportedMediaType, "unsupported charset %s", charset)
+		return reflect.Value{}, false
+	}
+	if u, ok := unmarshaller.(ParamsUnmarshaller); ok {
+		unmarshaller = paramsUnmarshaller{u, params, r}
+	}
+	var ret reflect.Value
+	reader, err := newCharsetReader(buf, charset)
+	if err == nil {
+		ret, err = unmarshallFromReader(t, unmarshaller, reader)
+	}
+	if err == nil {
+		return ret, true
+	}
+	returnBodyError(ctx, err)
+	return reflect.Value{}, false
+}
@@ -0,0 +1,121 @@
+package rest
+
+import (
+	"github.com/googollee/go-assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSizeTag(t *testing.T) {
+	type Test struct {
+		tag  string
+		ok   bool
+		size int64
+	}
+	var tests = []Test{
+		{"", true, 0},
+		{"100", true, 100},
+		{"100B", true, 100},
+		{"1KB", true, 1024},
+		{"512kb", true, 512 * 1024},
+		{"1MB", true, 1 << 20},
+		{"2 M", true, 2 << 20},
+		{"1GB", true, 1 << 30},
+		{"0", false, 0},
+		{"-1KB", false, 0},
+		{"MB", false, 0},
+		{"1TB", false, 0},
+		{"abc", false, 0},
+	}
+	for i, test := range tests {
+		size, err := parseSizeTag(test.tag)
+		assert.MustEqual(t, err == nil, test.ok, "test %d", i)
+		assert.Equal(t, size, test.size, "test %d", i)
+	}
+}
+
+func TestMaxBodyTag(t *testing.T) {
+	f := new(nodeFuncs)
+	_, _, handler, err := SimpleNode{}.CreateHandler(`maxbody:"1KB"`, `method:"POST"`, "CtxInt", reflect.ValueOf(f.CtxInt))
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, handler.(*baseHandler).maxBody, int64(1024))
+
+	_, _, handler, err = SimpleNode{}.CreateHandler(`maxbody:"1KB"`, `method:"POST" maxbody:"1MB"`, "CtxInt", reflect.ValueOf(f.CtxInt))
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, handler.(*baseHandler).maxBody, int64(1<<20))
+
+	_, _, handler, err = Streaming{}.CreateHandler(``, `method:"POST" maxbody:"10"`, "Stream", reflect.ValueOf(func(ctx StreamContext, s string) {}))
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, handler.(*streamHandler).maxBody, int64(10))
+
+	_, _, _, err = SimpleNode{}.CreateHandler(``, `method:"POST" maxbody:"big"`, "CtxInt", reflect.ValueOf(f.CtxInt))
+	assert.NotEqual(t, err, nil)
+}
+
+// readBody reads the request body without input parameter, which is limited by maxbody too.
+func readBody(ctx Context) {
+	b, err := ioutil.ReadAll(ctx.Request().Body)
+	if err != nil {
+		returnBodyError(ctx, err)
+		return
+	}
+	ctx.Render(string(b))
+}
+
+func TestDecodeRequestBody(t *testing.T) {
+	type Test struct {
+		f          reflect.Value
+		marshaller Marshaller
+		body       string
+		chunked    bool
+		maxBody    int64
+		code       int
+		resp       string
+	}
+	var tests = []Test{
+		{reflect.ValueOf(func(ctx Context, s *string) *string { return s }), jsonMarshaller, "", false, 0, http.StatusOK, ""},
+		{reflect.ValueOf(func(ctx Context, s *string) *string { return s }), jsonMarshaller, `"abc"`, false, 0, http.StatusOK, "\"abc\"\n"},
+		{reflect.ValueOf(func(ctx Context, s string) string { return s }), jsonMarshaller, "", false, 0, http.StatusBadRequest, "request body is empty\n"},
+		{reflect.ValueOf(func(ctx Context, s *string) *string { return s }), jsonMarshaller, `"abc`, false, 0, http.StatusBadRequest, "decode request body error: unexpected EOF\n"},
+		{reflect.ValueOf(func(ctx Context, s *string) *string { return s }), jsonMarshaller, " ", false, 0, http.StatusBadRequest, "decode request body error: EOF\n"},
+		{reflect.ValueOf(func(ctx Context, s string) string { return s }), jsonMarshaller, `"abc"`, false, 5, http.StatusOK, "\"abc\"\n"},
+		{reflect.ValueOf(func(ctx Context, s string) string { return s }), jsonMarshaller, `"abcd"`, false, 5, http.StatusRequestEntityTooLarge, "request body is larger than 5 bytes\n"},
+		{reflect.ValueOf(func(ctx Context, s string) string { return s }), jsonMarshaller, `"abc"`, true, 5, http.StatusOK, "\"abc\"\n"},
+		{reflect.ValueOf(func(ctx Context, s string) string { return s }), jsonMarshaller, `"abcd"`, true, 5, http.StatusRequestEntityTooLarge, "request body is larger than 5 bytes\n"},
+		{reflect.ValueOf(func(ctx Context, v struct{ A int }) int { return v.A }), jsonMarshaller, `{"A":1,"B":2}`, false, 0, http.StatusOK, "1\n"},
+		{reflect.ValueOf(func(ctx Context, v struct{ A int }) int { return v.A }), StrictJSONMarshaller{}, `{"A":1,"B":2}`, false, 0, http.StatusBadRequest, "decode request body error: json: unknown field \"B\"\n"},
+		{reflect.ValueOf(func(ctx Context, v struct{ A int }) int { return v.A }), StrictJSONMarshaller{}, `{"A":1}{}`, false, 0, http.StatusBadRequest, "decode request body error: unexpected data after json value\n"},
+		{reflect.ValueOf(readBody), jsonMarshaller, `abcde`, true, 5, http.StatusOK, "\"abcde\"\n"},
+		{reflect.ValueOf(readBody), jsonMarshaller, `abcdef`, false, 5, http.StatusRequestEntityTooLarge, "request body is larger than 5 bytes\n"},
+		{reflect.ValueOf(readBody), jsonMarshaller, `abcdef`, true, 5, http.StatusRequestEntityTooLarge, "request body is larger than 5 bytes\n"},
+	}
+	for i, test := range tests {
+		var inputType reflect.Type
+		if test.f.Type().NumIn() > 1 {
+			inputType = test.f.Type().In(1)
+		}
+		handler := &baseHandler{
+			name:            "test",
+			mime:            "application/json",
+			marshaller:      test.marshaller,
+			inputType:       inputType,
+			f:               test.f,
+			compressMinSize: -1,
+			maxBody:         test.maxBody,
+		}
+		req, err := http.NewRequest("POST", "http://domain/", strings.NewReader(test.body))
+		assert.MustEqual(t, err, nil, "test %d", i)
+		if test.chunked {
+			req.ContentLength = -1
+			req.Body = ioutil.NopCloser(strings.NewReader(test.body))
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req, nil)
+		assert.Equal(t, resp.Code, test.code, "test %d", i)
+		assert.Equal(t, resp.Body.String(), test.resp, "test %d", i)
+	}
+}
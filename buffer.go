@@ -0,0 +1,74 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// maxPooledBufferSize is the maximum capacity of buffer put back to pool, to avoid holding large memory.
+const maxPooledBufferSize = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// bufferedResponseWriter buffers the whole response until finishing,
+// so handler can set headers after rendering and replace the response when failing.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	code int
+	buf  *bytes.Buffer
+}
+
+func newBufferedResponseWriter(w http.ResponseWriter) *bufferedResponseWriter {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return &bufferedResponseWriter{
+		ResponseWriter: w,
+		buf:            buf,
+	}
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	if w.code != 0 {
+		return
+	}
+	w.code = code
+}
+
+func (w *bufferedResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.buf.Write(p)
+}
+
+// setCode replaces the buffered code, keeping the buffered body.
+func (w *bufferedResponseWriter) setCode(code int) {
+	w.code = code
+}
+
+// reset drops buffered code and body.
+func (w *bufferedResponseWriter) reset() {
+	w.code = 0
+	w.buf.Reset()
+}
+
+// finish writes buffered response with Content-Length to inner writer.
+func (w *bufferedResponseWriter) finish() {
+	code := w.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+	if code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified {
+		w.Header().Set("Content-Length", strconv.Itoa(w.buf.Len()))
+	}
+	w.ResponseWriter.WriteHeader(code)
+	w.ResponseWriter.Write(w.buf.Bytes())
+	if w.buf.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(w.buf)
+	}
+	w.buf = nil
+}
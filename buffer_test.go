@@ -0,0 +1,102 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/googollee/go-assert"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestBufferedResponseWriter(t *testing.T) {
+	resp := httptest.NewRecorder()
+	w := newBufferedResponseWriter(resp)
+	w.Write([]byte("abc"))
+	w.Header().Set("X-After", "set")
+	assert.Equal(t, resp.Body.Len(), 0)
+	w.reset()
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("created"))
+	w.finish()
+	assert.Equal(t, resp.Code, http.StatusCreated)
+	assert.Equal(t, resp.Body.String(), "created")
+	assert.Equal(t, resp.Header().Get("Content-Length"), "7")
+	assert.Equal(t, resp.Header().Get("X-After"), "set")
+
+	resp = httptest.NewRecorder()
+	w = newBufferedResponseWriter(resp)
+	w.WriteHeader(http.StatusNoContent)
+	w.finish()
+	assert.Equal(t, resp.Code, http.StatusNoContent)
+	assert.Equal(t, resp.Header().Get("Content-Length"), "")
+}
+
+func TestBufferedHandler(t *testing.T) {
+	type Test struct {
+		f       reflect.Value
+		code    int
+		body    string
+		header  string
+		content string
+	}
+	var tests = []Test{
+		{reflect.ValueOf(func(ctx Context) {
+			ctx.Render("abc")
+			ctx.Response().Header().Set("X-After", "set")
+		}), http.StatusOK, "\"abc\"\n", "set", "6"},
+		{reflect.ValueOf(func(ctx Context) {
+			ctx.RenderStatus(http.StatusCreated, "abc")
+		}), http.StatusCreated, "\"abc\"\n", "", "6"},
+		{reflect.ValueOf(func(ctx Context) (int, string, error) {
+			return http.StatusAccepted, "abc", nil
+		}), http.StatusAccepted, "\"abc\"\n", "", "6"},
+		{reflect.ValueOf(func(ctx Context) {
+			ctx.Render("abc")
+			ctx.Return(http.StatusBadRequest, "bad")
+		}), http.StatusBadRequest, "bad\n", "", "4"},
+		{reflect.ValueOf(func(ctx Context) {
+			ctx.Render(map[string]int{"a": 1})
+			ctx.Return(http.StatusCreated)
+		}), http.StatusCreated, "{\"a\":1}\n", "", "8"},
+		{reflect.ValueOf(func(ctx Context) {
+			ctx.Render("abc")
+			ctx.Return(http.StatusNoContent)
+		}), http.StatusNoContent, "", "", ""},
+		{reflect.ValueOf(func(ctx Context) {
+			ctx.Render(func() {})
+		}), http.StatusInternalServerError, "marshal response error: json: unsupported type: func()\n", "", "55"},
+		{reflect.ValueOf(func(ctx Context) error {
+			return fmt.Errorf("failed")
+		}), http.StatusInternalServerError, "failed\n", "", "7"},
+	}
+	for i, test := range tests {
+		handler := &baseHandler{
+			name:            "test",
+			mime:            "application/json",
+			marshaller:      jsonMarshaller,
+			f:               test.f,
+			compressMinSize: -1,
+			buffered:        true,
+		}
+		req, err := http.NewRequest("GET", "http://domain/", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req, nil)
+		assert.Equal(t, resp.Code, test.code, "test %d", i)
+		assert.Equal(t, resp.Body.String(), test.body, "test %d", i)
+		assert.Equal(t, resp.Header().Get("X-After"), test.header, "test %d", i)
+		assert.Equal(t, resp.Header().Get("Content-Length"), test.content, "test %d", i)
+	}
+}
+
+func TestBufferTag(t *testing.T) {
+	f := new(nodeFuncs)
+	_, _, handler, err := SimpleNode{}.CreateHandler(``, `method:"GET" buffer:"true"`, "Ctx", reflect.ValueOf(f.Ctx))
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, handler.(*baseHandler).buffered, true)
+
+	_, _, handler, err = SimpleNode{}.CreateHandler(``, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx))
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, handler.(*baseHandler).buffered, false)
+}
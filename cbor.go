@@ -0,0 +1,700 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// CBORMarshaller is Marshaller using CBOR (RFC 8949).
+// Struct is encoded as map, with field names in json tag. []byte is encoded as byte string.
+// time.Time is encoded as epoch-based timestamp (tag 1) if it has no fractional seconds,
+// otherwise as RFC 3339 string (tag 0) to keep nanoseconds.
+// Map keys are sorted by their encoded bytes, so output is deterministic.
+// Each Render writes one data item, so items can be decoded one by one from a Streaming response.
+type CBORMarshaller struct{}
+
+// Binary implements BinaryMarshaller.
+func (m CBORMarshaller) Binary() bool {
+	return true
+}
+
+// Marshal will marshal v and write to w.
+func (m CBORMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	var buf bytes.Buffer
+	if err := encodeCBOR(&buf, reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Unmarshal will read one data item from r and unmarshal to v.
+func (m CBORMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cbor: unmarshal to non-pointer %T", v)
+	}
+	d := &cborDecoder{r: r}
+	return d.decode(rv.Elem())
+}
+
+const (
+	cborUint = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+const (
+	cborFalse     = 0xf4
+	cborTrue      = 0xf5
+	cborNull      = 0xf6
+	cborUndefined = 0xf7
+)
+
+// cborWriteHead writes the initial byte of major type and the argument n.
+func cborWriteHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		msgpackWriteUint(buf, major|24, 1, n)
+	case n <= math.MaxUint16:
+		msgpackWriteUint(buf, major|25, 2, n)
+	case n <= math.MaxUint32:
+		msgpackWriteUint(buf, major|26, 4, n)
+	default:
+		msgpackWriteUint(buf, major|27, 8, n)
+	}
+}
+
+func encodeCBOR(buf *bytes.Buffer, v reflect.Value) error {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || ((v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()) {
+		buf.WriteByte(cborNull)
+		return nil
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.Nanosecond() == 0 {
+			cborWriteHead(buf, cborTag, 1)
+			encodeCBORInt(buf, t.Unix())
+			return nil
+		}
+		cborWriteHead(buf, cborTag, 0)
+		s := t.Format(time.RFC3339Nano)
+		cborWriteHead(buf, cborText, uint64(len(s)))
+		buf.WriteString(s)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(cborTrue)
+		} else {
+			buf.WriteByte(cborFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		encodeCBORInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		cborWriteHead(buf, cborUint, v.Uint())
+	case reflect.Float32:
+		msgpackWriteUint(buf, 0xfa, 4, uint64(math.Float32bits(float32(v.Float()))))
+	case reflect.Float64:
+		msgpackWriteUint(buf, 0xfb, 8, math.Float64bits(v.Float()))
+	case reflect.String:
+		cborWriteHead(buf, cborText, uint64(v.Len()))
+		buf.WriteString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			cborWriteHead(buf, cborBytes, uint64(len(b)))
+			buf.Write(b)
+			return nil
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			buf.WriteByte(cborNull)
+			return nil
+		}
+		cborWriteHead(buf, cborArray, uint64(v.Len()))
+		for i, n := 0, v.Len(); i < n; i++ {
+			if err := encodeCBOR(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteByte(cborNull)
+			return nil
+		}
+		cborWriteHead(buf, cborMap, uint64(v.Len()))
+		// sort entries by encoded keys, as core deterministic encoding in RFC 8949.
+		type entry struct {
+			key   []byte
+			value reflect.Value
+		}
+		entries := make([]entry, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			var kb bytes.Buffer
+			if err := encodeCBOR(&kb, key); err != nil {
+				return err
+			}
+			entries = append(entries, entry{kb.Bytes(), v.MapIndex(key)})
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].key, entries[j].key) < 0 })
+		for _, e := range entries {
+			buf.Write(e.key)
+			if err := encodeCBOR(buf, e.value); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		var fields []structField
+		var values []reflect.Value
+		for _, f := range jsonFields(v.Type()) {
+			fv, ok := structFieldValue(v, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			fields = append(fields, f)
+			values = append(values, fv)
+		}
+		cborWriteHead(buf, cborMap, uint64(len(fields)))
+		for i, f := range fields {
+			cborWriteHead(buf, cborText, uint64(len(f.name)))
+			buf.WriteString(f.name)
+			if err := encodeCBOR(buf, values[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cbor: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func encodeCBORInt(buf *bytes.Buffer, i int64) {
+	if i >= 0 {
+		cborWriteHead(buf, cborUint, uint64(i))
+		return
+	}
+	cborWriteHead(buf, cborNegInt, uint64(-1-i))
+}
+
+type cborDecoder struct {
+	r     io.Reader
+	buf   [8]byte
+	depth int
+}
+
+// cborHead is the head of a data item.
+type cborHead struct {
+	major      byte
+	info       byte
+	n          uint64 // argument: value of integer, length of string, array and map, number of tag, bits of float
+	indefinite bool
+}
+
+func (d *cborDecoder) readN(n int) ([]byte, error) {
+	if _, err := io.ReadFull(d.r, d.buf[:n]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return d.buf[:n], nil
+}
+
+func (d *cborDecoder) readHead() (cborHead, error) {
+	b, err := d.readN(1)
+	if err != nil {
+		return cborHead{}, err
+	}
+	h := cborHead{major: b[0] >> 5, info: b[0] & 0x1f}
+	switch {
+	case h.info < 24:
+		h.n = uint64(h.info)
+	case h.info <= 27:
+		b, err := d.readN(1 << (h.info - 24))
+		if err != nil {
+			return h, err
+		}
+		for _, c := range b {
+			h.n = h.n<<8 | uint64(c)
+		}
+	case h.info == 31:
+		switch h.major {
+		case cborBytes, cborText, cborArray, cborMap:
+			h.indefinite = true
+		case cborSimple:
+		default:
+			return h, fmt.Errorf("cbor: invalid indefinite length of major type %d", h.major)
+		}
+	default:
+		return h, fmt.Errorf("cbor: invalid additional information %d", h.info)
+	}
+	return h, nil
+}
+
+func (h cborHead) isBreak() bool {
+	return h.major == cborSimple && h.info == 31
+}
+
+func (h cborHead) isNull() bool {
+	return h.major == cborSimple && (h.info == cborNull&0x1f || h.info == cborUndefined&0x1f)
+}
+
+// float returns the float value of head with major type 7, or false if it isn't a float.
+func (h cborHead) float() (float64, bool) {
+	if h.major != cborSimple {
+		return 0, false
+	}
+	switch h.info {
+	case 25:
+		return cborHalfFloat(uint16(h.n)), true
+	case 26:
+		return float64(math.Float32frombits(uint32(h.n))), true
+	case 27:
+		return math.Float64frombits(h.n), true
+	}
+	return 0, false
+}
+
+func cborHalfFloat(h uint16) float64 {
+	exp, mant := int(h>>10)&0x1f, float64(h&0x3ff)
+	var ret float64
+	switch exp {
+	case 0:
+		ret = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			ret = math.Inf(1)
+		} else {
+			ret = math.NaN()
+		}
+	default:
+		ret = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -ret
+	}
+	return ret
+}
+
+// readString reads content of byte or text string, joining chunks of indefinite length string.
+func (d *cborDecoder) readString(h cborHead) ([]byte, error) {
+	if !h.indefinite {
+		var buf bytes.Buffer
+		got, err := io.CopyN(&buf, d.r, int64(minUint64(h.n, math.MaxInt64)))
+		if err != nil && uint64(got) < h.n {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return buf.Bytes(), nil
+	}
+	var ret []byte
+	for {
+		chunk, err := d.readHead()
+		if err != nil {
+			return nil, err
+		}
+		if chunk.isBreak() {
+			return ret, nil
+		}
+		if chunk.major != h.major || chunk.indefinite {
+			return nil, fmt.Errorf("cbor: invalid chunk of indefinite length string")
+		}
+		b, err := d.readString(chunk)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, b...)
+	}
+}
+
+// next reports whether there is the i-th item in array or map with head h.
+// For indefinite length, it reads the head of next item, and returns it if it isn't break.
+func (d *cborDecoder) next(h cborHead, i uint64) (bool, *cborHead, error) {
+	if !h.indefinite {
+		return i < h.n, nil, nil
+	}
+	item, err := d.readHead()
+	if err != nil {
+		return false, nil, err
+	}
+	if item.isBreak() {
+		return false, nil, nil
+	}
+	return true, &item, nil
+}
+
+// decodeItem decodes next item to v, using the head if it's already read.
+func (d *cborDecoder) decodeItem(head *cborHead, v reflect.Value) error {
+	if head != nil {
+		return d.decodeValue(*head, v)
+	}
+	return d.decode(v)
+}
+
+func (d *cborDecoder) decode(v reflect.Value) error {
+	h, err := d.readHead()
+	if err != nil {
+		return err
+	}
+	return d.decodeValue(h, v)
+}
+
+// decodeValue decodes item with head h to v. Every nested item, including those of decodeInterface,
+// skip and tags, is decoded through it, so it limits the nesting depth.
+func (d *cborDecoder) decodeValue(h cborHead, v reflect.Value) error {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxDecodeDepth {
+		return fmt.Errorf("cbor: exceeded max depth %d", maxDecodeDepth)
+	}
+	if h.isBreak() {
+		return fmt.Errorf("cbor: unexpected break")
+	}
+	if h.isNull() {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decodeValue(h, v.Elem())
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		ret, err := d.decodeInterface(h)
+		if err != nil {
+			return err
+		}
+		if ret == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(ret))
+		}
+		return nil
+	}
+	mismatch := func() error {
+		return fmt.Errorf("cbor: can't decode major type %d into %s", h.major, v.Type())
+	}
+	switch h.major {
+	case cborUint, cborNegInt:
+		return setCBORInt(h, v)
+	case cborBytes, cborText:
+		b, err := d.readString(h)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(b))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(b)
+		default:
+			return mismatch()
+		}
+	case cborArray:
+		switch v.Kind() {
+		case reflect.Slice:
+			ret := reflect.MakeSlice(v.Type(), 0, int(minUint64(h.n, 1024)))
+			for i := uint64(0); ; i++ {
+				ok, head, err := d.next(h, i)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					break
+				}
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := d.decodeItem(head, elem); err != nil {
+					return err
+				}
+				ret = reflect.Append(ret, elem)
+			}
+			v.Set(ret)
+		case reflect.Array:
+			i := 0
+			for ; ; i++ {
+				ok, head, err := d.next(h, uint64(i))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					break
+				}
+				if i >= v.Len() {
+					return fmt.Errorf("cbor: can't decode array of more than %d items into %s", v.Len(), v.Type())
+				}
+				if err := d.decodeItem(head, v.Index(i)); err != nil {
+					return err
+				}
+			}
+			if i != v.Len() {
+				return fmt.Errorf("cbor: can't decode array of %d items into %s", i, v.Type())
+			}
+		default:
+			return mismatch()
+		}
+	case cborMap:
+		switch v.Kind() {
+		case reflect.Map:
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			for i := uint64(0); ; i++ {
+				ok, head, err := d.next(h, i)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					break
+				}
+				key := reflect.New(v.Type().Key()).Elem()
+				if err := d.decodeItem(head, key); err != nil {
+					return err
+				}
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := d.decode(elem); err != nil {
+					return err
+				}
+				v.SetMapIndex(key, elem)
+			}
+		case reflect.Struct:
+			for i := uint64(0); ; i++ {
+				ok, head, err := d.next(h, i)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					break
+				}
+				var name string
+				if err := d.decodeItem(head, reflect.ValueOf(&name).Elem()); err != nil {
+					return err
+				}
+				field := findJSONField(v.Type(), name)
+				if field == nil {
+					if err := d.skip(); err != nil {
+						return err
+					}
+					continue
+				}
+				fv, err := structFieldAlloc(v, field.index)
+				if err != nil {
+					return fmt.Errorf("cbor: %s", err)
+				}
+				if err := d.decode(fv); err != nil {
+					return err
+				}
+			}
+		default:
+			return mismatch()
+		}
+	case cborTag:
+		if v.Type() != timeType {
+			// ignore unknown tags, decode the content.
+			return d.decode(v)
+		}
+		t, err := d.decodeTime(h.n)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+	case cborSimple:
+		if f, ok := h.float(); ok {
+			switch v.Kind() {
+			case reflect.Float32, reflect.Float64:
+				v.SetFloat(f)
+				return nil
+			}
+			return mismatch()
+		}
+		if h.info != cborFalse&0x1f && h.info != cborTrue&0x1f {
+			return fmt.Errorf("cbor: unsupported simple value %d", h.info)
+		}
+		if v.Kind() != reflect.Bool {
+			return mismatch()
+		}
+		v.SetBool(h.info == cborTrue&0x1f)
+	}
+	return nil
+}
+
+func setCBORInt(h cborHead, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if h.n > math.MaxInt64 {
+			return fmt.Errorf("cbor: integer overflows %s", v.Type())
+		}
+		i := int64(h.n)
+		if h.major == cborNegInt {
+			i = -1 - i
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("cbor: %d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if h.major == cborNegInt || v.OverflowUint(h.n) {
+			return fmt.Errorf("cbor: integer overflows %s", v.Type())
+		}
+		v.SetUint(h.n)
+	case reflect.Float32, reflect.Float64:
+		f := float64(h.n)
+		if h.major == cborNegInt {
+			f = -1 - f
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("cbor: can't decode integer into %s", v.Type())
+	}
+	return nil
+}
+
+// decodeTime decodes content of timestamp with tag number tag.
+// Tag 0 is RFC 3339 string, tag 1 is integer or float seconds since epoch.
+func (d *cborDecoder) decodeTime(tag uint64) (time.Time, error) {
+	h, err := d.readHead()
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch tag {
+	case 0:
+		if h.major != cborText {
+			return time.Time{}, fmt.Errorf("cbor: invalid content of tag 0")
+		}
+		b, err := d.readString(h)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Parse(time.RFC3339Nano, string(b))
+	case 1:
+		if f, ok := h.float(); ok {
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+		}
+		if h.major != cborUint && h.major != cborNegInt {
+			return time.Time{}, fmt.Errorf("cbor: invalid content of tag 1")
+		}
+		var sec int64
+		if err := setCBORInt(h, reflect.ValueOf(&sec).Elem()); err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("cbor: can't decode tag %d into time.Time", tag)
+}
+
+// decodeInterface decodes item with head h to interface{}.
+// Maps with string keys are decoded to map[string]interface{}, other maps to map[interface{}]interface{}.
+// Timestamps are decoded to time.Time, contents of other tags are returned without the tag.
+func (d *cborDecoder) decodeInterface(h cborHead) (interface{}, error) {
+	switch h.major {
+	case cborUint:
+		if h.n <= math.MaxInt64 {
+			return int64(h.n), nil
+		}
+		return h.n, nil
+	case cborNegInt:
+		if h.n > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor: integer overflows int64")
+		}
+		return -1 - int64(h.n), nil
+	case cborBytes:
+		return d.readString(h)
+	case cborText:
+		b, err := d.readString(h)
+		return string(b), err
+	case cborArray:
+		ret := make([]interface{}, 0, int(minUint64(h.n, 1024)))
+		for i := uint64(0); ; i++ {
+			ok, head, err := d.next(h, i)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			var elem interface{}
+			if err := d.decodeItem(head, reflect.ValueOf(&elem).Elem()); err != nil {
+				return nil, err
+			}
+			ret = append(ret, elem)
+		}
+		return ret, nil
+	case cborMap:
+		ret := make(map[interface{}]interface{})
+		stringKeys := true
+		for i := uint64(0); ; i++ {
+			ok, head, err := d.next(h, i)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			var key, elem interface{}
+			if err := d.decodeItem(head, reflect.ValueOf(&key).Elem()); err != nil {
+				return nil, err
+			}
+			if err := d.decode(reflect.ValueOf(&elem).Elem()); err != nil {
+				return nil, err
+			}
+			if _, ok := key.(string); !ok {
+				stringKeys = false
+			}
+			if key != nil && !reflect.TypeOf(key).Comparable() {
+				return nil, fmt.Errorf("cbor: invalid map key type %T", key)
+			}
+			ret[key] = elem
+		}
+		if !stringKeys {
+			return ret, nil
+		}
+		m := make(map[string]interface{}, len(ret))
+		for k, v := range ret {
+			m[k.(string)] = v
+		}
+		return m, nil
+	case cborTag:
+		if h.n == 0 || h.n == 1 {
+			return d.decodeTime(h.n)
+		}
+		var ret interface{}
+		err := d.decode(reflect.ValueOf(&ret).Elem())
+		return ret, err
+	case cborSimple:
+		if f, ok := h.float(); ok {
+			return f, nil
+		}
+		switch h.info {
+		case cborFalse & 0x1f:
+			return false, nil
+		case cborTrue & 0x1f:
+			return true, nil
+		}
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", h.info)
+	}
+	return nil, fmt.Errorf("cbor: invalid item")
+}
+
+// skip reads and drops next item.
+func (d *cborDecoder) skip() error {
+	var v interface{}
+	return d.decode(reflect.ValueOf(&v).Elem())
+}
@@ -0,0 +1,198 @@
+package rest
+
+import (
+	"bytes"
+	"github.com/googollee/go-assert"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type cborUser struct {
+	ID    int       `json:"id"`
+	Name  string    `json:"name"`
+	Email string    `json:"email,omitempty"`
+	Skip  string    `json:"-"`
+	Data  []byte    `json:"data"`
+	Time  time.Time `json:"time"`
+}
+
+func TestCBORMarshal(t *testing.T) {
+	type Test struct {
+		v    interface{}
+		data []byte
+	}
+	var tests = []Test{
+		{nil, []byte{0xf6}},
+		{false, []byte{0xf4}},
+		{true, []byte{0xf5}},
+		{0, []byte{0x00}},
+		{23, []byte{0x17}},
+		{24, []byte{0x18, 0x18}},
+		{1000, []byte{0x19, 0x03, 0xe8}},
+		{1000000, []byte{0x1a, 0x00, 0x0f, 0x42, 0x40}},
+		{uint64(math.MaxUint64), []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{-1, []byte{0x20}},
+		{-1000, []byte{0x39, 0x03, 0xe7}},
+		{int64(math.MinInt64), []byte{0x3b, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{float32(100000.0), []byte{0xfa, 0x47, 0xc3, 0x50, 0x00}},
+		{1.1, []byte{0xfb, 0x3f, 0xf1, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9a}},
+		{"IETF", []byte{0x64, 0x49, 0x45, 0x54, 0x46}},
+		{"ü", []byte{0x62, 0xc3, 0xbc}},
+		{[]byte{1, 2, 3, 4}, []byte{0x44, 0x01, 0x02, 0x03, 0x04}},
+		{[]int{1, 2, 3}, []byte{0x83, 0x01, 0x02, 0x03}},
+		{[]int(nil), []byte{0xf6}},
+		{map[string]int{"b": 2, "a": 1}, []byte{0xa2, 0x61, 'a', 0x01, 0x61, 'b', 0x02}},
+		{time.Unix(1363896240, 0), []byte{0xc1, 0x1a, 0x51, 0x4b, 0x67, 0xb0}},
+		{time.Unix(0, 5e8).UTC(), append([]byte{0xc0, 0x76}, "1970-01-01T00:00:00.5Z"...)},
+		{&cborUser{ID: 1, Name: "a", Skip: "x", Data: []byte{1}, Time: time.Unix(1, 0)}, []byte{0xa4,
+			0x62, 'i', 'd', 0x01,
+			0x64, 'n', 'a', 'm', 'e', 0x61, 'a',
+			0x64, 'd', 'a', 't', 'a', 0x41, 0x01,
+			0x64, 't', 'i', 'm', 'e', 0xc1, 0x01}},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		err := CBORMarshaller{}.Marshal(&buf, "test", test.v)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, buf.Bytes(), test.data, "test %d", i)
+	}
+
+	var buf bytes.Buffer
+	err := CBORMarshaller{}.Marshal(&buf, "test", make(chan int))
+	assert.NotEqual(t, err, nil)
+}
+
+func TestCBORUnmarshal(t *testing.T) {
+	type Test struct {
+		data   []byte
+		t      reflect.Type
+		ok     bool
+		target interface{}
+	}
+	var tests = []Test{
+		{[]byte{0x19, 0x03, 0xe8}, reflect.TypeOf(0), true, 1000},
+		{[]byte{0x39, 0x03, 0xe7}, reflect.TypeOf(int16(0)), true, int16(-1000)},
+		{[]byte{0x19, 0x03, 0xe8}, reflect.TypeOf(int8(0)), false, nil},
+		{[]byte{0x20}, reflect.TypeOf(uint(0)), false, nil},
+		{[]byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, reflect.TypeOf(int64(0)), false, nil},
+		{[]byte{0xf9, 0x3e, 0x00}, reflect.TypeOf(0.0), true, 1.5},
+		{[]byte{0xf9, 0xc4, 0x00}, reflect.TypeOf(0.0), true, -4.0},
+		{[]byte{0xf9, 0x7c, 0x00}, reflect.TypeOf(0.0), true, math.Inf(1)},
+		{[]byte{0xfa, 0x47, 0xc3, 0x50, 0x00}, reflect.TypeOf(float32(0)), true, float32(100000.0)},
+		{[]byte{0x20}, reflect.TypeOf(0.0), true, -1.0},
+		{[]byte{0xfb, 0x3f, 0xf1, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9a}, reflect.TypeOf(0), false, nil},
+		{[]byte{0x64, 0x49, 0x45, 0x54, 0x46}, reflect.TypeOf(""), true, "IETF"},
+		{[]byte{0x7f, 0x65, 's', 't', 'r', 'e', 'a', 0x64, 'm', 'i', 'n', 'g', 0xff}, reflect.TypeOf(""), true, "streaming"},
+		{[]byte{0x5f, 0x42, 0x01, 0x02, 0x43, 0x03, 0x04, 0x05, 0xff}, reflect.TypeOf([]byte{}), true, []byte{1, 2, 3, 4, 5}},
+		{[]byte{0x5f, 0x61, 'a', 0xff}, reflect.TypeOf([]byte{}), false, nil},
+		{[]byte{0x83, 0x01, 0x02, 0x03}, reflect.TypeOf([]int{}), true, []int{1, 2, 3}},
+		{[]byte{0x9f, 0x01, 0x02, 0xff}, reflect.TypeOf([]int{}), true, []int{1, 2}},
+		{[]byte{0x9f, 0x01, 0x02, 0xff}, reflect.TypeOf([2]int{}), true, [2]int{1, 2}},
+		{[]byte{0x83, 0x01, 0x02, 0x03}, reflect.TypeOf([2]int{}), false, nil},
+		{[]byte{0xbf, 0x61, 'a', 0x01, 0x61, 'b', 0x02, 0xff}, reflect.TypeOf(map[string]int{}), true, map[string]int{"a": 1, "b": 2}},
+		{[]byte{0xf6}, reflect.TypeOf(&cborUser{}), true, (*cborUser)(nil)},
+		{[]byte{0xa4, 0x62, 'I', 'D', 0x01, 0x61, 'x', 0x82, 0x01, 0x02, 0x64, 'd', 'a', 't', 'a', 0x41, 0x01, 0x64, 't', 'i', 'm', 'e', 0xc1, 0x01}, reflect.TypeOf(cborUser{}), true, cborUser{ID: 1, Data: []byte{1}, Time: time.Unix(1, 0).UTC()}},
+		{[]byte{0x82, 0x01, 0xa1, 0x61, 'a', 0xf5}, reflect.TypeOf([]interface{}{}), true, []interface{}{int64(1), map[string]interface{}{"a": true}}},
+		{[]byte{0xa1, 0x01, 0x61, 'a'}, reflect.TypeOf(map[interface{}]interface{}{}), true, map[interface{}]interface{}{int64(1): "a"}},
+		{[]byte{0xd8, 0x20, 0x61, 'a'}, reflect.TypeOf(""), true, "a"},
+		{[]byte{0xd8, 0x20, 0x61, 'a'}, reflect.TypeOf(new(interface{})).Elem(), true, "a"},
+		{append([]byte{0xc0, 0x74}, "2013-03-21T20:04:00Z"...), reflect.TypeOf(time.Time{}), true, time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)},
+		{[]byte{0xc1, 0x1a, 0x51, 0x4b, 0x67, 0xb0}, reflect.TypeOf(time.Time{}), true, time.Unix(1363896240, 0).UTC()},
+		{[]byte{0xc1, 0xfb, 0x41, 0xd4, 0x52, 0xd9, 0xec, 0x20, 0x00, 0x00}, reflect.TypeOf(time.Time{}), true, time.Unix(1363896240, 5e8).UTC()},
+		{[]byte{0xc1, 0x61, 'a'}, reflect.TypeOf(time.Time{}), false, nil},
+		{[]byte{0xc2, 0x41, 0x01}, reflect.TypeOf(time.Time{}), false, nil},
+		{[]byte{0x64, 'a'}, reflect.TypeOf(""), false, nil},
+		{[]byte{0x7b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, reflect.TypeOf(""), false, nil},
+		{[]byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, reflect.TypeOf([]int{}), false, nil},
+		{[]byte{0x1c}, reflect.TypeOf(0), false, nil},
+		{[]byte{0x1f}, reflect.TypeOf(0), false, nil},
+		{[]byte{0xff}, reflect.TypeOf(0), false, nil},
+		{[]byte{}, reflect.TypeOf(0), false, nil},
+	}
+	for i, test := range tests {
+		v := reflect.New(test.t)
+		err := CBORMarshaller{}.Unmarshal(bytes.NewReader(test.data), v.Interface())
+		assert.MustEqual(t, err == nil, test.ok, "test %d", i)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, v.Elem().Interface(), test.target, "test %d", i)
+	}
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	user := cborUser{ID: 10, Name: "rest", Email: "a@b", Data: []byte("data"), Time: time.Unix(1234567890, 123).UTC()}
+	var buf bytes.Buffer
+	m := CBORMarshaller{}
+	err := m.Marshal(&buf, "test", user)
+	assert.MustEqual(t, err, nil)
+	err = m.Marshal(&buf, "test", 2)
+	assert.MustEqual(t, err, nil)
+
+	var got cborUser
+	err = m.Unmarshal(&buf, &got)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, got, user)
+	var i int
+	err = m.Unmarshal(&buf, &i)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, i, 2)
+
+	embed := jsonNamingPtrEmbed{&jsonNamingBase{1, "a"}, 2}
+	err = m.Marshal(&buf, "test", embed)
+	assert.MustEqual(t, err, nil)
+	gotEmbed := jsonNamingPtrEmbed{jsonNamingBase: new(jsonNamingBase)}
+	err = m.Unmarshal(&buf, &gotEmbed)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, gotEmbed, embed)
+}
+
+func TestCBORUnmarshalDepth(t *testing.T) {
+	type Test struct {
+		data []byte
+		ok   bool
+	}
+	var tests = []Test{
+		{append(bytes.Repeat([]byte{0x81}, 100), 0xf6), true},
+		{append(bytes.Repeat([]byte{0x81}, 1<<20), 0xf6), false},
+		{append(bytes.Repeat([]byte{0x9f}, 1<<20), 0xf6), false},
+		{append(bytes.Repeat([]byte{0xa1, 0x61, 'a'}, 1<<20), 0xf6), false},
+		{append(bytes.Repeat([]byte{0xc6}, 1<<20), 0xf6), false},
+	}
+	for i, test := range tests {
+		var v interface{}
+		err := CBORMarshaller{}.Unmarshal(bytes.NewReader(test.data), &v)
+		assert.Equal(t, err == nil, test.ok, "test %d: %s", i, err)
+		var user cborUser
+		data := append([]byte{0xa1, 0x61, 'x'}, test.data...)
+		err = CBORMarshaller{}.Unmarshal(bytes.NewReader(data), &user)
+		assert.Equal(t, err == nil, test.ok, "test %d: %s", i, err)
+	}
+}
+
+func TestCBORHandler(t *testing.T) {
+	f := reflect.ValueOf(func(ctx Context, arg []int) map[string]int {
+		return map[string]int{"sum": arg[0] + arg[1]}
+	})
+	handler := &baseHandler{
+		name:            "Sum",
+		mime:            "application/json",
+		marshaller:      jsonMarshaller,
+		inputType:       f.Type().In(1),
+		f:               f,
+		compressMinSize: -1,
+	}
+	req, err := http.NewRequest("POST", "http://domain/", bytes.NewReader([]byte{0x82, 0x01, 0x02}))
+	assert.MustEqual(t, err, nil)
+	req.Header.Set("Content-Type", "application/cbor")
+	req.Header.Set("Accept", "application/cbor")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req, nil)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Header().Get("Content-Type"), "application/cbor")
+	assert.Equal(t, resp.Body.Bytes(), []byte{0xa1, 0x63, 's', 'u', 'm', 0x03})
+}
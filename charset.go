@@ -0,0 +1,179 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// charsets is supported charsets, the first one is default.
+var charsets = []string{"utf-8", "utf-16", "utf-16be", "utf-16le", "iso-8859-1"}
+
+var charsetAliases = map[string]string{
+	"utf8":       "utf-8",
+	"utf16":      "utf-16",
+	"latin1":     "iso-8859-1",
+	"iso8859-1":  "iso-8859-1",
+	"iso_8859-1": "iso-8859-1",
+	"us-ascii":   "iso-8859-1",
+}
+
+// normalizeCharset returns the canonical name of charset, or false if it isn't supported.
+func normalizeCharset(charset string) (string, bool) {
+	charset = strings.ToLower(strings.Trim(charset, ` "`))
+	if alias, ok := charsetAliases[charset]; ok {
+		charset = alias
+	}
+	for _, c := range charsets {
+		if c == charset {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// getResponseCharset chooses response charset according to request's Accept-Charset.
+// It returns the default utf-8 if no supported charset is acceptable.
+// iso-8859-1 can't encode all characters, so it's chosen only if utf-8 isn't acceptable.
+func getResponseCharset(r *http.Request) string {
+	accept := strings.Join(r.Header["Accept-Charset"], ",")
+	if strings.TrimSpace(accept) == "" {
+		return charsets[0]
+	}
+	ranges := parseAccept(accept)
+	for i := range ranges {
+		if c, ok := normalizeCharset(ranges[i].mime); ok {
+			ranges[i].mime = c
+		}
+	}
+	ret, bestQ := charsets[0], 0.0
+	for _, charset := range charsets {
+		q, _, _ := matchAccept(ranges, charset)
+		if q > bestQ {
+			ret, bestQ = charset, q
+		}
+	}
+	if ret == "iso-8859-1" {
+		if q, _, _ := matchAccept(ranges, "utf-8"); q > 0 {
+			return "utf-8"
+		}
+	}
+	return ret
+}
+
+// contentType returns the value of Content-Type header with mime and charset. Charset is omitted if it's "".
+func contentType(mime, charset string) string {
+	if charset == "" {
+		return mime
+	}
+	return mime + "; charset=" + charset
+}
+
+// newCharsetReader returns a reader which converts r from charset to utf-8.
+func newCharsetReader(r io.Reader, charset string) (io.Reader, error) {
+	if charset == "" {
+		return r, nil
+	}
+	charset, ok := normalizeCharset(charset)
+	if !ok {
+		return nil, fmt.Errorf("unsupported charset")
+	}
+	if charset == "utf-8" {
+		return r, nil
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var runes []rune
+	switch charset {
+	case "iso-8859-1":
+		runes = make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+	default:
+		bigEndian := charset != "utf-16le"
+		if charset == "utf-16" && len(b) >= 2 {
+			switch {
+			case b[0] == 0xfe && b[1] == 0xff:
+				b = b[2:]
+			case b[0] == 0xff && b[1] == 0xfe:
+				bigEndian = false
+				b = b[2:]
+			}
+		}
+		if len(b)%2 != 0 {
+			return nil, fmt.Errorf("invalid %s data length", charset)
+		}
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			if bigEndian {
+				u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+			} else {
+				u[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+			}
+		}
+		runes = utf16.Decode(u)
+	}
+	return strings.NewReader(string(runes)), nil
+}
+
+// charsetWriter converts utf-8 data to charset and writes to inner writer.
+type charsetWriter struct {
+	w       io.Writer
+	charset string
+	pending []byte
+	started bool
+}
+
+// newCharsetWriter returns a writer converting utf-8 to charset and writing to w.
+// It returns w directly if charset is utf-8.
+func newCharsetWriter(w io.Writer, charset string) io.Writer {
+	if charset == "" || charset == "utf-8" {
+		return w
+	}
+	return &charsetWriter{
+		w:       w,
+		charset: charset,
+	}
+}
+
+func (w *charsetWriter) Write(p []byte) (int, error) {
+	data := append(w.pending, p...)
+	var out bytes.Buffer
+	if !w.started && w.charset == "utf-16" {
+		out.Write([]byte{0xfe, 0xff})
+	}
+	w.started = true
+	i := 0
+	for i < len(data) && utf8.FullRune(data[i:]) {
+		r, size := utf8.DecodeRune(data[i:])
+		i += size
+		switch w.charset {
+		case "iso-8859-1":
+			if r > 0xff {
+				return 0, fmt.Errorf("can't encode %q in %s", r, w.charset)
+			}
+			out.WriteByte(byte(r))
+		case "utf-16le":
+			for _, u := range utf16.Encode([]rune{r}) {
+				out.Write([]byte{byte(u), byte(u >> 8)})
+			}
+		default:
+			for _, u := range utf16.Encode([]rune{r}) {
+				out.Write([]byte{byte(u >> 8), byte(u)})
+			}
+		}
+	}
+	w.pending = append([]byte(nil), data[i:]...)
+	if _, err := w.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,165 @@
+package rest
+
+import (
+	"bytes"
+	"github.com/googollee/go-assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeCharset(t *testing.T) {
+	type Test struct {
+		charset string
+		ok      bool
+		target  string
+	}
+	var tests = []Test{
+		{"utf-8", true, "utf-8"},
+		{"UTF8", true, "utf-8"},
+		{`"utf-16"`, true, "utf-16"},
+		{"Latin1", true, "iso-8859-1"},
+		{"ISO-8859-1", true, "iso-8859-1"},
+		{"gbk", false, ""},
+	}
+	for i, test := range tests {
+		charset, ok := normalizeCharset(test.charset)
+		assert.Equal(t, ok, test.ok, "test %d", i)
+		assert.Equal(t, charset, test.target, "test %d", i)
+	}
+}
+
+func TestGetResponseCharset(t *testing.T) {
+	type Test struct {
+		header  http.Header
+		charset string
+	}
+	var tests = []Test{
+		{nil, "utf-8"},
+		{http.Header{"Accept-Charset": []string{"utf-8"}}, "utf-8"},
+		{http.Header{"Accept-Charset": []string{"iso-8859-1"}}, "iso-8859-1"},
+		{http.Header{"Accept-Charset": []string{"Latin1, utf-8;q=0.5"}}, "utf-8"},
+		{http.Header{"Accept-Charset": []string{"Latin1, *;q=0.1"}}, "utf-8"},
+		{http.Header{"Accept-Charset": []string{"Latin1, utf-16;q=0.5"}}, "iso-8859-1"},
+		{http.Header{"Accept-Charset": []string{"iso-8859-1;q=0.5, utf-16"}}, "utf-16"},
+		{http.Header{"Accept-Charset": []string{"*"}}, "utf-8"},
+		{http.Header{"Accept-Charset": []string{"gbk"}}, "utf-8"},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain/", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header = test.header
+		assert.Equal(t, getResponseCharset(req), test.charset, "test %d", i)
+	}
+}
+
+func TestCharsetReader(t *testing.T) {
+	type Test struct {
+		charset string
+		data    []byte
+		ok      bool
+		target  string
+	}
+	var tests = []Test{
+		{"", []byte("h\xc3\xa9"), true, "hé"},
+		{"utf-8", []byte("h\xc3\xa9"), true, "hé"},
+		{"iso-8859-1", []byte("h\xe9"), true, "hé"},
+		{"utf-16be", []byte("\x00h\x00\xe9"), true, "hé"},
+		{"utf-16le", []byte("h\x00\xe9\x00"), true, "hé"},
+		{"utf-16", []byte("\x00h\x00\xe9"), true, "hé"},
+		{"utf-16", []byte("\xfe\xff\x00h\x00\xe9"), true, "hé"},
+		{"utf-16", []byte("\xff\xfeh\x00\xe9\x00"), true, "hé"},
+		{"utf-16", []byte("\xd8\x3d\xde\x00"), true, "\U0001f600"},
+		{"utf-16", []byte("\x00h\x00"), false, ""},
+		{"gbk", []byte("h"), false, ""},
+	}
+	for i, test := range tests {
+		r, err := newCharsetReader(bytes.NewReader(test.data), test.charset)
+		assert.MustEqual(t, err == nil, test.ok, "test %d", i)
+		if err != nil {
+			continue
+		}
+		b, err := ioutil.ReadAll(r)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, string(b), test.target, "test %d", i)
+	}
+}
+
+func TestCharsetWriter(t *testing.T) {
+	type Test struct {
+		charset string
+		data    string
+		ok      bool
+		target  []byte
+	}
+	var tests = []Test{
+		{"utf-8", "hé", true, []byte("h\xc3\xa9")},
+		{"iso-8859-1", "hé", true, []byte("h\xe9")},
+		{"iso-8859-1", "h中", false, nil},
+		{"utf-16", "hé", true, []byte("\xfe\xff\x00h\x00\xe9")},
+		{"utf-16be", "hé", true, []byte("\x00h\x00\xe9")},
+		{"utf-16le", "hé", true, []byte("h\x00\xe9\x00")},
+		{"utf-16be", "\U0001f600", true, []byte("\xd8\x3d\xde\x00")},
+	}
+	for i, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		w := newCharsetWriter(buf, test.charset)
+		var err error
+		// write byte by byte to check runes splitted between writes.
+		for _, b := range []byte(test.data) {
+			if _, err = w.Write([]byte{b}); err != nil {
+				break
+			}
+		}
+		assert.MustEqual(t, err == nil, test.ok, "test %d", i)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, buf.Bytes(), test.target, "test %d", i)
+	}
+}
+
+func TestBaseHandlerCharset(t *testing.T) {
+	type Test struct {
+		header http.Header
+		body   []byte
+
+		code        int
+		contentType string
+		response    []byte
+	}
+	var tests = []Test{
+		{http.Header{}, []byte("\"h\xc3\xa9\""), http.StatusOK, "application/json; charset=utf-8", []byte("\"h\xc3\xa9\"\n")},
+		{http.Header{"Content-Type": []string{"application/json; charset=iso-8859-1"}}, []byte("\"h\xe9\""), http.StatusOK, "application/json; charset=utf-8", []byte("\"h\xc3\xa9\"\n")},
+		{http.Header{"Accept-Charset": []string{"iso-8859-1"}}, []byte("\"h\xc3\xa9\""), http.StatusOK, "application/json; charset=iso-8859-1", []byte("\"h\xe9\"\n")},
+		{http.Header{"Accept-Charset": []string{"utf-16le"}}, []byte(`"h"`), http.StatusOK, "application/json; charset=utf-16le", []byte("\"\x00h\x00\"\x00\n\x00")},
+		{http.Header{"Content-Type": []string{"application/json; charset=gbk"}}, []byte(`"h"`), http.StatusUnsupportedMediaType, "text/plain; charset=utf-8", nil},
+		{http.Header{"Accept-Charset": []string{"iso-8859-1, utf-8;q=0.5"}}, []byte("\"h\xe4\xb8\xad\""), http.StatusOK, "application/json; charset=utf-8", []byte("\"h\xe4\xb8\xad\"\n")},
+		{http.Header{"Accept-Charset": []string{"iso-8859-1"}}, []byte("\"h\xe4\xb8\xad\""), http.StatusInternalServerError, "text/plain; charset=utf-8", []byte("marshal response error: can't encode '中' in iso-8859-1\n")},
+	}
+	for i, test := range tests {
+		handler := &baseHandler{
+			name:            "Charset",
+			mime:            "application/json",
+			marshaller:      jsonMarshaller,
+			inputType:       reflect.TypeOf(""),
+			f:               reflect.ValueOf(func(ctx Context, s string) string { return s }),
+			compressMinSize: -1,
+		}
+		req, err := http.NewRequest("POST", "http://domain/", bytes.NewReader(test.body))
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header = test.header
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req, nil)
+		assert.Equal(t, resp.Code, test.code, "test %d", i)
+		assert.Equal(t, resp.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		if test.response != nil {
+			assert.Equal(t, resp.Body.Bytes(), test.response, "test %d", i)
+		} else {
+			assert.Equal(t, strings.HasPrefix(resp.Body.String(), "unsupported charset"), true, "test %d", i)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package rest
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultCompressMinSize is the minimum size of response body to compress if node doesn't specify.
+const defaultCompressMinSize = 1024
+
+// parseCompressTag parses compress tag of node. It returns -1 if compression is disabled,
+// or the minimum size of response body to compress.
+func parseCompressTag(tag string, defaultMin int) (int, error) {
+	switch tag {
+	case "", "true":
+		return defaultMin, nil
+	case "false":
+		return -1, nil
+	}
+	n, err := strconv.Atoi(tag)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid compress tag %q", tag)
+	}
+	return n, nil
+}
+
+// getCompressEncoding chooses compression encoding according to request's Accept-Encoding.
+// It returns "" if response shouldn't be compressed.
+func getCompressEncoding(r *http.Request) string {
+	accept := strings.Join(r.Header["Accept-Encoding"], ",")
+	if strings.TrimSpace(accept) == "" {
+		return ""
+	}
+	ranges := parseAccept(accept)
+	ret, bestQ := "", 0.0
+	for _, encoding := range []string{"gzip", "deflate"} {
+		q, _, _ := matchAccept(ranges, encoding)
+		if q > bestQ {
+			ret, bestQ = encoding, q
+		}
+	}
+	return ret
+}
+
+// compressResponseWriter compresses response body with encoding.
+// It buffers the body until minSize bytes were written, and doesn't compress the body which is smaller than minSize.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	code    int
+	buf     []byte
+	decided bool
+	writer  io.WriteCloser
+}
+
+func newCompressResponseWriter(w http.ResponseWriter, encoding string, minSize int) *compressResponseWriter {
+	return &compressResponseWriter{
+		ResponseWriter: w,
+		encoding:       encoding,
+		minSize:        minSize,
+	}
+}
+
+func (w *compressResponseWriter) WriteHeader(code int) {
+	if w.decided || w.code != 0 {
+		return
+	}
+	w.code = code
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		w.start(false)
+	}
+}
+
+func (w *compressResponseWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.minSize || len(w.buf) == 0 {
+			return len(p), nil
+		}
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.writer != nil {
+		return w.writer.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush flushes compressed data to inner writer.
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		w.start(len(w.buf) >= w.minSize)
+	}
+	if f, ok := w.writer.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close writes all remaining data to inner writer.
+func (w *compressResponseWriter) close() error {
+	if !w.decided {
+		if err := w.start(len(w.buf) >= w.minSize && len(w.buf) > 0); err != nil {
+			return err
+		}
+	}
+	if w.writer != nil {
+		return w.writer.Close()
+	}
+	return nil
+}
+
+func (w *compressResponseWriter) start(compress bool) error {
+	w.decided = true
+	header := w.ResponseWriter.Header()
+	if header.Get("Content-Encoding") != "" {
+		compress = false
+	}
+	if compress {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		switch w.encoding {
+		case "gzip":
+			w.writer = gzip.NewWriter(w.ResponseWriter)
+		case "deflate":
+			w.writer = zlib.NewWriter(w.ResponseWriter)
+		}
+	}
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.writer != nil {
+		_, err = w.writer.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
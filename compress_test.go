@@ -0,0 +1,233 @@
+package rest
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/googollee/go-assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCompressTag(t *testing.T) {
+	type Test struct {
+		tag string
+		ok  bool
+		min int
+	}
+	var tests = []Test{
+		{"", true, 100},
+		{"true", true, 100},
+		{"false", true, -1},
+		{"0", true, 0},
+		{"2048", true, 2048},
+		{"-1", false, 0},
+		{"abc", false, 0},
+	}
+	for i, test := range tests {
+		min, err := parseCompressTag(test.tag, 100)
+		assert.MustEqual(t, err == nil, test.ok, "test %d", i)
+		assert.Equal(t, min, test.min, "test %d", i)
+	}
+}
+
+func TestGetCompressEncoding(t *testing.T) {
+	type Test struct {
+		header   http.Header
+		encoding string
+	}
+	var tests = []Test{
+		{nil, ""},
+		{http.Header{"Accept-Encoding": []string{"identity"}}, ""},
+		{http.Header{"Accept-Encoding": []string{"gzip"}}, "gzip"},
+		{http.Header{"Accept-Encoding": []string{"deflate"}}, "deflate"},
+		{http.Header{"Accept-Encoding": []string{"gzip, deflate"}}, "gzip"},
+		{http.Header{"Accept-Encoding": []string{"gzip;q=0.5, deflate"}}, "deflate"},
+		{http.Header{"Accept-Encoding": []string{"*"}}, "gzip"},
+		{http.Header{"Accept-Encoding": []string{"*, gzip;q=0"}}, "deflate"},
+		{http.Header{"Accept-Encoding": []string{"gzip;q=0, deflate;q=0"}}, ""},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain/", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header = test.header
+		assert.Equal(t, getCompressEncoding(req), test.encoding, "test %d", i)
+	}
+}
+
+func decompress(t *testing.T, encoding string, r io.Reader) string {
+	var reader io.Reader
+	var err error
+	switch encoding {
+	case "gzip":
+		reader, err = gzip.NewReader(r)
+	case "deflate":
+		reader, err = zlib.NewReader(r)
+	default:
+		reader = r
+	}
+	assert.MustEqual(t, err, nil)
+	b, err := ioutil.ReadAll(reader)
+	assert.MustEqual(t, err, nil)
+	return string(b)
+}
+
+func TestCompressResponseWriter(t *testing.T) {
+	long := strings.Repeat("0123456789", 20)
+	type Test struct {
+		encoding string
+		minSize  int
+		code     int
+		header   http.Header
+		body     string
+
+		targetEncoding string
+		targetETag     string
+	}
+	var tests = []Test{
+		{"gzip", 100, 0, nil, "short", "", ""},
+		{"gzip", 100, 0, nil, long, "gzip", ""},
+		{"deflate", 100, 0, nil, long, "deflate", ""},
+		{"gzip", 100, http.StatusCreated, nil, long, "gzip", ""},
+		{"gzip", 100, 0, http.Header{"Etag": []string{`"abc"`}}, long, "gzip", `W/"abc"`},
+		{"gzip", 100, 0, http.Header{"Etag": []string{`"abc"`}}, "short", "", `"abc"`},
+		{"gzip", 100, 0, http.Header{"Content-Encoding": []string{"br"}}, long, "br", ""},
+		{"gzip", 0, 0, nil, "", "", ""},
+		{"gzip", 0, http.StatusNotModified, nil, "", "", ""},
+	}
+	for i, test := range tests {
+		resp := httptest.NewRecorder()
+		for k, v := range test.header {
+			resp.Header()[k] = v
+		}
+		w := newCompressResponseWriter(resp, test.encoding, test.minSize)
+		if test.code != 0 {
+			w.WriteHeader(test.code)
+		}
+		for _, b := range []byte(test.body) {
+			_, err := w.Write([]byte{b})
+			assert.MustEqual(t, err, nil, "test %d", i)
+		}
+		assert.MustEqual(t, w.close(), nil, "test %d", i)
+		code := test.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+		assert.Equal(t, resp.Code, code, "test %d", i)
+		assert.Equal(t, resp.Header().Get("Content-Encoding"), test.targetEncoding, "test %d", i)
+		assert.Equal(t, resp.Header().Get("ETag"), test.targetETag, "test %d", i)
+		if test.targetEncoding == "br" {
+			continue
+		}
+		assert.Equal(t, decompress(t, test.targetEncoding, resp.Body), test.body, "test %d", i)
+	}
+}
+
+func TestBaseHandlerCompress(t *testing.T) {
+	long := strings.Repeat("0123456789", 20)
+	type Test struct {
+		minSize int
+		header  http.Header
+
+		encoding string
+	}
+	var tests = []Test{
+		{100, nil, ""},
+		{100, http.Header{"Accept-Encoding": []string{"gzip"}}, "gzip"},
+		{1000, http.Header{"Accept-Encoding": []string{"gzip"}}, ""},
+		{-1, http.Header{"Accept-Encoding": []string{"gzip"}}, ""},
+	}
+	for i, test := range tests {
+		handler := &baseHandler{
+			name:            "Compress",
+			marshaller:      jsonMarshaller,
+			f:               reflect.ValueOf(func(ctx Context) string { return long }),
+			compressMinSize: test.minSize,
+		}
+		req, err := http.NewRequest("GET", "http://domain/", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header = test.header
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req, nil)
+		assert.Equal(t, resp.Code, http.StatusOK, "test %d", i)
+		assert.Equal(t, resp.Header().Get("Content-Encoding"), test.encoding, "test %d", i)
+		assert.Equal(t, decompress(t, test.encoding, resp.Body), "\""+long+"\"\n", "test %d", i)
+		vary := "Accept, Accept-Encoding"
+		if test.minSize < 0 {
+			vary = "Accept"
+		}
+		assert.Equal(t, strings.Join(resp.Header()["Vary"], ", "), vary, "test %d", i)
+	}
+}
+
+func TestStreamCompressTag(t *testing.T) {
+	type Test struct {
+		tag     reflect.StructTag
+		ok      bool
+		minSize int
+	}
+	var tests = []Test{
+		{`method:"GET"`, true, -1},
+		{`method:"GET" compress:"false"`, true, -1},
+		{`method:"GET" compress:"true"`, true, 0},
+		{`method:"GET" compress:"100"`, true, 100},
+		{`method:"GET" compress:"abc"`, false, 0},
+	}
+	f := func(ctx StreamContext) {}
+	for i, test := range tests {
+		_, _, handler, err := Streaming{}.CreateHandler(``, test.tag, "Stream", reflect.ValueOf(f))
+		assert.MustEqual(t, err == nil, test.ok, "test %d: %s", i, err)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, handler.(*streamHandler).compressMinSize, test.minSize, "test %d", i)
+	}
+}
+
+func TestStreamHandlerCompress(t *testing.T) {
+	p, r := make(chan int), make(chan int)
+	handler := &streamHandler{
+		name:       "Compress",
+		endline:    "\n",
+		marshaller: jsonMarshaller,
+		f: reflect.ValueOf(func(ctx StreamContext) {
+			ctx.Render(1)
+			p <- 1
+			<-r
+			ctx.Render(2)
+			p <- 1
+			<-r
+		}),
+	}
+	server := httptest.NewServer(&FakeStreamFuncHandler{handler: handler})
+	defer server.Close()
+	req, err := http.NewRequest("GET", server.URL, nil)
+	assert.MustEqual(t, err, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	resp, err := client.Do(req)
+	assert.MustEqual(t, err, nil)
+	defer resp.Body.Close()
+	assert.Equal(t, resp.Header.Get("Content-Encoding"), "gzip")
+	<-p
+	reader, err := gzip.NewReader(resp.Body)
+	assert.MustEqual(t, err, nil)
+	br := bufio.NewReader(reader)
+	line, err := br.ReadString('\n')
+	assert.Equal(t, err, nil)
+	assert.Equal(t, line, "1\n")
+	line, err = br.ReadString('\n')
+	assert.Equal(t, err, nil)
+	assert.Equal(t, line, "\n")
+	r <- 1
+	<-p
+	line, err = br.ReadString('\n')
+	assert.Equal(t, err, nil)
+	assert.Equal(t, line, "2\n")
+	r <- 1
+}
@@ -1,11 +1,14 @@
 package rest
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Context is information about a http request/response.
@@ -33,23 +36,81 @@ type Context interface {
 
 	// Return use code as http response code.
 	// If giving fmtAndArgs, it will format to string like fmt.Sprintf(fmtAndArgs...) and use as http response body.
+	// If response marshaller is an ErrorMarshaller, the message is rendered by it.
+	// With buffered response, the message replaces the rendered body, and Return without message
+	// sets the status of the rendered body.
 	// Example:
 	//     ctx.Return(http.StatusBadRequest, "input error: %s", ctx.BindError())
 	Return(code int, fmtAndArgs ...interface{})
 
 	// Render render v as response body, using special marshaller.
+	// The output of marshaller is converted from utf-8 to the charset negotiated by request's Accept-Charset.
+	// If v is []byte, io.Reader, io.WriterTo or Raw, it's written directly without marshaller and charset conversion.
+	// If the node buffers response, marshalling error is answered with 500 instead of a truncated body.
 	Render(v interface{}) error
 
+	// RenderStatus render v as response body like Render, using code as http response code.
+	RenderStatus(code int, v interface{}) error
+
+	// Paginate binds query parameters page, per_page and cursor of request.
+	// per_page is defaultPerPage if not given, and is limited to maxPerPage if maxPerPage > 0.
+	// If parameters are invalid, check Context.BindError().
+	Paginate(defaultPerPage, maxPerPage int) Page
+
+	// RenderPage render v as response body like Render, with Link header of first/prev/next/last pages.
+	// total is the number of all items, and is set in X-Total-Count header. Set total to -1 if it's unknown,
+	// then next link is added only if v is a full page.
+	RenderPage(v interface{}, page Page, total int) error
+
+	// Set stores v with key in the scope of current request.
+	// Middlewares wrapping rest can see it with RequestValue after serving.
+	Set(key, v interface{})
+
+	// Value returns the value of key stored by Context.Set or WithValue in middlewares,
+	// or the value of key in Request().Context() if not stored.
+	Value(key interface{}) interface{}
+
+	// RequestID returns the id of request, which is also in X-Request-ID response header.
+	// It returns "" if the handler isn't served by Rest.
+	RequestID() string
+
+	// Session returns the session of request, which is loaded from cookie when calling first time.
+	// Modification of session is saved with Set-Cookie before writing response header,
+	// so don't modify it after calling Return or Render.
+	// It returns ErrSessionDisabled if rest doesn't set a SessionManager.
+	Session() (*Session, error)
+
+	// IfMatch checks request's If-Match header with etag, using strong comparison.
+	// etag can be quoted like `"xyz"`, `W/"xyz"`, or the opaque value xyz only.
+	// It returns false if request doesn't have If-Match header.
 	IfMatch(etag string) bool
+
+	// IfNoneMatch checks request's If-None-Match header with etag, using weak comparison.
+	// It returns true if none of tags in header matches etag or request doesn't have If-None-Match header.
 	IfNoneMatch(etag string) bool
+
+	// IfModifiedSince checks whether modified is later than request's If-Modified-Since header.
+	// It returns true if the header doesn't exist or is invalid, or request has If-None-Match header.
+	IfModifiedSince(modified time.Time) bool
+
+	// IfUnmodifiedSince checks whether modified is not later than request's If-Unmodified-Since header.
+	// It returns true if the header doesn't exist or is invalid, or request has If-Match header.
+	IfUnmodifiedSince(modified time.Time) bool
 }
 
 type baseContext struct {
 	handlerName string
 	marshaller  Marshaller
+	charset     string
+	contentType string
 	vars        map[string]string
 	request     *http.Request
 	response    http.ResponseWriter
+	writer      io.Writer
+	session     *sessionResponseWriter
+	buffer      *bufferedResponseWriter
+	status      int  // code of RenderStatus, written with the first byte of body.
+	answered    bool // response is written by Render or Return.
 
 	formParsed bool
 	bindError  error
@@ -59,9 +120,13 @@ func newBaseContext(handlerName string, marshaller Marshaller, charset string, v
 	if marshaller == nil {
 		marshaller = jsonMarshaller
 	}
+	if charset == "" {
+		charset = "utf-8"
+	}
 	return &baseContext{
 		handlerName: handlerName,
 		marshaller:  marshaller,
+		charset:     charset,
 		vars:        vars,
 		request:     req,
 		response:    resp,
@@ -72,19 +137,33 @@ func newBaseContext(handlerName string, marshaller Marshaller, charset string, v
 }
 
 func (ctx *baseContext) IfMatch(etag string) bool {
-	return ctx.tagMatch(ctx.request.Header.Get("If-Match"), etag)
+	return etagMatch(ctx.request.Header.Get("If-Match"), etag, true)
 }
 
 func (ctx *baseContext) IfNoneMatch(etag string) bool {
-	return !ctx.tagMatch(ctx.request.Header.Get("If-None-Match"), etag)
+	return !etagMatch(ctx.request.Header.Get("If-None-Match"), etag, false)
 }
 
-func (ctx *baseContext) tagMatch(tags, tag string) bool {
-	if tags == "*" {
+func (ctx *baseContext) IfModifiedSince(modified time.Time) bool {
+	if ctx.request.Header.Get("If-None-Match") != "" {
 		return true
 	}
-	i := strings.Index(tags, tag)
-	return i >= 0
+	return modifiedSince(ctx.request.Header.Get("If-Modified-Since"), modified)
+}
+
+func (ctx *baseContext) IfUnmodifiedSince(modified time.Time) bool {
+	if ctx.request.Header.Get("If-Match") != "" {
+		return true
+	}
+	value := ctx.request.Header.Get("If-Unmodified-Since")
+	if _, err := http.ParseTime(value); err != nil {
+		return true
+	}
+	return !modifiedSince(value, modified)
+}
+
+func (ctx *baseContext) RequestID() string {
+	return RequestID(ctx.request)
 }
 
 func (ctx *baseContext) Request() *http.Request {
@@ -96,20 +175,150 @@ func (ctx *baseContext) Response() http.ResponseWriter {
 }
 
 func (ctx *baseContext) Return(code int, fmtAndArgs ...interface{}) {
+	ctx.status = 0
+	ctx.answered = true
 	if len(fmtAndArgs) == 0 {
 		ctx.response.WriteHeader(code)
+		if ctx.buffer != nil {
+			// Set the status of rendered body, and drop the body if the status doesn't allow it.
+			if code == http.StatusNoContent || code == http.StatusNotModified {
+				ctx.buffer.reset()
+				ctx.writer = nil
+			}
+			ctx.buffer.setCode(code)
+		}
 		return
 	}
-	if f, ok := fmtAndArgs[0].(string); ok {
-		message := fmt.Sprintf(f, fmtAndArgs[1:]...)
-		http.Error(ctx.response, message, code)
-		return
+	if ctx.buffer != nil {
+		ctx.buffer.reset()
+		ctx.writer = nil
 	}
-	http.Error(ctx.response, fmt.Sprintf("%s", fmtAndArgs[0]), code)
+	message := formatMessage(code, fmtAndArgs...)
+	if m, ok := ctx.marshaller.(ErrorMarshaller); ok {
+		var buf bytes.Buffer
+		if err := m.MarshalError(&buf, code, message); err == nil {
+			ctx.response.Header().Del("Content-Length")
+			ctx.response.Header().Set("X-Content-Type-Options", "nosniff")
+			ctx.response.WriteHeader(code)
+			ctx.bodyWriter().Write(buf.Bytes())
+			return
+		}
+	}
+	http.Error(ctx.response, message, code)
 }
 
 func (ctx *baseContext) Render(v interface{}) error {
-	return ctx.marshaller.Marshal(ctx.response, ctx.handlerName, v)
+	if raw, ok := rawBody(v); ok {
+		setRawContentType(ctx.response.Header(), raw, ctx.contentType)
+		ctx.writeStatus()
+		err := writeRawBody(ctx.response, raw.Body)
+		if err != nil && ctx.buffer != nil {
+			returnError(ctx, http.StatusInternalServerError, "write response error: %s", err)
+		}
+		return err
+	}
+	err := ctx.marshaller.Marshal(ctx.bodyWriter(), ctx.handlerName, v)
+	if err != nil && ctx.buffer != nil {
+		returnError(ctx, http.StatusInternalServerError, "marshal response error: %s", err)
+	}
+	return err
+}
+
+// RenderStatus writes code with the first byte of body, so if marshalling fails before writing anything,
+// the response can still be answered with an error.
+func (ctx *baseContext) RenderStatus(code int, v interface{}) error {
+	if raw, ok := rawBody(v); ok {
+		setRawContentType(ctx.response.Header(), raw, ctx.contentType)
+	}
+	ctx.status = code
+	err := ctx.Render(v)
+	if err == nil {
+		ctx.writeStatus()
+	}
+	return err
+}
+
+// writeStatus marks response answered, and writes the pending code of RenderStatus.
+func (ctx *baseContext) writeStatus() {
+	ctx.answered = true
+	if ctx.status != 0 {
+		code := ctx.status
+		ctx.status = 0
+		ctx.response.WriteHeader(code)
+	}
+}
+
+// contextBody is the response body of ctx, writing the pending code of RenderStatus first.
+type contextBody struct {
+	ctx *baseContext
+}
+
+func (b contextBody) Write(p []byte) (int, error) {
+	b.ctx.writeStatus()
+	return b.ctx.response.Write(p)
+}
+
+// setContentType sets Content-Type of response negotiated by framework.
+func (ctx *baseContext) setContentType(contentType string) {
+	ctx.contentType = contentType
+	ctx.response.Header().Set("Content-Type", contentType)
+	if strings.HasPrefix(contentType, "application/javascript") {
+		// JSONP response shouldn't be sniffed as other types by browsers.
+		ctx.response.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+}
+
+// bodyWriter returns the writer of response body, which converts utf-8 to response charset.
+func (ctx *baseContext) bodyWriter() io.Writer {
+	if ctx.writer == nil {
+		ctx.writer = newCharsetWriter(contextBody{ctx}, ctx.charset)
+	}
+	return ctx.writer
+}
+
+func (ctx *baseContext) Set(key, v interface{}) {
+	ctx.request = withValueStore(ctx.request)
+	getValueStore(ctx.request).set(key, v)
+}
+
+func (ctx *baseContext) Value(key interface{}) interface{} {
+	return RequestValue(ctx.request, key)
+}
+
+func (ctx *baseContext) Session() (*Session, error) {
+	if ctx.session == nil {
+		return nil, ErrSessionDisabled
+	}
+	return ctx.session.get()
+}
+
+// enableSession uses manager m to load and save session.
+func (ctx *baseContext) enableSession(m *SessionManager) {
+	ctx.session = newSessionResponseWriter(ctx.response, ctx.request, m)
+	ctx.response = ctx.session
+}
+
+// enableBuffer buffers response until calling finishBuffer.
+func (ctx *baseContext) enableBuffer() {
+	ctx.buffer = newBufferedResponseWriter(ctx.response)
+	ctx.response = ctx.buffer
+}
+
+// finishBuffer writes buffered response.
+func (ctx *baseContext) finishBuffer() {
+	if ctx.buffer != nil {
+		ctx.buffer.finish()
+		ctx.buffer = nil
+	}
+}
+
+// saveSession saves session if response header isn't written.
+// It returns nil if the session was saved when writing the header.
+func (ctx *baseContext) saveSession() error {
+	if ctx.session != nil {
+		return ctx.session.save()
+	}
+	return nil
 }
 
 func (ctx *baseContext) BindError() error {
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestBaseContextNew(t *testing.T) {
@@ -48,6 +49,9 @@ func TestBaseContextIfMatch(t *testing.T) {
 		{http.Header{"If-Match": []string{`"737060cd8c284d8af7ad3082f209582c", "737060cd8c284d8af7ad3082f209582d"`}}, "737060cd8c284d8af7ad3082f209582d", true},
 		{http.Header{"If-Match": []string{`"737060cd8c284d8af7ad3082f209582c", "737060cd8c284d8af7ad3082f209582e"`}}, "737060cd8c284d8af7ad3082f209582d", false},
 		{nil, "737060cd8c284d8af7ad3082f209582d", false},
+		{http.Header{"If-Match": []string{`"737060cd8c284d8af7ad3082f209582dd"`}}, "737060cd8c284d8af7ad3082f209582d", false},
+		{http.Header{"If-Match": []string{`W/"737060cd8c284d8af7ad3082f209582d"`}}, "737060cd8c284d8af7ad3082f209582d", false},
+		{http.Header{"If-Match": []string{`"737060cd8c284d8af7ad3082f209582d"`}}, `"737060cd8c284d8af7ad3082f209582d"`, true},
 	}
 	for i, test := range tests {
 		req, err := http.NewRequest("GET", "http://domain/path", nil)
@@ -73,6 +77,9 @@ func TestBaseContextIfNoneMatch(t *testing.T) {
 		{http.Header{"If-None-Match": []string{`"737060cd8c284d8af7ad3082f209582c", "737060cd8c284d8af7ad3082f209582d"`}}, "737060cd8c284d8af7ad3082f209582d", false},
 		{http.Header{"If-None-Match": []string{`"737060cd8c284d8af7ad3082f209582c", "737060cd8c284d8af7ad3082f209582e"`}}, "737060cd8c284d8af7ad3082f209582d", true},
 		{nil, "737060cd8c284d8af7ad3082f209582d", true},
+		{http.Header{"If-None-Match": []string{`"737060cd8c284d8af7ad3082f209582dd"`}}, "737060cd8c284d8af7ad3082f209582d", true},
+		{http.Header{"If-None-Match": []string{`W/"737060cd8c284d8af7ad3082f209582d"`}}, "737060cd8c284d8af7ad3082f209582d", false},
+		{http.Header{"If-None-Match": []string{`"737060cd8c284d8af7ad3082f209582d"`}}, `W/"737060cd8c284d8af7ad3082f209582d"`, false},
 	}
 	for i, test := range tests {
 		req, err := http.NewRequest("GET", "http://domain/path", nil)
@@ -84,6 +91,56 @@ func TestBaseContextIfNoneMatch(t *testing.T) {
 	}
 }
 
+func TestBaseContextIfModifiedSince(t *testing.T) {
+	modified := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	type Test struct {
+		header   http.Header
+		modified time.Time
+		ok       bool
+	}
+	var tests = []Test{
+		{nil, modified, true},
+		{http.Header{"If-Modified-Since": []string{"invalid"}}, modified, true},
+		{http.Header{"If-Modified-Since": []string{modified.Format(http.TimeFormat)}}, modified, false},
+		{http.Header{"If-Modified-Since": []string{modified.Format(http.TimeFormat)}}, modified.Add(time.Second / 2), false},
+		{http.Header{"If-Modified-Since": []string{modified.Format(http.TimeFormat)}}, modified.Add(time.Second), true},
+		{http.Header{"If-Modified-Since": []string{modified.Format(http.TimeFormat)}, "If-None-Match": []string{`"abc"`}}, modified, true},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain/path", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header = test.header
+		resp := httptest.NewRecorder()
+		ctx := newBaseContext("test", nil, "", nil, req, resp)
+		assert.Equal(t, ctx.IfModifiedSince(test.modified), test.ok, "test %d", i)
+	}
+}
+
+func TestBaseContextIfUnmodifiedSince(t *testing.T) {
+	modified := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	type Test struct {
+		header   http.Header
+		modified time.Time
+		ok       bool
+	}
+	var tests = []Test{
+		{nil, modified, true},
+		{http.Header{"If-Unmodified-Since": []string{"invalid"}}, modified, true},
+		{http.Header{"If-Unmodified-Since": []string{modified.Format(http.TimeFormat)}}, modified, true},
+		{http.Header{"If-Unmodified-Since": []string{modified.Format(http.TimeFormat)}}, modified.Add(-time.Second), true},
+		{http.Header{"If-Unmodified-Since": []string{modified.Format(http.TimeFormat)}}, modified.Add(time.Second), false},
+		{http.Header{"If-Unmodified-Since": []string{modified.Format(http.TimeFormat)}, "If-Match": []string{`"abc"`}}, modified.Add(time.Second), true},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain/path", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header = test.header
+		resp := httptest.NewRecorder()
+		ctx := newBaseContext("test", nil, "", nil, req, resp)
+		assert.Equal(t, ctx.IfUnmodifiedSince(test.modified), test.ok, "test %d", i)
+	}
+}
+
 func TestBaseContextReturn(t *testing.T) {
 	type Test struct {
 		code       int
@@ -137,6 +194,17 @@ func TestBaseContextRender(t *testing.T) {
 	}
 }
 
+func TestBaseContextRenderStatus(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://domain/path", nil)
+	assert.MustEqual(t, err, nil)
+	resp := httptest.NewRecorder()
+	ctx := newBaseContext("test", nil, "", nil, req, resp)
+	err = ctx.RenderStatus(http.StatusCreated, "created")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, resp.Code, http.StatusCreated)
+	assert.Equal(t, resp.Body.String(), "\"created\"\n")
+}
+
 func TestBaseContextBind(t *testing.T) {
 	type Test struct {
 		vars  map[string]string
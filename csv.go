@@ -0,0 +1,367 @@
+package rest
+
+import (
+	"encoding"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CSVMarshaller is Marshaller using text/csv, or tab-separated values if Comma is '\t'.
+// It marshals a slice, array or channel of structs into rows, with a header row of field names:
+//  - field name is from csv tag, or json tag, or the field name. Fields with tag "-" are skipped.
+//  - fields of nested struct are flattened with dotted names like "address.city".
+//    Recursive struct types can't be flattened, and fail with an error.
+//  - values implementing encoding.TextMarshaler, like time.Time, are written with MarshalText.
+// Rows of a channel are flushed one by one until the channel is closed, so a handler can stream a large export.
+// [][]string is written as rows without header.
+// It unmarshals rows into a slice of structs, matching columns with the header row. Unknown columns are ignored.
+type CSVMarshaller struct {
+	Comma rune
+}
+
+// csvField is a flattened field of struct, with dotted name.
+type csvField struct {
+	name  string
+	index []int
+}
+
+var csvFieldsCache sync.Map
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// isCSVLeaf returns whether t is written as one column instead of flattened.
+func isCSVLeaf(t reflect.Type) bool {
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() != reflect.Struct
+}
+
+// csvFields returns flattened fields of struct type t, or an error if t is recursive, which can't be flattened.
+func csvFields(t reflect.Type) ([]csvField, error) {
+	if ret, ok := csvFieldsCache.Load(t); ok {
+		return ret.([]csvField), nil
+	}
+	ret, err := flattenCSVFields(t, make(map[reflect.Type]bool))
+	if err != nil {
+		return nil, err
+	}
+	csvFieldsCache.Store(t, ret)
+	return ret, nil
+}
+
+// flattenCSVFields flattens fields of struct type t. Types in stack are being flattened.
+func flattenCSVFields(t reflect.Type, stack map[reflect.Type]bool) ([]csvField, error) {
+	if stack[t] {
+		return nil, fmt.Errorf("csv: recursive type %s", t)
+	}
+	stack[t] = true
+	defer delete(stack, t)
+	var ret []csvField
+	for i, n := 0, t.NumField(); i < n; i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("csv")
+		if tag == "" {
+			tag = field.Tag.Get("json")
+		}
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			tag = tag[:i]
+		}
+		if tag == "-" {
+			continue
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if tag == "" && field.Anonymous && !isCSVLeaf(field.Type) {
+			fields, err := flattenCSVFields(ft, stack)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range fields {
+				ret = append(ret, csvField{f.name, append([]int{i}, f.index...)})
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if tag == "" {
+			tag = field.Name
+		}
+		if isCSVLeaf(field.Type) {
+			ret = append(ret, csvField{tag, []int{i}})
+			continue
+		}
+		fields, err := flattenCSVFields(ft, stack)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			ret = append(ret, csvField{tag + "." + f.name, append([]int{i}, f.index...)})
+		}
+	}
+	return ret, nil
+}
+
+// csvFieldValue returns the field of v with index, or false if it's in a nil pointer.
+func csvFieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			for v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}, false
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func formatCSVValue(v reflect.Value) (string, error) {
+	if v.Type().Implements(textMarshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return "", nil
+		}
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return "", nil
+		}
+		return formatCSVValue(v.Elem())
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+	return "", fmt.Errorf("csv: unsupported type %s", v.Type())
+}
+
+func (c CSVMarshaller) comma() rune {
+	if c.Comma == 0 {
+		return ','
+	}
+	return c.Comma
+}
+
+// Marshal will marshal v and write to w.
+func (c CSVMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = c.comma()
+	if rows, ok := v.([][]string); ok {
+		writer.WriteAll(rows)
+		return writer.Error()
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	var next func() (reflect.Value, bool)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		i := 0
+		next = func() (reflect.Value, bool) {
+			if i >= rv.Len() {
+				return reflect.Value{}, false
+			}
+			i++
+			return rv.Index(i - 1), true
+		}
+	case reflect.Chan:
+		next = func() (reflect.Value, bool) {
+			writer.Flush()
+			return rv.Recv()
+		}
+	case reflect.Struct:
+		done := false
+		next = func() (reflect.Value, bool) {
+			if done {
+				return reflect.Value{}, false
+			}
+			done = true
+			return rv, true
+		}
+	default:
+		return fmt.Errorf("csv: can't marshal %T", v)
+	}
+
+	t := rv.Type()
+	if t.Kind() != reflect.Struct {
+		t = t.Elem()
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("csv: can't marshal rows of %s", t)
+	}
+	fields, err := csvFields(t)
+	if err != nil {
+		return err
+	}
+	row := make([]string, len(fields))
+	for i, f := range fields {
+		row[i] = f.name
+	}
+	if err := writer.Write(row); err != nil {
+		return err
+	}
+	for {
+		elem, ok := next()
+		if !ok {
+			break
+		}
+		for elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Interface {
+			if elem.IsNil() {
+				break
+			}
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct {
+			continue
+		}
+		for i, f := range fields {
+			row[i] = ""
+			fv, ok := csvFieldValue(elem, f.index)
+			if !ok {
+				continue
+			}
+			s, err := formatCSVValue(fv)
+			if err != nil {
+				return err
+			}
+			row[i] = s
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Unmarshal will read r and unmarshal rows to v, which should be a pointer to slice of structs, or *[][]string.
+func (c CSVMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	reader := csv.NewReader(r)
+	reader.Comma = c.comma()
+	if rows, ok := v.(*[][]string); ok {
+		records, err := reader.ReadAll()
+		if err != nil {
+			return err
+		}
+		*rows = records
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("csv: can't unmarshal to %T", v)
+	}
+	rv = rv.Elem()
+	t := rv.Type().Elem()
+	structType := t
+	for structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return fmt.Errorf("csv: can't unmarshal to %T", v)
+	}
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		rv.Set(reflect.MakeSlice(rv.Type(), 0, 0))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fields, err := csvFields(structType)
+	if err != nil {
+		return err
+	}
+	fieldByName := make(map[string]csvField)
+	for _, f := range fields {
+		fieldByName[f.name] = f
+	}
+	columns := make([]*csvField, len(header))
+	for i, name := range header {
+		if f, ok := fieldByName[strings.TrimSpace(name)]; ok {
+			columns[i] = &f
+		}
+	}
+
+	ret := reflect.MakeSlice(rv.Type(), 0, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(t).Elem()
+		row := elem
+		for row.Kind() == reflect.Ptr {
+			row.Set(reflect.New(row.Type().Elem()))
+			row = row.Elem()
+		}
+		for i, s := range record {
+			if columns[i] == nil || s == "" {
+				continue
+			}
+			if err := setCSVValue(row, columns[i].index, s); err != nil {
+				return fmt.Errorf("csv: line %d column %q: %s", line, header[i], err)
+			}
+		}
+		ret = reflect.Append(ret, elem)
+	}
+	rv.Set(ret)
+	return nil
+}
+
+// setCSVValue sets string s to the field of v with index, allocating nil pointers.
+func setCSVValue(v reflect.Value, index []int, s string) error {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	return setFormString(v, s)
+}
@@ -0,0 +1,164 @@
+package rest
+
+import (
+	"bytes"
+	"github.com/googollee/go-assert"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type csvAddress struct {
+	City string `json:"city"`
+	Zip  *int   `csv:"zip_code"`
+}
+
+type csvBase struct {
+	ID int `csv:"id"`
+}
+
+type csvRow struct {
+	csvBase
+	Name     string      `csv:"name" json:"full_name"`
+	Score    float64     `json:"score,omitempty"`
+	Admin    bool        `json:"admin"`
+	Created  time.Time   `json:"created"`
+	Address  csvAddress  `json:"address"`
+	Previous *csvAddress `json:"prev"`
+	Ignored  string      `csv:"-"`
+	Raw      string
+	private  string
+}
+
+type csvTree struct {
+	Name   string
+	Parent *csvTree
+}
+
+type csvEmbedTree struct {
+	Name string
+	*csvEmbedTree
+}
+
+func TestCSVMarshallerMarshal(t *testing.T) {
+	zip := 100
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	header := "id,name,score,admin,created,address.city,address.zip_code,prev.city,prev.zip_code,Raw\n"
+	rows := []csvRow{
+		{csvBase: csvBase{ID: 1}, Name: "a,b", Score: 1.5, Admin: true, Created: created, Address: csvAddress{City: "x", Zip: &zip}},
+		{Name: "c", Previous: &csvAddress{City: "y"}, Raw: "raw"},
+	}
+	lines := header +
+		"1,\"a,b\",1.5,true,2020-01-02T03:04:05Z,x,100,,,\n" +
+		"0,c,0,false,0001-01-01T00:00:00Z,,,y,,raw\n"
+	ch := make(chan *csvRow, 3)
+	ch <- &rows[0]
+	ch <- nil
+	ch <- &rows[1]
+	close(ch)
+
+	type Test struct {
+		m    CSVMarshaller
+		v    interface{}
+		ok   bool
+		data string
+	}
+	var tests = []Test{
+		{CSVMarshaller{}, rows, true, lines},
+		{CSVMarshaller{}, &rows, true, lines},
+		{CSVMarshaller{}, []*csvRow{&rows[0], nil, &rows[1]}, true, lines},
+		{CSVMarshaller{}, ch, true, lines},
+		{CSVMarshaller{}, rows[1], true, header + "0,c,0,false,0001-01-01T00:00:00Z,,,y,,raw\n"},
+		{CSVMarshaller{}, []csvRow{}, true, header},
+		{CSVMarshaller{Comma: '\t'}, rows[:1], true, strings.Replace(header, ",", "\t", -1) + "1\ta,b\t1.5\ttrue\t2020-01-02T03:04:05Z\tx\t100\t\t\t\n"},
+		{CSVMarshaller{}, [][]string{{"a", "b"}, {"1", "2"}}, true, "a,b\n1,2\n"},
+		{CSVMarshaller{}, []int{1}, false, ""},
+		{CSVMarshaller{}, 1, false, ""},
+		{CSVMarshaller{}, []struct{ A []int }{{[]int{1}}}, false, ""},
+		{CSVMarshaller{}, []csvTree{{Name: "a", Parent: &csvTree{Name: "b"}}}, false, ""},
+		{CSVMarshaller{}, []csvEmbedTree{{Name: "a"}}, false, ""},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		err := test.m.Marshal(&buf, "test", test.v)
+		assert.MustEqual(t, err == nil, test.ok, "test %d: %s", i, err)
+		assert.Equal(t, buf.String(), test.data, "test %d", i)
+	}
+}
+
+func TestCSVMarshallerUnmarshal(t *testing.T) {
+	zip := 100
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	type Test struct {
+		m      CSVMarshaller
+		data   string
+		ok     bool
+		target []csvRow
+	}
+	var tests = []Test{
+		{CSVMarshaller{}, "id,name,created,address.zip_code,prev.city,unknown\n1,a,2020-01-02T03:04:05Z,100,y,x\n2,,,,,\n", true, []csvRow{
+			{csvBase: csvBase{ID: 1}, Name: "a", Created: created, Address: csvAddress{Zip: &zip}, Previous: &csvAddress{City: "y"}},
+			{csvBase: csvBase{ID: 2}},
+		}},
+		{CSVMarshaller{Comma: '\t'}, "name\tadmin\na,b\ttrue\n", true, []csvRow{{Name: "a,b", Admin: true}}},
+		{CSVMarshaller{}, "", true, []csvRow{}},
+		{CSVMarshaller{}, "id\n", true, []csvRow{}},
+		{CSVMarshaller{}, "id\nabc\n", false, nil},
+		{CSVMarshaller{}, "created\nabc\n", false, nil},
+		{CSVMarshaller{}, "id,name\n1\n", false, nil},
+	}
+	for i, test := range tests {
+		var rows []csvRow
+		err := test.m.Unmarshal(strings.NewReader(test.data), &rows)
+		assert.MustEqual(t, err == nil, test.ok, "test %d: %s", i, err)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, rows, test.target, "test %d", i)
+	}
+
+	var ptrs []*csvRow
+	err := CSVMarshaller{}.Unmarshal(strings.NewReader("id\n1\n"), &ptrs)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, ptrs, []*csvRow{{csvBase: csvBase{ID: 1}}})
+
+	var records [][]string
+	err = CSVMarshaller{}.Unmarshal(strings.NewReader("a,b\n1,2\n"), &records)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, records, [][]string{{"a", "b"}, {"1", "2"}})
+
+	var row csvRow
+	err = CSVMarshaller{}.Unmarshal(strings.NewReader("id\n1\n"), &row)
+	assert.NotEqual(t, err, nil)
+
+	var trees []csvTree
+	err = CSVMarshaller{}.Unmarshal(strings.NewReader("Name\na\n"), &trees)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestCSVHandler(t *testing.T) {
+	f := reflect.ValueOf(func(ctx Context, arg []csvAddress) []csvAddress {
+		return append(arg, csvAddress{City: "z"})
+	})
+	handler := &baseHandler{
+		name:            "Addresses",
+		mime:            "application/json",
+		marshaller:      jsonMarshaller,
+		inputType:       f.Type().In(1),
+		f:               f,
+		compressMinSize: -1,
+	}
+	req, err := http.NewRequest("POST", "http://domain/", strings.NewReader("city\nx\n"))
+	assert.MustEqual(t, err, nil)
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("Accept", "text/tab-separated-values")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req, nil)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Header().Get("Content-Type"), "text/tab-separated-values; charset=utf-8")
+	assert.Equal(t, resp.Body.String(), "city\tzip_code\nx\t\nz\t\n")
+}
@@ -0,0 +1,38 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Error is an error with http status code.
+// If handler returns an *Error, Code will be used as http response code and Message as response body.
+type Error struct {
+	Code    int
+	Message string
+}
+
+// NewError create an *Error with http status code.
+// If giving fmtAndArgs, it will format to string like fmt.Sprintf(fmtAndArgs...) and use as message,
+// otherwise the status text of code will be used.
+func NewError(code int, fmtAndArgs ...interface{}) *Error {
+	return &Error{
+		Code:    code,
+		Message: formatMessage(code, fmtAndArgs...),
+	}
+}
+
+// Error implement error interface.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func formatMessage(code int, fmtAndArgs ...interface{}) string {
+	if len(fmtAndArgs) == 0 {
+		return http.StatusText(code)
+	}
+	if f, ok := fmtAndArgs[0].(string); ok {
+		return fmt.Sprintf(f, fmtAndArgs[1:]...)
+	}
+	return fmt.Sprintf("%s", fmtAndArgs[0])
+}
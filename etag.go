@@ -0,0 +1,180 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// entityTag is a parsed entity-tag of RFC 7232.
+type entityTag struct {
+	weak   bool
+	opaque string
+}
+
+// parseETag parses one entity-tag. A tag without quotes is treated as a strong tag with itself as opaque value.
+func parseETag(tag string) entityTag {
+	tag = strings.TrimSpace(tag)
+	ret := entityTag{}
+	if strings.HasPrefix(tag, "W/") {
+		ret.weak = true
+		tag = tag[2:]
+	}
+	if len(tag) >= 2 && tag[0] == '"' && tag[len(tag)-1] == '"' {
+		tag = tag[1 : len(tag)-1]
+	}
+	ret.opaque = tag
+	return ret
+}
+
+// strongMatch compares t and o with strong comparison function.
+func (t entityTag) strongMatch(o entityTag) bool {
+	return !t.weak && !o.weak && t.opaque == o.opaque
+}
+
+// weakMatch compares t and o with weak comparison function.
+func (t entityTag) weakMatch(o entityTag) bool {
+	return t.opaque == o.opaque
+}
+
+// parseETagList parses a If-Match or If-None-Match header value.
+// It returns all as true if the value is "*". Parsing stops at the first malformed tag.
+func parseETagList(value string) (tags []entityTag, all bool) {
+	value = strings.TrimSpace(value)
+	if value == "*" {
+		return nil, true
+	}
+	for {
+		value = strings.TrimLeft(value, " \t,")
+		if value == "" {
+			return tags, false
+		}
+		tag := entityTag{}
+		if strings.HasPrefix(value, "W/") {
+			tag.weak = true
+			value = value[2:]
+		}
+		if len(value) == 0 {
+			return tags, false
+		}
+		if value[0] != '"' {
+			// not quoted, accept it as a token until next comma for lenient clients.
+			end := strings.IndexAny(value, " \t,")
+			if end < 0 {
+				end = len(value)
+			}
+			tag.opaque = value[:end]
+			tags = append(tags, tag)
+			value = value[end:]
+			continue
+		}
+		end := strings.IndexByte(value[1:], '"')
+		if end < 0 {
+			return tags, false
+		}
+		tag.opaque = value[1 : end+1]
+		tags = append(tags, tag)
+		value = value[end+2:]
+	}
+}
+
+// etagMatch checks whether header value list matches etag, using strong comparison or weak comparison.
+func etagMatch(list, etag string, strong bool) bool {
+	tags, all := parseETagList(list)
+	if all {
+		return true
+	}
+	target := parseETag(etag)
+	for _, tag := range tags {
+		if strong && tag.strongMatch(target) {
+			return true
+		}
+		if !strong && tag.weakMatch(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// modifiedSince checks whether modified is later than the http date in header value.
+// It returns true if value is not a valid http date.
+func modifiedSince(value string, modified time.Time) bool {
+	since, err := http.ParseTime(value)
+	if err != nil {
+		return true
+	}
+	return modified.Truncate(time.Second).After(since)
+}
+
+// notModified checks whether GET/HEAD request r can be answered with 304,
+// using ETag and Last-Modified in response header.
+func notModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := header.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		return etagMatch(inm, etag, false)
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	lastModified := header.Get("Last-Modified")
+	if ims == "" || lastModified == "" {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modifiedSince(ims, modified)
+}
+
+// etagResponseWriter buffers the response body, and generates ETag from the body when finishing.
+type etagResponseWriter struct {
+	http.ResponseWriter
+	code int
+	buf  bytes.Buffer
+}
+
+func newETagResponseWriter(w http.ResponseWriter) *etagResponseWriter {
+	return &etagResponseWriter{
+		ResponseWriter: w,
+	}
+}
+
+func (w *etagResponseWriter) WriteHeader(code int) {
+	if w.code != 0 {
+		return
+	}
+	w.code = code
+}
+
+func (w *etagResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.buf.Write(p)
+}
+
+// finish writes buffered response to inner writer, or answers 304 if request r's preconditions match.
+func (w *etagResponseWriter) finish(r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	header := w.ResponseWriter.Header()
+	if w.code == http.StatusOK {
+		if header.Get("ETag") == "" {
+			header.Set("ETag", fmt.Sprintf(`"%x"`, sha1.Sum(w.buf.Bytes())))
+		}
+		if notModified(r, header) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			w.ResponseWriter.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if w.code != http.StatusNoContent && w.code != http.StatusNotModified {
+		header.Set("Content-Length", strconv.Itoa(w.buf.Len()))
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	w.ResponseWriter.Write(w.buf.Bytes())
+}
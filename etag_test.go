@@ -0,0 +1,129 @@
+package rest
+
+import (
+	"github.com/googollee/go-assert"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseETagList(t *testing.T) {
+	type Test struct {
+		value string
+		tags  []entityTag
+		all   bool
+	}
+	var tests = []Test{
+		{``, nil, false},
+		{`*`, nil, true},
+		{`"abc"`, []entityTag{{false, "abc"}}, false},
+		{`W/"abc"`, []entityTag{{true, "abc"}}, false},
+		{`"abc", W/"def" ,"g,h"`, []entityTag{{false, "abc"}, {true, "def"}, {false, "g,h"}}, false},
+		{`""`, []entityTag{{false, ""}}, false},
+		{`abc, "def"`, []entityTag{{false, "abc"}, {false, "def"}}, false},
+		{`"abc", "def`, []entityTag{{false, "abc"}}, false},
+	}
+	for i, test := range tests {
+		tags, all := parseETagList(test.value)
+		assert.Equal(t, tags, test.tags, "test %d", i)
+		assert.Equal(t, all, test.all, "test %d", i)
+	}
+}
+
+func TestETagMatch(t *testing.T) {
+	type Test struct {
+		list   string
+		etag   string
+		strong bool
+		ok     bool
+	}
+	var tests = []Test{
+		{`"abc"`, `abc`, true, true},
+		{`"abc"`, `"abc"`, true, true},
+		{`"abcd"`, `abc`, true, false},
+		{`"abc"`, `abcd`, true, false},
+		{`W/"abc"`, `abc`, true, false},
+		{`"abc"`, `W/"abc"`, true, false},
+		{`W/"abc"`, `abc`, false, true},
+		{`"abc"`, `W/"abc"`, false, true},
+		{`W/"abc"`, `W/"abc"`, false, true},
+		{`"xyz", W/"abc"`, `"abc"`, false, true},
+		{`*`, `abc`, true, true},
+		{``, `abc`, false, false},
+	}
+	for i, test := range tests {
+		assert.Equal(t, etagMatch(test.list, test.etag, test.strong), test.ok, "test %d", i)
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	type Test struct {
+		request  http.Header
+		response http.Header
+		ok       bool
+	}
+	var tests = []Test{
+		{http.Header{}, http.Header{"Etag": []string{`"abc"`}}, false},
+		{http.Header{"If-None-Match": []string{`"abc"`}}, http.Header{"Etag": []string{`"abc"`}}, true},
+		{http.Header{"If-None-Match": []string{`W/"abc"`}}, http.Header{"Etag": []string{`"abc"`}}, true},
+		{http.Header{"If-None-Match": []string{`"abcd"`}}, http.Header{"Etag": []string{`"abc"`}}, false},
+		{http.Header{"If-None-Match": []string{`"abc"`}}, http.Header{}, false},
+		{http.Header{"If-Modified-Since": []string{modified.Format(http.TimeFormat)}}, http.Header{"Last-Modified": []string{modified.Format(http.TimeFormat)}}, true},
+		{http.Header{"If-Modified-Since": []string{modified.Add(-time.Second).Format(http.TimeFormat)}}, http.Header{"Last-Modified": []string{modified.Format(http.TimeFormat)}}, false},
+		{http.Header{"If-None-Match": []string{`"xyz"`}, "If-Modified-Since": []string{modified.Format(http.TimeFormat)}}, http.Header{"Etag": []string{`"abc"`}, "Last-Modified": []string{modified.Format(http.TimeFormat)}}, false},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain/path", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header = test.request
+		assert.Equal(t, notModified(req, test.response), test.ok, "test %d", i)
+	}
+}
+
+func TestAutoETag(t *testing.T) {
+	etag := `"58ad0682f005b09cd5e819f63fb08c6574978fc6"`
+	type Test struct {
+		method string
+		header http.Header
+		f      reflect.Value
+
+		code int
+		etag string
+		body string
+	}
+	render := reflect.ValueOf(func(ctx Context) string { return "str" })
+	var tests = []Test{
+		{"GET", http.Header{}, render, http.StatusOK, etag, "\"str\"\n"},
+		{"GET", http.Header{"If-None-Match": []string{etag}}, render, http.StatusNotModified, etag, ""},
+		{"GET", http.Header{"If-None-Match": []string{"W/" + etag}}, render, http.StatusNotModified, etag, ""},
+		{"GET", http.Header{"If-None-Match": []string{`"other"`}}, render, http.StatusOK, etag, "\"str\"\n"},
+		{"HEAD", http.Header{"If-None-Match": []string{etag}}, render, http.StatusNotModified, etag, ""},
+		{"POST", http.Header{"If-None-Match": []string{etag}}, render, http.StatusOK, "", "\"str\"\n"},
+		{"GET", http.Header{"If-None-Match": []string{`"custom"`}}, reflect.ValueOf(func(ctx Context) string {
+			ctx.Response().Header().Set("ETag", `"custom"`)
+			return "str"
+		}), http.StatusNotModified, `"custom"`, ""},
+		{"GET", http.Header{"If-None-Match": []string{etag}}, reflect.ValueOf(func(ctx Context) error {
+			return NewError(http.StatusNotFound, "str")
+		}), http.StatusNotFound, "", "str\n"},
+	}
+	for i, test := range tests {
+		handler := &baseHandler{
+			name:       "ETag",
+			marshaller: jsonMarshaller,
+			f:          test.f,
+			autoETag:   true,
+		}
+		req, err := http.NewRequest(test.method, "http://domain/path", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header = test.header
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req, nil)
+		assert.Equal(t, resp.Code, test.code, "test %d", i)
+		assert.Equal(t, resp.Header().Get("ETag"), test.etag, "test %d", i)
+		assert.Equal(t, resp.Body.String(), test.body, "test %d", i)
+	}
+}
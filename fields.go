@@ -0,0 +1,244 @@
+package rest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// structField is a field of struct, named with json tag.
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	tagged    bool // name is in json tag.
+	quoted    bool // ",string" option in json tag.
+}
+
+var structFieldsCache sync.Map
+
+// jsonFields returns fields of struct type t with names in json tag, for marshallers other than json.
+// Fields of embedded struct or struct pointer without tag are promoted, and a field hidden by
+// another one with the same name is dropped, following the rules of encoding/json:
+//  - the field of less depth dominates;
+//  - otherwise the tagged field dominates if there is only one;
+//  - otherwise all fields with the name are dropped.
+func jsonFields(t reflect.Type) []structField {
+	if ret, ok := structFieldsCache.Load(t); ok {
+		return ret.([]structField)
+	}
+	ret := dominantFields(typeFields(t))
+	structFieldsCache.Store(t, ret)
+	return ret
+}
+
+// typeFields returns all fields of struct type t, including hidden ones, in breadth-first order of embedding.
+func typeFields(t reflect.Type) []structField {
+	type embedded struct {
+		t     reflect.Type
+		index []int
+	}
+	var ret []structField
+	next := []embedded{{t, nil}}
+	nextCount := map[reflect.Type]int{t: 1}
+	visited := map[reflect.Type]bool{}
+	for len(next) > 0 {
+		current, count := next, nextCount
+		next, nextCount = nil, map[reflect.Type]int{}
+		for _, e := range current {
+			if visited[e.t] {
+				continue
+			}
+			visited[e.t] = true
+			for i, n := 0, e.t.NumField(); i < n; i++ {
+				field := e.t.Field(i)
+				index := append(append([]int{}, e.index...), i)
+				ft := field.Type
+				if field.Anonymous && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if field.Anonymous {
+					if field.PkgPath != "" && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if field.PkgPath != "" {
+					continue
+				}
+				tag := field.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts := tag, ""
+				if i := strings.IndexByte(tag, ','); i >= 0 {
+					name, opts = tag[:i], tag[i+1:]
+				}
+				if name == "" && field.Anonymous && ft.Kind() == reflect.Struct {
+					nextCount[ft]++
+					if nextCount[ft] == 1 {
+						next = append(next, embedded{ft, index})
+					}
+					continue
+				}
+				tagged := name != ""
+				if !tagged {
+					name = field.Name
+				}
+				f := structField{
+					name:      name,
+					index:     index,
+					omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+					tagged:    tagged,
+					quoted:    strings.Contains(","+opts+",", ",string,") && isQuotableKind(ft),
+				}
+				ret = append(ret, f)
+				if count[e.t] > 1 {
+					// The struct is embedded more than once at this depth, so its fields hide each other.
+					ret = append(ret, f)
+				}
+			}
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		a, b := ret[i].index, ret[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return ret
+}
+
+// isQuotableKind reports whether ",string" option applies to type t, which is a scalar or a pointer to scalar.
+func isQuotableKind(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	}
+	return false
+}
+
+// dominantFields drops fields hidden by others with the same name, keeping the order of fields.
+func dominantFields(fields []structField) []structField {
+	byName := map[string][]int{}
+	for i, f := range fields {
+		byName[f.name] = append(byName[f.name], i)
+	}
+	var ret []structField
+	for i, f := range fields {
+		candidates := byName[f.name]
+		if len(candidates) == 1 {
+			ret = append(ret, f)
+			continue
+		}
+		depth := len(fields[candidates[0]].index)
+		for _, c := range candidates {
+			if d := len(fields[c].index); d < depth {
+				depth = d
+			}
+		}
+		dominant, tagged := -1, 0
+		for _, c := range candidates {
+			if len(fields[c].index) != depth {
+				continue
+			}
+			if dominant < 0 {
+				dominant = c
+			}
+			if fields[c].tagged {
+				if tagged == 0 || !fields[dominant].tagged {
+					dominant = c
+				}
+				tagged++
+			}
+		}
+		ambiguous := tagged > 1
+		if tagged == 0 {
+			n := 0
+			for _, c := range candidates {
+				if len(fields[c].index) == depth {
+					n++
+				}
+			}
+			ambiguous = n > 1
+		}
+		if !ambiguous && dominant == i {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// structFieldValue returns the field of struct v with index, or false if it's in a nil embedded pointer.
+func structFieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// structFieldAlloc returns the field of struct v with index for decoding, allocating nil embedded pointers.
+func structFieldAlloc(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("can't set embedded pointer to unexported struct %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// findJSONField returns the field of struct type t with name, or nil if not found.
+// It matches name case-insensitively if no field matches exactly, like encoding/json.
+func findJSONField(t reflect.Type, name string) *structField {
+	fields := jsonFields(t)
+	for i := range fields {
+		if fields[i].name == name {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, name) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package rest
+
+import (
+	"encoding/json"
+	"github.com/googollee/go-assert"
+	"reflect"
+	"testing"
+)
+
+type fieldsBase struct {
+	ID   int    `json:"id"`
+	Name string `json:",omitempty"`
+}
+
+type fieldsOther struct {
+	ID    int
+	Name  string
+	Other string
+}
+
+type fieldsTagged struct {
+	Name string `json:"Name"`
+}
+
+type fieldsHidden struct {
+	Value int
+}
+
+type fieldsEmbed struct {
+	fieldsBase
+	*fieldsOther
+	Extra int `json:"extra,omitempty"`
+}
+
+type fieldsConflict struct {
+	fieldsOther
+	fieldsTagged
+	fieldsHidden `json:"hidden"`
+}
+
+type fieldsPtrTagged struct {
+	*fieldsHidden `json:"hidden,omitempty"`
+	*fieldsBase   `json:"base"`
+}
+
+type fieldsQuoted struct {
+	Int    int               `json:"int,string"`
+	Bool   bool              `json:",string"`
+	Float  float64           `json:",string,omitempty"`
+	String string            `json:"string,string"`
+	Ptr    *int              `json:"ptr,string"`
+	Nil    *int              `json:"nil,string"`
+	Slice  []int             `json:"slice,string"`
+	Map    map[string]string `json:"map,omitempty,string"`
+	Skip   int               `json:"-"`
+	Dash   int               `json:"-,"`
+}
+
+func TestJSONFields(t *testing.T) {
+	one := 1
+	var tests = []interface{}{
+		fieldsEmbed{fieldsBase{1, "a"}, nil, 0},
+		fieldsEmbed{fieldsBase{1, ""}, &fieldsOther{2, "b", "c"}, 3},
+		&fieldsConflict{fieldsOther{1, "a", "b"}, fieldsTagged{"c"}, fieldsHidden{2}},
+		fieldsPtrTagged{&fieldsHidden{1}, &fieldsBase{2, "a"}},
+		fieldsPtrTagged{},
+		fieldsQuoted{1, true, 1.5, "a\"b", &one, nil, []int{1}, nil, 2, 3},
+		fieldsQuoted{},
+		[]fieldsEmbed{{Extra: 1}},
+	}
+	for i, v := range tests {
+		expect, err := json.Marshal(v)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		renamed, err := renameJSON(reflect.ValueOf(v), KeepNames)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		got, err := json.Marshal(renamed)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, string(got), string(expect), "test %d", i)
+	}
+}
@@ -0,0 +1,510 @@
+package rest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParamsUnmarshaller is a Marshaller which needs parameters of request's Content-Type to unmarshal,
+// like boundary of multipart/form-data.
+type ParamsUnmarshaller interface {
+	Marshaller
+	UnmarshalWithParams(r io.Reader, params map[string]string, v interface{}) error
+}
+
+// requestUnmarshaller is a ParamsUnmarshaller which needs the request, like MultipartMarshaller removing
+// temporary files when the request is done.
+type requestUnmarshaller interface {
+	unmarshalRequest(req *http.Request, r io.Reader, params map[string]string, v interface{}) error
+}
+
+// paramsUnmarshaller binds Content-Type parameters and the request to a ParamsUnmarshaller.
+type paramsUnmarshaller struct {
+	ParamsUnmarshaller
+	params  map[string]string
+	request *http.Request
+}
+
+func (u paramsUnmarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	if ru, ok := u.ParamsUnmarshaller.(requestUnmarshaller); ok && u.request != nil {
+		return ru.unmarshalRequest(u.request, r, u.params, v)
+	}
+	return u.UnmarshalWithParams(r, u.params, v)
+}
+
+// FormMarshaller is Marshaller using application/x-www-form-urlencoded.
+// Form fields are decoded into struct fields with tag like `form:"name"`, or field name if no tag:
+//  - repeated keys like "tag=a&tag=b" or "tag[]=a&tag[]=b" are decoded into slice.
+//  - nested keys like "user[name]" are decoded into field Name of struct field user, or key name of map field user.
+//  - indexed keys like "users[0][name]" are decoded into slice field users, ordered by index without gaps,
+//    so "users[5][name]" alone is decoded into element 0.
+// Unknown fields are ignored.
+// It marshals v as form too, but isn't negotiated by Accept for response.
+type FormMarshaller struct{}
+
+// RequestOnly returns true, so form isn't a response type.
+func (f FormMarshaller) RequestOnly() bool {
+	return true
+}
+
+// Marshal will marshal v as form and write to w.
+func (f FormMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	values := make(url.Values)
+	if err := encodeFormValue(values, "", reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, values.Encode())
+	return err
+}
+
+// Unmarshal will read r and unmarshal form to v.
+func (f FormMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return err
+	}
+	return decodeForm(values, nil, v)
+}
+
+// MultipartMarshaller is Marshaller decoding multipart/form-data, with the same rules of FormMarshaller.
+// Files are decoded into fields of type *multipart.FileHeader or []*multipart.FileHeader.
+// Files are kept in memory up to 32MB in total, and larger ones are stored in temporary files,
+// which are removed when the request is done.
+// It can't marshal response.
+type MultipartMarshaller struct{}
+
+// multipartMaxMemory is the maximum bytes of multipart form kept in memory.
+const multipartMaxMemory = 32 << 20
+
+// RequestOnly returns true, so multipart isn't a response type.
+func (m MultipartMarshaller) RequestOnly() bool {
+	return true
+}
+
+// Marshal isn't supported by MultipartMarshaller.
+func (m MultipartMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	return fmt.Errorf("multipart marshaller can't marshal")
+}
+
+// Unmarshal can't decode without boundary, use UnmarshalWithParams instead.
+func (m MultipartMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	return m.UnmarshalWithParams(r, nil, v)
+}
+
+// UnmarshalWithParams will read r with boundary in params and unmarshal form to v.
+// Temporary files of large files are only removed for request bodies decoded by handlers.
+func (m MultipartMarshaller) UnmarshalWithParams(r io.Reader, params map[string]string, v interface{}) error {
+	form, err := m.readForm(r, params)
+	if err != nil {
+		return err
+	}
+	return decodeForm(url.Values(form.Value), form.File, v)
+}
+
+func (m MultipartMarshaller) unmarshalRequest(req *http.Request, r io.Reader, params map[string]string, v interface{}) error {
+	form, err := m.readForm(r, params)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-req.Context().Done()
+		form.RemoveAll()
+	}()
+	return decodeForm(url.Values(form.Value), form.File, v)
+}
+
+func (m MultipartMarshaller) readForm(r io.Reader, params map[string]string) (*multipart.Form, error) {
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, fmt.Errorf("multipart boundary is missing")
+	}
+	return multipart.NewReader(r, boundary).ReadForm(multipartMaxMemory)
+}
+
+var fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+
+// splitFormKey splits key like "a[b][c]" to ["a", "b", "c"].
+func splitFormKey(key string) []string {
+	i := strings.IndexByte(key, '[')
+	if i <= 0 || !strings.HasSuffix(key, "]") {
+		return []string{key}
+	}
+	return append([]string{key[:i]}, strings.Split(key[i+1:len(key)-1], "][")...)
+}
+
+func decodeForm(values url.Values, files map[string][]*multipart.FileHeader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("form: unmarshal to non-pointer %T", v)
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fileKeys := make([]string, 0, len(files))
+	for key := range files {
+		fileKeys = append(fileKeys, key)
+	}
+	sort.Strings(fileKeys)
+	paths := make(map[string][]string, len(keys)+len(fileKeys))
+	for _, key := range append(keys, fileKeys...) {
+		paths[key] = splitFormKey(key)
+	}
+	compactFormIndexes(rv.Type().Elem(), paths)
+	for _, key := range keys {
+		vs := values[key]
+		err := walkFormKey(rv.Elem(), paths[key], func(leaf reflect.Value) error {
+			return setFormStrings(leaf, vs)
+		})
+		if err != nil {
+			return fmt.Errorf("form field %s: %s", key, err)
+		}
+	}
+	for _, key := range fileKeys {
+		fs := files[key]
+		err := walkFormKey(rv.Elem(), paths[key], func(leaf reflect.Value) error {
+			return setFormFiles(leaf, fs)
+		})
+		if err != nil {
+			return fmt.Errorf("form field %s: %s", key, err)
+		}
+	}
+	return nil
+}
+
+// compactFormIndexes replaces slice indexes in key paths of type t with their order among the indexes
+// of the same slice, so slices only grow to the number of submitted keys, like a[1000000]=x decodes to
+// a slice of one element. Other segments and invalid indexes are kept for walkFormKey.
+func compactFormIndexes(t reflect.Type, paths map[string][]string) {
+	type position struct {
+		key   string
+		index int
+	}
+	var positions []position
+	indexes := make(map[string][]int)
+	for key, path := range paths {
+		for _, i := range formIndexPositions(t, path) {
+			n, err := strconv.Atoi(path[i])
+			if err != nil || n < 0 {
+				continue
+			}
+			parent := strings.Join(path[:i], "\x00")
+			indexes[parent] = append(indexes[parent], n)
+			positions = append(positions, position{key, i})
+		}
+	}
+	for parent, ns := range indexes {
+		sort.Ints(ns)
+		distinct := ns[:0]
+		for _, n := range ns {
+			if len(distinct) == 0 || n != distinct[len(distinct)-1] {
+				distinct = append(distinct, n)
+			}
+		}
+		indexes[parent] = distinct
+	}
+	compacted := make(map[string][]string, len(paths))
+	for _, p := range positions {
+		path := paths[p.key]
+		if compacted[p.key] == nil {
+			compacted[p.key] = append([]string{}, path...)
+		}
+		ns := indexes[strings.Join(path[:p.index], "\x00")]
+		n, _ := strconv.Atoi(path[p.index])
+		compacted[p.key][p.index] = strconv.Itoa(sort.SearchInts(ns, n))
+	}
+	for key, path := range compacted {
+		paths[key] = path
+	}
+}
+
+// formIndexPositions returns positions of segments in key path which are slice indexes of type t,
+// following walkFormKey.
+func formIndexPositions(t reflect.Type, path []string) []int {
+	var ret []int
+	for i := 0; i < len(path); i++ {
+		if path[i] == "" {
+			continue
+		}
+		for t.Kind() == reflect.Ptr && t != fileHeaderType {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := formField(reflect.New(t).Elem(), path[i])
+			if !ok {
+				return ret
+			}
+			t = field.Type()
+		case reflect.Map:
+			t = t.Elem()
+		case reflect.Slice:
+			ret = append(ret, i)
+			t = t.Elem()
+		default:
+			return ret
+		}
+	}
+	return ret
+}
+
+// walkFormKey finds the value of key path in v, allocating pointers, maps and slices, and calls set with it.
+func walkFormKey(v reflect.Value, path []string, set func(leaf reflect.Value) error) error {
+	for len(path) > 0 && path[0] == "" {
+		path = path[1:]
+	}
+	if len(path) == 0 {
+		return set(v)
+	}
+	if v.Kind() == reflect.Ptr && v.Type() != fileHeaderType {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return walkFormKey(v.Elem(), path, set)
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		field, ok := formField(v, path[0])
+		if !ok {
+			return nil
+		}
+		return walkFormKey(field, path[1:], set)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.ValueOf(path[0]).Convert(v.Type().Key())
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if old := v.MapIndex(key); old.IsValid() {
+			elem.Set(old)
+		}
+		if err := walkFormKey(elem, path[1:], set); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+		return nil
+	case reflect.Slice:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= 1<<16 {
+			return fmt.Errorf("invalid index %s", path[0])
+		}
+		if i >= v.Len() {
+			v.Set(reflect.AppendSlice(v, reflect.MakeSlice(v.Type(), i+1-v.Len(), i+1-v.Len())))
+		}
+		return walkFormKey(v.Index(i), path[1:], set)
+	}
+	return fmt.Errorf("can't set %s of %s", path[0], v.Type())
+}
+
+// formField returns the field of struct v with form name.
+func formField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i, n := 0, t.NumField(); i < n; i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("form")
+		if tag == "-" {
+			continue
+		}
+		if tag == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if ret, ok := formField(v.Field(i), name); ok {
+				return ret, true
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if tag == "" {
+			tag = field.Name
+		}
+		if tag == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func setFormStrings(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		ret := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setFormString(ret.Index(i), s); err != nil {
+				return err
+			}
+		}
+		v.Set(ret)
+		return nil
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return setFormString(v, values[0])
+}
+
+func setFormString(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setFormString(v.Elem(), s)
+	case reflect.String:
+		v.SetString(s)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+	case reflect.Bool:
+		if s == "" || s == "on" {
+			v.SetBool(s == "on")
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid bool %q", s)
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", v.Type(), s)
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", v.Type(), s)
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", v.Type(), s)
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			v.Set(reflect.ValueOf(s))
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func setFormFiles(v reflect.Value, files []*multipart.FileHeader) error {
+	switch {
+	case v.Type() == fileHeaderType:
+		if len(files) > 0 {
+			v.Set(reflect.ValueOf(files[0]))
+		}
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem() == fileHeaderType:
+		v.Set(reflect.ValueOf(files))
+		return nil
+	}
+	return fmt.Errorf("can't set file to %s", v.Type())
+}
+
+// encodeFormValue encodes v into values with key prefix.
+func encodeFormValue(values url.Values, prefix string, v reflect.Value) error {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	key := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "[" + name + "]"
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i, n := 0, t.NumField(); i < n; i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("form")
+			if tag == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+				if err := encodeFormValue(values, prefix, v.Field(i)); err != nil {
+					return err
+				}
+				continue
+			}
+			if field.PkgPath != "" || tag == "-" {
+				continue
+			}
+			if tag == "" {
+				tag = field.Name
+			}
+			if err := encodeFormValue(values, key(tag), v.Field(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("form: unsupported map key type %s", v.Type().Key())
+		}
+		for _, k := range v.MapKeys() {
+			if err := encodeFormValue(values, key(k.String()), v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		for i, n := 0, v.Len(); i < n; i++ {
+			elem := v.Index(i)
+			for elem.Kind() == reflect.Ptr && !elem.IsNil() {
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Struct || elem.Kind() == reflect.Map {
+				if err := encodeFormValue(values, prefix+"["+strconv.Itoa(i)+"]", elem); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := encodeFormValue(values, prefix, elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if prefix == "" {
+		return fmt.Errorf("form: can't marshal %s without name", v.Type())
+	}
+	if v.Kind() == reflect.Slice {
+		values.Add(prefix, string(v.Bytes()))
+		return nil
+	}
+	values.Add(prefix, fmt.Sprint(v.Interface()))
+	return nil
+}
@@ -0,0 +1,260 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/googollee/go-assert"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type formAddress struct {
+	City string `form:"city"`
+	Zip  int    `form:"zip"`
+}
+
+type formBase struct {
+	ID int `form:"id"`
+}
+
+type formArg struct {
+	formBase
+	Name      string            `form:"name"`
+	Age       *int              `form:"age"`
+	Admin     bool              `form:"admin"`
+	Tags      []string          `form:"tags"`
+	Scores    []float64         `form:"scores"`
+	Address   formAddress       `form:"address"`
+	Addresses []formAddress     `form:"addresses"`
+	Extra     map[string]string `form:"extra"`
+	Ignored   string            `form:"-"`
+	Raw       string
+	private   string
+}
+
+func TestSplitFormKey(t *testing.T) {
+	type Test struct {
+		key  string
+		path []string
+	}
+	var tests = []Test{
+		{"a", []string{"a"}},
+		{"a[b]", []string{"a", "b"}},
+		{"a[b][c]", []string{"a", "b", "c"}},
+		{"a[]", []string{"a", ""}},
+		{"a[0][b]", []string{"a", "0", "b"}},
+		{"[a]", []string{"[a]"}},
+		{"a[b", []string{"a[b"}},
+	}
+	for i, test := range tests {
+		assert.Equal(t, splitFormKey(test.key), test.path, "test %d", i)
+	}
+}
+
+func TestFormMarshallerUnmarshal(t *testing.T) {
+	age := 18
+	type Test struct {
+		form   string
+		ok     bool
+		target formArg
+	}
+	var tests = []Test{
+		{"name=rest&age=18&admin=on&id=1", true, formArg{formBase: formBase{ID: 1}, Name: "rest", Age: &age, Admin: true}},
+		{"tags=a&tags=b&scores[]=1.5&scores[]=2", true, formArg{Tags: []string{"a", "b"}, Scores: []float64{1.5, 2}}},
+		{"address[city]=x&address[zip]=100", true, formArg{Address: formAddress{City: "x", Zip: 100}}},
+		{"addresses[1][city]=y&addresses[0][city]=x&addresses[0][zip]=1", true, formArg{Addresses: []formAddress{{City: "x", Zip: 1}, {City: "y"}}}},
+		{"addresses[1000000][city]=z&addresses[5][city]=y&addresses[5][zip]=5", true, formArg{Addresses: []formAddress{{City: "y", Zip: 5}, {City: "z"}}}},
+		{"extra[a]=1&extra[b]=2", true, formArg{Extra: map[string]string{"a": "1", "b": "2"}}},
+		{"Ignored=x&-=x&Raw=raw&private=x&unknown=x&address[unknown]=x", true, formArg{Raw: "raw"}},
+		{"admin=", true, formArg{}},
+		{"age=abc", false, formArg{}},
+		{"admin=maybe", false, formArg{}},
+		{"addresses[x][city]=y", false, formArg{}},
+		{"name[x]=y", false, formArg{}},
+		{"%zz", false, formArg{}},
+	}
+	for i, test := range tests {
+		var arg formArg
+		err := FormMarshaller{}.Unmarshal(strings.NewReader(test.form), &arg)
+		assert.MustEqual(t, err == nil, test.ok, "test %d: %s", i, err)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, arg, test.target, "test %d", i)
+	}
+
+	values := url.Values{}
+	err := FormMarshaller{}.Unmarshal(strings.NewReader("a=1&a=2"), &values)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, values, url.Values{"a": []string{"1", "2"}})
+}
+
+func TestFormHostileIndex(t *testing.T) {
+	type item struct {
+		B []int `form:"b"`
+	}
+	var arg struct {
+		A []item `form:"a"`
+	}
+	values := url.Values{}
+	for i := 0; i < 100; i++ {
+		values.Set(fmt.Sprintf("a[%d][b][65535]", 65535-i), "1")
+	}
+	values.Set("a[99999999999999999999]", "1")
+	err := FormMarshaller{}.Unmarshal(strings.NewReader(values.Encode()), &arg)
+	assert.NotEqual(t, err, nil)
+
+	values.Del("a[99999999999999999999]")
+	err = FormMarshaller{}.Unmarshal(strings.NewReader(values.Encode()), &arg)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, len(arg.A), 100)
+	for i, a := range arg.A {
+		assert.Equal(t, a.B, []int{1}, "item %d", i)
+	}
+}
+
+func TestFormMarshallerMarshal(t *testing.T) {
+	age := 18
+	type Test struct {
+		v    interface{}
+		ok   bool
+		form string
+	}
+	var tests = []Test{
+		{formArg{Name: "rest", Age: &age, Tags: []string{"a", "b"}}, true, "Raw=&address%5Bcity%5D=&address%5Bzip%5D=0&admin=false&age=18&id=0&name=rest&tags=a&tags=b"},
+		{formArg{Address: formAddress{City: "x"}, Addresses: []formAddress{{Zip: 1}}}, true, "Raw=&address%5Bcity%5D=x&address%5Bzip%5D=0&addresses%5B0%5D%5Bcity%5D=&addresses%5B0%5D%5Bzip%5D=1&admin=false&id=0&name="},
+		{map[string]interface{}{"a": 1, "b": []int{1, 2}}, true, "a=1&b=1&b=2"},
+		{1, false, ""},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		err := FormMarshaller{}.Marshal(&buf, "test", test.v)
+		assert.MustEqual(t, err == nil, test.ok, "test %d", i)
+		assert.Equal(t, buf.String(), test.form, "test %d", i)
+	}
+}
+
+func TestMultipartMarshaller(t *testing.T) {
+	type fileArg struct {
+		Name   string                  `form:"name"`
+		Avatar *multipart.FileHeader   `form:"avatar"`
+		Photos []*multipart.FileHeader `form:"photos"`
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("name", "rest")
+	w, _ := writer.CreateFormFile("avatar", "a.png")
+	w.Write([]byte("avatar data"))
+	w, _ = writer.CreateFormFile("photos", "1.png")
+	w.Write([]byte("1"))
+	w, _ = writer.CreateFormFile("photos", "2.png")
+	w.Write([]byte("2"))
+	writer.Close()
+
+	var arg fileArg
+	err := MultipartMarshaller{}.UnmarshalWithParams(bytes.NewReader(body.Bytes()), map[string]string{"boundary": writer.Boundary()}, &arg)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, arg.Name, "rest")
+	assert.Equal(t, arg.Avatar.Filename, "a.png")
+	f, err := arg.Avatar.Open()
+	assert.MustEqual(t, err, nil)
+	data, err := ioutil.ReadAll(f)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(data), "avatar data")
+	assert.Equal(t, len(arg.Photos), 2)
+
+	err = MultipartMarshaller{}.Unmarshal(bytes.NewReader(body.Bytes()), &arg)
+	assert.NotEqual(t, err, nil)
+	err = MultipartMarshaller{}.Marshal(&body, "test", arg)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestMultipartTempFile(t *testing.T) {
+	var name string
+	f := reflect.ValueOf(func(ctx Context, arg struct {
+		File *multipart.FileHeader `form:"file"`
+	}) int64 {
+		file, err := arg.File.Open()
+		assert.MustEqual(t, err, nil)
+		defer file.Close()
+		osFile, ok := file.(*os.File)
+		assert.MustEqual(t, ok, true)
+		name = osFile.Name()
+		return arg.File.Size
+	})
+	handler := &baseHandler{
+		name:       "Upload",
+		mime:       "application/json",
+		marshaller: jsonMarshaller,
+		inputType:  f.Type().In(1),
+		f:          f,
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	w, _ := writer.CreateFormFile("file", "large.bin")
+	w.Write(bytes.Repeat([]byte("a"), multipartMaxMemory+1))
+	writer.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequest("POST", "http://domain/", &body)
+	assert.MustEqual(t, err, nil)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req, nil)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Body.String(), fmt.Sprintf("%d\n", multipartMaxMemory+1))
+	_, err = os.Stat(name)
+	assert.MustEqual(t, err, nil)
+
+	cancel()
+	for i := 0; i < 100; i++ {
+		if _, err = os.Stat(name); os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, os.IsNotExist(err), true, "temporary file %s isn't removed", name)
+}
+
+func TestFormHandler(t *testing.T) {
+	f := reflect.ValueOf(func(ctx Context, arg formAddress) string {
+		return arg.City
+	})
+	handler := &baseHandler{
+		name:       "CreateHello",
+		mime:       "application/json",
+		marshaller: jsonMarshaller,
+		inputType:  f.Type().In(1),
+		f:          f,
+	}
+
+	req, err := http.NewRequest("POST", "http://domain/", strings.NewReader("city=x&zip=1"))
+	assert.MustEqual(t, err, nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req, nil)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Body.String(), "\"x\"\n")
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("city", "y")
+	writer.Close()
+	req, err = http.NewRequest("POST", "http://domain/", &body)
+	assert.MustEqual(t, err, nil)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req, nil)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Body.String(), "\"y\"\n")
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -47,17 +48,164 @@ func parseHeaderField(req *http.Request, field string) (string, map[string]strin
 	return ret, pair
 }
 
-func getMarshallerFromRequest(mime string, marshaller Marshaller, r *http.Request) (string, Marshaller) {
-	mime, ret := mime, marshaller
+// getRequestMarshaller returns the marshaller to decode request body according to request's Content-Type.
+// If request doesn't have Content-Type, it uses marshaller as default.
+// It returns false if the Content-Type doesn't match any marshaller registered for the request.
+func getRequestMarshaller(marshaller Marshaller, r *http.Request) (Marshaller, bool) {
 	if marshaller == nil {
-		mime, ret = "application/json", jsonMarshaller
+		marshaller = jsonMarshaller
 	}
-	if mimeRequest, _ := parseHeaderField(r, "Content-Type"); mimeRequest != "" {
-		if m, ok := getMarshaller(mimeRequest); ok {
-			mime, ret = mimeRequest, m
+	contentType := r.Header.Get("Content-Type")
+	if base, _ := parseMediaType(contentType); base == "" {
+		return marshaller, true
+	}
+	return lookupMarshaller(r, contentType)
+}
+
+// getResponseMarshaller returns the mime and marshaller to encode response according to request's Accept.
+// If request doesn't have Accept, it uses mime and marshaller as default.
+// Only registered mimes are candidates, and the response Content-Type is always a registered mime.
+// If the most preferred media types in Accept aren't registered, but the default mime is acceptable by a
+// wildcard or a structured suffix, the default is used. So a browser sending
+// "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8" gets the default mime, and
+// application/vnd.api+json gets application/json if it's the default.
+// It returns false if none of marshallers registered for the request is acceptable.
+func getResponseMarshaller(mime string, marshaller Marshaller, r *http.Request) (string, Marshaller, bool) {
+	if marshaller == nil {
+		mime, marshaller = "application/json", jsonMarshaller
+	}
+	accept := strings.Join(r.Header["Accept"], ",")
+	if strings.TrimSpace(accept) == "" {
+		return mime, marshaller, true
+	}
+	ranges := parseAccept(accept)
+	candidates := marshallerMimes(r, mime)
+	if !preferRegistered(ranges, candidates) && acceptDefault(ranges, mime) {
+		return mime, marshaller, true
+	}
+	retMime, ret := "", Marshaller(nil)
+	bestQ, bestSpec, bestIndex := 0.0, -1, 0
+	for _, candidate := range candidates {
+		q, spec, index := matchAccept(ranges, candidate)
+		if q <= 0 {
+			continue
+		}
+		if q < bestQ || (q == bestQ && (spec < bestSpec || (spec == bestSpec && index >= bestIndex))) {
+			continue
+		}
+		bestQ, bestSpec, bestIndex = q, spec, index
+		retMime = candidate
+	}
+	if retMime == "" {
+		return "", nil, false
+	}
+	if retMime == mime {
+		return mime, marshaller, true
+	}
+	ret, _ = lookupMarshaller(r, retMime)
+	return retMime, ret, true
+}
+
+// preferRegistered reports whether a media type with the highest quality in Accept ranges is registered
+// in candidates, or all of them are wildcards.
+func preferRegistered(ranges []acceptRange, candidates []string) bool {
+	bestQ := 0.0
+	for _, ar := range ranges {
+		if ar.q > bestQ {
+			bestQ = ar.q
+		}
+	}
+	specific := false
+	for _, ar := range ranges {
+		if ar.q != bestQ || isWildcardMediaType(ar.mime) {
+			continue
+		}
+		specific = true
+		for _, candidate := range candidates {
+			if base, _ := parseMediaType(candidate); base == ar.mime {
+				return true
+			}
+		}
+	}
+	return !specific
+}
+
+// acceptDefault reports whether Accept ranges accept the default mime, by itself, a wildcard or a structured suffix.
+func acceptDefault(ranges []acceptRange, mime string) bool {
+	if q, spec, _ := matchAccept(ranges, mime); spec >= 0 {
+		return q > 0
+	}
+	base, _ := parseMediaType(mime)
+	for _, ar := range ranges {
+		if ar.q > 0 && !isWildcardMediaType(ar.mime) {
+			if score, _ := matchMediaType(base, ar.mime, ar.params); score == matchSuffix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// acceptRange is a media range with quality and parameters in Accept header.
+type acceptRange struct {
+	mime   string
+	q      float64
+	params map[string]string
+}
+
+func parseAccept(accept string) []acceptRange {
+	var ret []acceptRange
+	for _, field := range strings.Split(accept, ",") {
+		mime, params := parseMediaType(field)
+		if mime == "" {
+			continue
 		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+			delete(params, "q")
+		}
+		ret = append(ret, acceptRange{mime, q, params})
+	}
+	return ret
+}
+
+// matchAccept finds the most specific media range in ranges which matches mime.
+// It returns the quality, the specificity (3 for type/subtype with parameters, 2 for type/subtype, 1 for type/*,
+// 0 for */*) and the index of matched range.
+// A range with parameters matches only if mime has the same parameters.
+// q is 0 if no range matches.
+func matchAccept(ranges []acceptRange, mime string) (q float64, spec int, index int) {
+	spec = -1
+	mime, params := parseMediaType(mime)
+	mimeType := mime
+	if i := strings.Index(mime, "/"); i >= 0 {
+		mimeType = mime[:i]
+	}
+	for i, r := range ranges {
+		s := -1
+		switch {
+		case r.mime == mime && len(r.params) > 0:
+			if hasParams(params, r.params) {
+				s = 3
+			}
+		case r.mime == mime:
+			s = 2
+		case r.mime == mimeType+"/*":
+			s = 1
+		case r.mime == "*/*" || r.mime == "*":
+			s = 0
+		}
+		if s > spec {
+			q, spec, index = r.q, s, i
+		}
+	}
+	if spec < 0 {
+		return 0, spec, 0
 	}
-	return mime, ret
+	return q, spec, index
 }
 
 func unmarshallFromReader(t reflect.Type, marshaller Marshaller, r io.Reader) (reflect.Value, error) {
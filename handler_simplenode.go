@@ -10,6 +10,26 @@ import (
 //  - method: http request method which need be handled.
 //  - route: service's tag prefix add route is http request url path.
 //  - path: path will ignore service's prefix tag, and use as url path.
+//  - compress: "false" disables compressing response according to request's Accept-Encoding,
+//    or a number as the minimum size of response body to compress. Default is 1024.
+//  - etag: if it's "auto", response of GET/HEAD request will use hash of body as ETag,
+//    and answer 304 automatically if request's If-None-Match or If-Modified-Since matches.
+//  - template: the template name passed to a TemplateMarshaller like HTMLMarshaller, default is the handler
+//    method name. Other marshallers are always passed the handler method name.
+//  - buffer: if it's "true", response is buffered until handler returns, so headers can be set after rendering,
+//    Content-Length is set, and marshalling error is answered with 500 instead of a truncated body.
+//  - maxbody: the maximum size of request body like "1MB" or "512KB", answering 413 if body is larger.
+//    It limits Request().Body too, for handlers reading the body directly.
+//    It can be set in service's tag too. Default is no limit.
+// If the handler has an input parameter, an empty request body gives nil to a pointer parameter,
+// and is a bad request for other types.
+// The handler method can return values which will be rendered by framework:
+//  - (): handler process response itself.
+//  - (error): response error if not nil.
+//  - (T) or (T, error): render T as response body if error is nil.
+//  - (int, T, error): like (T, error), and use int as http response code.
+// T of type []byte, io.Reader, io.WriterTo or Raw is written directly as response body, see Raw.
+// If returned error is *Error, it uses Error.Code as response code, otherwise uses 500.
 type SimpleNode struct{}
 
 // CreateHandler will create a set of handlers.
@@ -27,10 +47,15 @@ func (p SimpleNode) CreateHandler(serviceTag reflect.StructTag, fieldTag reflect
 		return "", "", nil, fmt.Errorf("method should NOT be empty")
 	}
 
-	mime := serviceTag.Get("mime")
+	serviceMime := serviceTag.Get("mime")
+	if serviceMime == "" {
+		serviceMime = "application/json"
+	}
+	mime := serviceMime
 	marshaller, ok := getMarshaller(mime)
 	if !ok {
-		mime, marshaller = "application/json", jsonMarshaller
+		mime = "application/json"
+		marshaller, _ = getMarshaller(mime)
 	}
 
 	t := f.Type()
@@ -45,37 +70,201 @@ func (p SimpleNode) CreateHandler(serviceTag reflect.StructTag, fieldTag reflect
 	if t.NumIn() == 2 {
 		p1 = t.In(1)
 	}
+	if err := checkReturns(fname, t); err != nil {
+		return "", "", nil, err
+	}
+
+	compressMinSize, err := parseCompressTag(fieldTag.Get("compress"), defaultCompressMinSize)
+	if err != nil {
+		return "", "", nil, err
+	}
+	autoETag := fieldTag.Get("etag") == "auto"
+	buffered := fieldTag.Get("buffer") == "true"
+	maxBody, err := getMaxBodyTag(serviceTag, fieldTag)
+	if err != nil {
+		return "", "", nil, err
+	}
 
-	return path, method, &baseHandler{fname, mime, marshaller, p1, f}, nil
+	return path, method, &baseHandler{
+		name:            fname,
+		template:        fieldTag.Get("template"),
+		serviceMime:     serviceMime,
+		mime:            mime,
+		marshaller:      marshaller,
+		inputType:       p1,
+		f:               f,
+		compressMinSize: compressMinSize,
+		autoETag:        autoETag,
+		buffered:        buffered,
+		maxBody:         maxBody,
+	}, nil
 }
 
 type baseHandler struct {
-	name       string
-	mime       string
-	marshaller Marshaller
-	inputType  reflect.Type
-	f          reflect.Value
+	name        string
+	template    string
+	serviceMime string // mime in service tag, which may be registered in Rest or service only.
+	mime        string
+	marshaller  Marshaller
+	inputType   reflect.Type
+	f           reflect.Value
+
+	compressMinSize int
+	autoETag        bool
+	buffered        bool
+	maxBody         int64
 }
 
 func (h *baseHandler) Name() string {
 	return h.name
 }
 
+// marshalName returns the name passed to marshaller.
+func (h *baseHandler) marshalName(marshaller Marshaller) string {
+	if h.template != "" && isTemplateMarshaller(marshaller) {
+		return h.template
+	}
+	return h.name
+}
+
 func (h *baseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, vars map[string]string) {
-	mime, marshaller := getMarshallerFromRequest(h.mime, h.marshaller, r)
+	w.Header().Add("Vary", "Accept")
+	if h.compressMinSize >= 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if encoding := getCompressEncoding(r); encoding != "" {
+			cw := newCompressResponseWriter(w, encoding, h.compressMinSize)
+			defer cw.close()
+			w = cw
+		}
+	}
+	if h.autoETag && (r.Method == "GET" || r.Method == "HEAD") {
+		ew := newETagResponseWriter(w)
+		defer ew.finish(r)
+		w = ew
+	}
+	defaultMime, defaultMarshaller := resolveMarshaller(r, h.serviceMime, h.mime, h.marshaller)
+	mime, marshaller, ok := getResponseMarshaller(defaultMime, defaultMarshaller, r)
+	if !ok {
+		ctx := newBaseContext(h.marshalName(defaultMarshaller), defaultMarshaller, "utf-8", vars, r, w)
+		returnError(ctx, http.StatusNotAcceptable, "can't find acceptable mime for %s", r.Header.Get("Accept"))
+		return
+	}
+	mime, marshaller, err := marshallerForRequest(r, mime, marshaller)
+	if err != nil {
+		ctx := newBaseContext(h.marshalName(defaultMarshaller), defaultMarshaller, "utf-8", vars, r, w)
+		returnError(ctx, http.StatusBadRequest, "%s", err)
+		return
+	}
 
-	ctx := newBaseContext(h.name, marshaller, "utf-8", vars, r, w)
-	ctx.Response().Header().Set("Content-Type", mime)
+	charset := ""
+	if !isBinaryMarshaller(marshaller) {
+		charset = getResponseCharset(r)
+	}
+	ctx := newBaseContext(h.marshalName(marshaller), marshaller, charset, vars, r, w)
+	ctx.setContentType(contentType(mime, charset))
+	if m := getSessionManager(r); m != nil {
+		ctx.enableSession(m)
+	}
+	if h.buffered {
+		ctx.enableBuffer()
+		defer ctx.finishBuffer()
+	}
+
+	if err := limitRequestBody(w, r, h.maxBody); err != nil {
+		returnBodyError(ctx, err)
+		return
+	}
 
 	args := []reflect.Value{reflect.ValueOf(ctx)}
 	if h.inputType != nil {
-		arg, err := unmarshallFromReader(h.inputType, marshaller, r.Body)
-		if err != nil {
-			ctx.Return(http.StatusBadRequest, "decode request body error: %s", err)
+		arg, ok := decodeRequestBody(ctx, h.inputType, defaultMarshaller)
+		if !ok {
 			return
 		}
 		args = append(args, arg)
 	}
 
-	h.f.Call(args)
+	rets := h.f.Call(args)
+	if err := ctx.saveSession(); err != nil {
+		returnError(ctx, http.StatusInternalServerError, "save session error: %s", err)
+		return
+	}
+	writeReturns(ctx, rets)
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func checkReturns(fname string, t reflect.Type) error {
+	switch t.NumOut() {
+	case 0, 1:
+	case 2:
+		if t.Out(1) != errorType {
+			return fmt.Errorf("handler method %s's 2nd return value must be error", fname)
+		}
+	case 3:
+		if t.Out(0).Kind() != reflect.Int {
+			return fmt.Errorf("handler method %s's 1st return value must be int", fname)
+		}
+		if t.Out(2) != errorType {
+			return fmt.Errorf("handler method %s's 3rd return value must be error", fname)
+		}
+	default:
+		return fmt.Errorf("handler method %s should have at most 3 return values", fname)
+	}
+	return nil
+}
+
+// writeReturns writes return values of handler to ctx. If rendering fails before anything is written,
+// it's answered with 500.
+func writeReturns(ctx *baseContext, rets []reflect.Value) {
+	code := 0
+	var v reflect.Value
+	var err error
+	switch len(rets) {
+	case 0:
+		return
+	case 1:
+		if rets[0].Type() == errorType {
+			err, _ = rets[0].Interface().(error)
+		} else {
+			v = rets[0]
+		}
+	case 2:
+		v = rets[0]
+		err, _ = rets[1].Interface().(error)
+	case 3:
+		code = int(rets[0].Int())
+		v = rets[1]
+		err, _ = rets[2].Interface().(error)
+	}
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			returnError(ctx, e.Code, "%s", e.Message)
+			return
+		}
+		returnError(ctx, http.StatusInternalServerError, "%s", err)
+		return
+	}
+	if !v.IsValid() || isNilValue(v) {
+		if code != 0 {
+			ctx.Return(code)
+		}
+		return
+	}
+	if code != 0 {
+		err = ctx.RenderStatus(code, v.Interface())
+	} else {
+		err = ctx.Render(v.Interface())
+	}
+	if err != nil && !ctx.answered {
+		returnError(ctx, http.StatusInternalServerError, "marshal response error: %s", err)
+	}
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return v.IsNil()
+	}
+	return false
 }
@@ -42,6 +42,13 @@ func (f *nodeFuncs) CtxIntReturn(ctx Context, i int) int {
 	return i
 }
 
+func (f *nodeFuncs) CtxError(ctx Context) error                          { return nil }
+func (f *nodeFuncs) CtxValueError(ctx Context) (*string, error)          { return nil, nil }
+func (f *nodeFuncs) CtxCodeValueError(ctx Context) (int, string, error)  { return 0, "", nil }
+func (f *nodeFuncs) NoErrorReturn(ctx Context) (int, int)                { return 0, 0 }
+func (f *nodeFuncs) NoCodeReturn(ctx Context) (string, int, error)       { return "", 0, nil }
+func (f *nodeFuncs) MoreReturn(ctx Context) (int, string, string, error) { return 0, "", "", nil }
+
 func (f *nodeFuncs) NoArg()                        {}
 func (f *nodeFuncs) MoreArg(ctx Context, i, j int) {}
 func (f *nodeFuncs) NoContext1(i int)              {}
@@ -62,21 +69,27 @@ func TestSimpleNode(t *testing.T) {
 	}
 	f := new(nodeFuncs)
 	var tests = []Test{
-		{`mime:"application/json"`, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/", "GET", "rest.JSONMarshaller{}", "<nil>"},
-		{`mime:"application/json" prefix:"/prefix"`, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/prefix", "GET", "rest.JSONMarshaller{}", "<nil>"},
-		{`prefix:"/prefix"`, `route:"/route" method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/prefix/route", "GET", "rest.JSONMarshaller{}", "<nil>"},
-		{`prefix:"/prefix"`, `path:"/path" method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/path", "GET", "rest.JSONMarshaller{}", "<nil>"},
-		{``, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/", "GET", "rest.JSONMarshaller{}", "<nil>"},
-		{``, `method:"GET"`, "CtxInt", reflect.ValueOf(f.CtxInt), true, "/", "GET", "rest.JSONMarshaller{}", "int"},
-		{``, `method:"GET"`, "CtxPString", reflect.ValueOf(f.CtxPString), true, "/", "GET", "rest.JSONMarshaller{}", "*string"},
-		{``, `method:"GET"`, "CtxReturn", reflect.ValueOf(f.CtxReturn), true, "/", "GET", "rest.JSONMarshaller{}", "<nil>"},
-		{``, `method:"GET"`, "CtxIntReturn", reflect.ValueOf(f.CtxIntReturn), true, "/", "GET", "rest.JSONMarshaller{}", "int"},
+		{`mime:"application/json"`, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{`mime:"application/json" prefix:"/prefix"`, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/prefix", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{`prefix:"/prefix"`, `route:"/route" method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/prefix/route", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{`prefix:"/prefix"`, `path:"/path" method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/path", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{``, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{``, `method:"GET"`, "CtxInt", reflect.ValueOf(f.CtxInt), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "int"},
+		{``, `method:"GET"`, "CtxPString", reflect.ValueOf(f.CtxPString), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "*string"},
+		{``, `method:"GET"`, "CtxReturn", reflect.ValueOf(f.CtxReturn), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{``, `method:"GET"`, "CtxIntReturn", reflect.ValueOf(f.CtxIntReturn), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "int"},
+		{``, `method:"GET"`, "CtxError", reflect.ValueOf(f.CtxError), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{``, `method:"GET"`, "CtxValueError", reflect.ValueOf(f.CtxValueError), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{``, `method:"GET"`, "CtxCodeValueError", reflect.ValueOf(f.CtxCodeValueError), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
 
 		{``, ``, "NoMethod", reflect.ValueOf(f.Ctx), false, "/", "", "<nil>", "<nil>"},
 		{``, `method:"GET"`, "NoArg", reflect.ValueOf(f.NoArg), false, "/", "", "<nil>", "<nil>"},
 		{``, `method:"GET"`, "MoreArg", reflect.ValueOf(f.MoreArg), false, "/", "", "<nil>", "<nil>"},
 		{``, `method:"GET"`, "NoContext1", reflect.ValueOf(f.NoContext1), false, "/", "", "<nil>", "<nil>"},
 		{``, `method:"GET"`, "NoContext2", reflect.ValueOf(f.NoContext2), false, "/", "", "<nil>", "<nil>"},
+		{``, `method:"GET"`, "NoErrorReturn", reflect.ValueOf(f.NoErrorReturn), false, "/", "", "<nil>", "<nil>"},
+		{``, `method:"GET"`, "NoCodeReturn", reflect.ValueOf(f.NoCodeReturn), false, "/", "", "<nil>", "<nil>"},
+		{``, `method:"GET"`, "MoreReturn", reflect.ValueOf(f.MoreReturn), false, "/", "", "<nil>", "<nil>"},
 	}
 	for i, test := range tests {
 		var p Node
@@ -114,7 +127,8 @@ func TestBaseHandler(t *testing.T) {
 	RegisterMarshaller("fake/mime", fakeMarshaller)
 	str := ""
 	var tests = []Test{
-		{"Ctx", fakeMarshaller, reflect.TypeOf(nil), reflect.ValueOf(f.Ctx), map[string][]string{"Content-Type": []string{"application/json"}}, "", nil, "called ctx", jsonMarshaller},
+		{"Ctx", fakeMarshaller, reflect.TypeOf(nil), reflect.ValueOf(f.Ctx), map[string][]string{"Content-Type": []string{"application/json"}}, "", nil, "called ctx", fakeMarshaller},
+		{"Ctx", fakeMarshaller, reflect.TypeOf(nil), reflect.ValueOf(f.Ctx), map[string][]string{"Accept": []string{"application/json"}}, "", nil, "called ctx", jsonMarshaller},
 		{"Ctx", jsonMarshaller, reflect.TypeOf(nil), reflect.ValueOf(f.Ctx), nil, "", map[string]string{"ab": "cd"}, "called ctx", jsonMarshaller},
 		{"CtxInt", jsonMarshaller, reflect.TypeOf(1), reflect.ValueOf(f.CtxInt), nil, "1", nil, "called ctxInt with 1", jsonMarshaller},
 		{"CtxPString", jsonMarshaller, reflect.TypeOf(&str), reflect.ValueOf(f.CtxPString), nil, `"str"`, nil, "called ctxPString with str", jsonMarshaller},
@@ -164,3 +178,76 @@ func TestBaseHandlerFail(t *testing.T) {
 	handler.ServeHTTP(resp, req, nil)
 	assert.Equal(t, resp.Code, http.StatusBadRequest)
 }
+
+func TestBaseHandlerReturns(t *testing.T) {
+	type Test struct {
+		f reflect.Value
+
+		code int
+		body string
+	}
+	str := "str"
+	var tests = []Test{
+		{reflect.ValueOf(func(ctx Context) {}), http.StatusOK, ""},
+		{reflect.ValueOf(func(ctx Context) error { return nil }), http.StatusOK, ""},
+		{reflect.ValueOf(func(ctx Context) error { return fmt.Errorf("failed") }), http.StatusInternalServerError, "failed\n"},
+		{reflect.ValueOf(func(ctx Context) error { return NewError(http.StatusNotFound, "no %s", "user") }), http.StatusNotFound, "no user\n"},
+		{reflect.ValueOf(func(ctx Context) error { return NewError(http.StatusForbidden) }), http.StatusForbidden, "Forbidden\n"},
+		{reflect.ValueOf(func(ctx Context) int { return 1 }), http.StatusOK, "1\n"},
+		{reflect.ValueOf(func(ctx Context) (*string, error) { return &str, nil }), http.StatusOK, "\"str\"\n"},
+		{reflect.ValueOf(func(ctx Context) (*string, error) { return nil, nil }), http.StatusOK, ""},
+		{reflect.ValueOf(func(ctx Context) (*string, error) { return &str, NewError(http.StatusConflict, "conflict") }), http.StatusConflict, "conflict\n"},
+		{reflect.ValueOf(func(ctx Context) (int, string, error) { return http.StatusCreated, "created", nil }), http.StatusCreated, "\"created\"\n"},
+		{reflect.ValueOf(func(ctx Context) (int, *string, error) { return http.StatusNoContent, nil, nil }), http.StatusNoContent, ""},
+		{reflect.ValueOf(func(ctx Context) (int, string, error) { return http.StatusCreated, "", fmt.Errorf("failed") }), http.StatusInternalServerError, "failed\n"},
+		{reflect.ValueOf(func(ctx Context) chan int { return make(chan int) }), http.StatusInternalServerError, "marshal response error: json: unsupported type: chan int\n"},
+		{reflect.ValueOf(func(ctx Context) (int, func(), error) { return http.StatusCreated, func() {}, nil }), http.StatusInternalServerError, "marshal response error: json: unsupported type: func()\n"},
+		{reflect.ValueOf(func(ctx Context) []interface{} { return []interface{}{1, make(chan int)} }), http.StatusInternalServerError, "marshal response error: json: unsupported type: chan int\n"},
+	}
+	for i, test := range tests {
+		handler := &baseHandler{
+			name:       "Returns",
+			marshaller: jsonMarshaller,
+			f:          test.f,
+		}
+		req, err := http.NewRequest("GET", "http://method", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req, nil)
+		assert.Equal(t, resp.Code, test.code, "test %d", i)
+		assert.Equal(t, resp.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestBaseHandlerNegotiation(t *testing.T) {
+	f := new(nodeFuncs)
+	type Test struct {
+		header http.Header
+
+		code        int
+		contentType string
+	}
+	var tests = []Test{
+		{http.Header{}, http.StatusOK, "application/json; charset=utf-8"},
+		{http.Header{"Accept": []string{"application/json"}}, http.StatusOK, "application/json; charset=utf-8"},
+		{http.Header{"Accept": []string{"text/html"}}, http.StatusNotAcceptable, "text/plain; charset=utf-8"},
+		{http.Header{"Content-Type": []string{"non/exist"}}, http.StatusUnsupportedMediaType, "text/plain; charset=utf-8"},
+	}
+	for i, test := range tests {
+		handler := &baseHandler{
+			name:       "CtxInt",
+			mime:       "application/json",
+			marshaller: jsonMarshaller,
+			inputType:  reflect.TypeOf(1),
+			f:          reflect.ValueOf(f.CtxInt),
+		}
+		req, err := http.NewRequest("GET", "http://method", strings.NewReader("1"))
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header = test.header
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req, nil)
+		assert.Equal(t, resp.Code, test.code, "test %d", i)
+		assert.Equal(t, resp.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		assert.Equal(t, resp.Header().Get("Vary"), "Accept", "test %d", i)
+	}
+}
@@ -0,0 +1,329 @@
+package rest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSEContext is informations when sending server-sent events.
+type SSEContext interface {
+	// StreamContext is the streaming context. Render(v) sends v as an event without name and id.
+	StreamContext
+
+	// Send sends an event with name event and id, whose data is v encoded by the service marshaller.
+	// Empty event or id is omitted.
+	Send(event, id string, v interface{}) error
+
+	// Retry tells the client to reconnect after d when the connection is lost.
+	Retry(d time.Duration) error
+
+	// Comment sends a comment, which is ignored by the client but keeps the connection alive.
+	Comment(text string) error
+
+	// LastEventID returns the id of last event received by the client, sent in Last-Event-ID header
+	// when the client reconnects. It's empty for new client.
+	LastEventID() string
+}
+
+// SSE is node sending server-sent events, as text/event-stream. It's tag has below parameters :
+//  - method: http request method which need be handled, default is GET.
+//  - route: service's tag prefix add route is http request url path.
+//  - path: path will ignore service's prefix tag, and use as url path.
+//  - heartbeat: interval of comment heartbeats like "15s", sent after the first event. Default is no heartbeat.
+//  - maxbody: the maximum size of request body like "1MB", answering 413 if body is larger. It limits
+//    Request().Body too, for handlers reading the body directly.
+//  - hijack: "false" streams with http.Flusher instead of hijacking the connection, like Streaming.
+// Data of events are encoded by the marshaller of service mime, or json if the marshaller is binary,
+// with options of request like "?pretty".
+// Return after the first event ends the stream and reports the error through Hooks.OnError,
+// since it can't be written into the event stream.
+type SSE struct{}
+
+// CreateHandler create server-sent events handler.
+func (p SSE) CreateHandler(serviceTag reflect.StructTag, fieldTag reflect.StructTag, fname string, f reflect.Value) (string, string, Handler, error) {
+	path := fieldTag.Get("path")
+	if path == "" {
+		path = serviceTag.Get("prefix") + fieldTag.Get("route")
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	method := fieldTag.Get("method")
+	if method == "" {
+		method = "GET"
+	}
+
+	serviceMime := serviceTag.Get("mime")
+	if serviceMime == "" {
+		serviceMime = "application/json"
+	}
+	mime := serviceMime
+	marshaller, ok := getMarshaller(mime)
+	if !ok {
+		mime = "application/json"
+		marshaller, _ = getMarshaller(mime)
+	}
+
+	var heartbeat time.Duration
+	if tag := fieldTag.Get("heartbeat"); tag != "" {
+		d, err := time.ParseDuration(tag)
+		if err != nil || d <= 0 {
+			return "", "", nil, fmt.Errorf("invalid heartbeat %q", tag)
+		}
+		heartbeat = d
+	}
+	maxBody, err := getMaxBodyTag(serviceTag, fieldTag)
+	if err != nil {
+		return "", "", nil, err
+	}
+	hijack, err := parseHijackTag(fieldTag.Get("hijack"))
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	t := f.Type()
+	if t.NumIn() != 1 && t.NumIn() != 2 {
+		return "", "", nil, fmt.Errorf("handler method %s should have 1 or 2 input parameters", fname)
+	}
+	if t.NumOut() != 0 {
+		return "", "", nil, fmt.Errorf("handler method %s should not have return parameter", fname)
+	}
+	p0 := t.In(0)
+	if p0.Kind() != reflect.Interface || p0.Name() != "SSEContext" {
+		return "", "", nil, fmt.Errorf("handler method %s's 1st parameter must be rest.SSEContext", fname)
+	}
+	var p1 reflect.Type
+	if t.NumIn() == 2 {
+		p1 = t.In(1)
+	}
+
+	return path, method, &sseHandler{
+		name:        fname,
+		serviceMime: serviceMime,
+		mime:        mime,
+		marshaller:  marshaller,
+		inputType:   p1,
+		f:           f,
+		heartbeat:   heartbeat,
+		maxBody:     maxBody,
+		hijack:      hijack,
+	}, nil
+}
+
+type sseHandler struct {
+	name        string
+	serviceMime string // mime in service tag, which may be registered in Rest or service only.
+	mime        string
+	marshaller  Marshaller
+	inputType   reflect.Type
+	f           reflect.Value
+	heartbeat   time.Duration
+	maxBody     int64
+	hijack      bool
+}
+
+func (h *sseHandler) Name() string {
+	return h.name
+}
+
+func (h *sseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	mime, marshaller := resolveMarshaller(r, h.serviceMime, h.mime, h.marshaller)
+	dataMarshaller := marshaller
+	if isBinaryMarshaller(dataMarshaller) {
+		dataMarshaller = jsonMarshaller
+	}
+	_, dataMarshaller, err := marshallerForRequest(r, mime, dataMarshaller)
+	if err != nil {
+		ctx := newBaseContext(h.name, marshaller, "utf-8", vars, r, w)
+		returnError(ctx, http.StatusBadRequest, "%s", err)
+		return
+	}
+
+	stream, err := openStreamContext(h.name, dataMarshaller, "utf-8", vars, "", r, w, h.hijack)
+	if err != nil {
+		ctx := newBaseContext(h.name, marshaller, "utf-8", vars, r, w)
+		returnError(ctx, http.StatusInternalServerError, "%s", err)
+		return
+	}
+	ctx := newSSEContext(stream, h.heartbeat)
+	defer ctx.close()
+	header := ctx.Response().Header()
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	ctx.setContentType("text/event-stream; charset=utf-8")
+	if m := getSessionManager(r); m != nil {
+		ctx.enableSession(m)
+	}
+
+	if err := limitRequestBody(w, r, h.maxBody); err != nil {
+		returnBodyError(ctx, err)
+		return
+	}
+
+	args := []reflect.Value{reflect.ValueOf(SSEContext(ctx))}
+	if h.inputType != nil {
+		arg, ok := decodeRequestBody(ctx, h.inputType, marshaller)
+		if !ok {
+			return
+		}
+		args = append(args, arg)
+	}
+
+	h.f.Call(args)
+}
+
+// errStreamEnded is returned when sending events after the stream is ended by Return.
+var errStreamEnded = errors.New("stream is ended")
+
+type sseContext struct {
+	*streamContext
+
+	locker    sync.Mutex
+	heartbeat time.Duration
+	started   bool
+	ended     bool
+	quit      chan struct{}
+	done      chan struct{}
+}
+
+func newSSEContext(stream *streamContext, heartbeat time.Duration) *sseContext {
+	return &sseContext{
+		streamContext: stream,
+		heartbeat:     heartbeat,
+	}
+}
+
+func (ctx *sseContext) LastEventID() string {
+	return ctx.request.Header.Get("Last-Event-ID")
+}
+
+func (ctx *sseContext) Send(event, id string, v interface{}) error {
+	if strings.ContainsAny(event, "\r\n") {
+		return fmt.Errorf("invalid event name %q", event)
+	}
+	if strings.ContainsAny(id, "\r\n\x00") {
+		return fmt.Errorf("invalid event id %q", id)
+	}
+	var data bytes.Buffer
+	if err := ctx.marshaller.Marshal(&data, ctx.handlerName, v); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", event)
+	}
+	if id != "" {
+		fmt.Fprintf(&buf, "id: %s\n", id)
+	}
+	lines := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(strings.TrimRight(data.String(), "\r\n"))
+	for _, line := range strings.Split(lines, "\n") {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteString("\n")
+	return ctx.write(buf.Bytes())
+}
+
+func (ctx *sseContext) Retry(d time.Duration) error {
+	return ctx.write([]byte("retry: " + strconv.FormatInt(int64(d/time.Millisecond), 10) + "\n\n"))
+}
+
+func (ctx *sseContext) Comment(text string) error {
+	var buf bytes.Buffer
+	for _, line := range strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text), "\n") {
+		fmt.Fprintf(&buf, ": %s\n", line)
+	}
+	buf.WriteString("\n")
+	return ctx.write(buf.Bytes())
+}
+
+func (ctx *sseContext) Render(v interface{}) error {
+	return ctx.Send("", "", v)
+}
+
+func (ctx *sseContext) RenderStatus(code int, v interface{}) error {
+	ctx.locker.Lock()
+	ctx.Response().WriteHeader(code)
+	ctx.locker.Unlock()
+	return ctx.Render(v)
+}
+
+func (ctx *sseContext) Return(code int, fmtAndArgs ...interface{}) {
+	ctx.locker.Lock()
+	defer ctx.locker.Unlock()
+	if ctx.ended {
+		return
+	}
+	if ctx.hasWriteHeader() {
+		ctx.ended = true
+		reportError(ctx.request, fmt.Errorf("return %d after stream begun: %s", code, formatMessage(code, fmtAndArgs...)))
+		return
+	}
+	ctx.streamContext.Return(code, fmtAndArgs...)
+}
+
+// write writes an event to the client, and starts heartbeats after the first one.
+func (ctx *sseContext) write(p []byte) error {
+	ctx.locker.Lock()
+	defer ctx.locker.Unlock()
+	if ctx.ended {
+		return errStreamEnded
+	}
+	if _, err := ctx.bodyWriter().Write(p); err != nil {
+		return err
+	}
+	if err := ctx.flush(); err != nil {
+		return err
+	}
+	if !ctx.started && ctx.heartbeat > 0 {
+		ctx.started = true
+		ctx.quit = make(chan struct{})
+		ctx.done = make(chan struct{})
+		go ctx.sendHeartbeats()
+	}
+	return nil
+}
+
+func (ctx *sseContext) sendHeartbeats() {
+	defer close(ctx.done)
+	ticker := time.NewTicker(ctx.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.quit:
+			return
+		case <-ticker.C:
+		}
+		ctx.locker.Lock()
+		if ctx.ended {
+			ctx.locker.Unlock()
+			return
+		}
+		_, err := ctx.bodyWriter().Write([]byte(":\n\n"))
+		if err == nil {
+			err = ctx.flush()
+		}
+		ctx.locker.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (ctx *sseContext) close() {
+	if ctx.quit != nil {
+		close(ctx.quit)
+		<-ctx.done
+	}
+	// Events aren't encoded as a stream of StreamMarshaller, writing header avoids beginning an empty one.
+	ctx.Response().WriteHeader(http.StatusOK)
+	ctx.streamContext.close()
+}
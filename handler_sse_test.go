@@ -0,0 +1,190 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/googollee/go-assert"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseFuncs struct{}
+
+func (f *sseFuncs) Ctx(ctx SSEContext)               {}
+func (f *sseFuncs) CtxInt(ctx SSEContext, i int)     {}
+func (f *sseFuncs) NoArg()                           {}
+func (f *sseFuncs) WithReturn(ctx SSEContext) int    { return 1 }
+func (f *sseFuncs) StreamCtx(ctx StreamContext)      {}
+func (f *sseFuncs) MoreArg(ctx SSEContext, i, j int) {}
+func (f *sseFuncs) NoContext(i int)                  {}
+
+func TestSSE(t *testing.T) {
+	type Test struct {
+		serviceTag reflect.StructTag
+		fieldTag   reflect.StructTag
+		fname      string
+		f          reflect.Value
+
+		ok        bool
+		path      string
+		method    string
+		heartbeat time.Duration
+		inputType string
+	}
+	f := new(sseFuncs)
+	var tests = []Test{
+		{``, ``, "Ctx", reflect.ValueOf(f.Ctx), true, "/", "GET", 0, "<nil>"},
+		{`prefix:"/prefix"`, `route:"/route" method:"POST"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/prefix/route", "POST", 0, "<nil>"},
+		{`prefix:"/prefix"`, `path:"/path" heartbeat:"15s"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/path", "GET", 15 * time.Second, "<nil>"},
+		{``, ``, "CtxInt", reflect.ValueOf(f.CtxInt), true, "/", "GET", 0, "int"},
+
+		{``, `heartbeat:"abc"`, "Ctx", reflect.ValueOf(f.Ctx), false, "", "", 0, "<nil>"},
+		{``, `heartbeat:"-1s"`, "Ctx", reflect.ValueOf(f.Ctx), false, "", "", 0, "<nil>"},
+		{``, ``, "NoArg", reflect.ValueOf(f.NoArg), false, "", "", 0, "<nil>"},
+		{``, ``, "WithReturn", reflect.ValueOf(f.WithReturn), false, "", "", 0, "<nil>"},
+		{``, ``, "StreamCtx", reflect.ValueOf(f.StreamCtx), false, "", "", 0, "<nil>"},
+		{``, ``, "MoreArg", reflect.ValueOf(f.MoreArg), false, "", "", 0, "<nil>"},
+		{``, ``, "NoContext", reflect.ValueOf(f.NoContext), false, "", "", 0, "<nil>"},
+	}
+	for i, test := range tests {
+		var p Node
+		p = SSE{}
+		path, method, handler, err := p.CreateHandler(test.serviceTag, test.fieldTag, test.fname, test.f)
+		assert.MustEqual(t, err == nil, test.ok, "test %d: %s", i, err)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, path, test.path, "test %d", i)
+		assert.Equal(t, method, test.method, "test %d", i)
+		ph, ok := handler.(*sseHandler)
+		assert.MustEqual(t, ok, true, "test %d", i)
+		assert.Equal(t, ph.name, test.fname, "test %d", i)
+		assert.Equal(t, ph.heartbeat, test.heartbeat, "test %d", i)
+		assert.Equal(t, fmt.Sprintf("%v", ph.inputType), test.inputType, "test %d", i)
+	}
+}
+
+type sseService struct {
+	Service `prefix:"/sse"`
+	Binary  Service `prefix:"/binary" mime:"application/msgpack"`
+	Text    Service `prefix:"/text" mime:"text/plain"`
+
+	events    SSE `route:"/events"`
+	heartbeat SSE `route:"/heartbeat" heartbeat:"10ms"`
+	invalid   SSE `route:"/invalid"`
+	forbidden SSE `route:"/forbidden"`
+	late      SSE `route:"/late"`
+	echo      SSE `route:"/echo" method:"POST"`
+}
+
+type sseMessage struct {
+	Text string `json:"text"`
+}
+
+func (s *sseService) Events(ctx SSEContext) {
+	ctx.Retry(1500 * time.Millisecond)
+	ctx.Send("message", ctx.LastEventID()+"1", sseMessage{"hello"})
+	ctx.Render("line1\nline2")
+	ctx.Comment("note")
+}
+
+func (s *sseService) Heartbeat(ctx SSEContext) {
+	ctx.Send("", "", 1)
+	time.Sleep(time.Second / 10)
+}
+
+func (s *sseService) Invalid(ctx SSEContext) {
+	ctx.Render(ctx.Send("a\nb", "", 1) != nil)
+	ctx.Render(ctx.Send("", "a\nb", 1) != nil)
+}
+
+func (s *sseService) Forbidden(ctx SSEContext) {
+	ctx.Return(http.StatusForbidden, "forbidden")
+}
+
+func (s *sseService) Late(ctx SSEContext) {
+	ctx.Render(1)
+	ctx.Return(http.StatusInternalServerError, "late")
+	ctx.Render(ctx.Render(2) != nil)
+}
+
+func (s *sseService) Echo(ctx SSEContext, arg string) {
+	ctx.Send("echo", "", arg)
+}
+
+func TestSSEContext(t *testing.T) {
+	r := New()
+	err := r.Add(new(sseService))
+	assert.MustEqual(t, err, nil)
+	errs := make(chan string, 10)
+	r.SetHooks(Hooks{
+		OnError: func(id string, req *http.Request, err error) {
+			errs <- req.URL.Path + ": " + err.Error()
+		},
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	type Test struct {
+		method      string
+		path        string
+		lastEventID string
+		body        string
+		code        int
+		contentType string
+		resp        string
+	}
+	var tests = []Test{
+		{"GET", "/sse/events", "", "", http.StatusOK, "text/event-stream; charset=utf-8",
+			"retry: 1500\n\nevent: message\nid: 1\ndata: {\"text\":\"hello\"}\n\ndata: \"line1\\nline2\"\n\n: note\n\n"},
+		{"GET", "/sse/events", "9", "", http.StatusOK, "text/event-stream; charset=utf-8",
+			"retry: 1500\n\nevent: message\nid: 91\ndata: {\"text\":\"hello\"}\n\ndata: \"line1\\nline2\"\n\n: note\n\n"},
+		{"GET", "/binary/events", "", "", http.StatusOK, "text/event-stream; charset=utf-8",
+			"retry: 1500\n\nevent: message\nid: 1\ndata: {\"text\":\"hello\"}\n\ndata: \"line1\\nline2\"\n\n: note\n\n"},
+		{"GET", "/text/events", "", "", http.StatusOK, "text/event-stream; charset=utf-8",
+			"retry: 1500\n\nevent: message\nid: 1\ndata: {hello}\n\ndata: line1\ndata: line2\n\n: note\n\n"},
+		{"GET", "/sse/invalid", "", "", http.StatusOK, "text/event-stream; charset=utf-8", "data: true\n\ndata: true\n\n"},
+		{"GET", "/sse/events?pretty", "", "", http.StatusOK, "text/event-stream; charset=utf-8",
+			"retry: 1500\n\nevent: message\nid: 1\ndata: {\ndata:   \"text\": \"hello\"\ndata: }\n\ndata: \"line1\\nline2\"\n\n: note\n\n"},
+		{"GET", "/sse/forbidden", "", "", http.StatusForbidden, "text/plain; charset=utf-8", "forbidden\n"},
+		{"GET", "/sse/late", "", "", http.StatusOK, "text/event-stream; charset=utf-8", "data: 1\n\n"},
+		{"POST", "/sse/echo", "", "\"a\"", http.StatusOK, "text/event-stream; charset=utf-8", "event: echo\ndata: \"a\"\n\n"},
+		{"POST", "/sse/echo", "", "{", http.StatusBadRequest, "text/plain; charset=utf-8", ""},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+		assert.MustEqual(t, err, nil, "test %d", i)
+		if test.lastEventID != "" {
+			req.Header.Set("Last-Event-ID", test.lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		buf := bytes.NewBuffer(nil)
+		_, err = buf.ReadFrom(resp.Body)
+		resp.Body.Close()
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, resp.StatusCode, test.code, "test %d", i)
+		assert.Equal(t, resp.Header.Get("Content-Type"), test.contentType, "test %d", i)
+		if test.resp != "" {
+			assert.Equal(t, buf.String(), test.resp, "test %d", i)
+		}
+		if test.code == http.StatusOK {
+			assert.Equal(t, resp.Header.Get("Cache-Control"), "no-cache", "test %d", i)
+		}
+	}
+
+	assert.Equal(t, len(errs), 1)
+	assert.Equal(t, <-errs, "/sse/late: return 500 after stream begun: late")
+
+	resp, err := http.Get(server.URL + "/sse/heartbeat")
+	assert.MustEqual(t, err, nil)
+	buf := bytes.NewBuffer(nil)
+	_, err = buf.ReadFrom(resp.Body)
+	resp.Body.Close()
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, strings.HasPrefix(buf.String(), "data: 1\n\n:\n\n"), true, "body: %q", buf.String())
+}
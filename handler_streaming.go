@@ -26,6 +26,14 @@ type StreamContext interface {
 //  - method: http request method which need be handled.
 //  - route: service's tag prefix add route is http request url path.
 //  - path: path will ignore service's prefix tag, and use as url path.
+//  - end: string written after each rendered message, ignored if the marshaller is a StreamMarshaller.
+//  - compress: "true" enables compressing response according to request's Accept-Encoding,
+//    or a number as the minimum size of response body to compress. Default is no compression.
+//    Compressed data is flushed after each rendered message.
+//  - maxbody: the maximum size of request body like "1MB", answering 413 if body is larger. It limits
+//    Request().Body too, for handlers reading the body directly.
+//  - hijack: "false" streams with http.Flusher instead of hijacking the connection.
+//    It's used automatically for HTTP/2, or if the webserver doesn't support hijacking.
 type Streaming struct{}
 
 // CreateHandler create streaming handler.
@@ -43,13 +51,33 @@ func (p Streaming) CreateHandler(serviceTag reflect.StructTag, fieldTag reflect.
 		return "", "", nil, fmt.Errorf("method should NOT be empty")
 	}
 
-	mime := serviceTag.Get("mime")
+	serviceMime := serviceTag.Get("mime")
+	if serviceMime == "" {
+		serviceMime = "application/json"
+	}
+	mime := serviceMime
 	marshaller, ok := getMarshaller(mime)
 	if !ok {
-		mime, marshaller = "application/json", jsonMarshaller
+		mime = "application/json"
+		marshaller, _ = getMarshaller(mime)
 	}
 
 	endline := fieldTag.Get("end")
+	compressMinSize := -1
+	if tag := fieldTag.Get("compress"); tag != "" {
+		var err error
+		if compressMinSize, err = parseCompressTag(tag, 0); err != nil {
+			return "", "", nil, err
+		}
+	}
+	maxBody, err := getMaxBodyTag(serviceTag, fieldTag)
+	if err != nil {
+		return "", "", nil, err
+	}
+	hijack, err := parseHijackTag(fieldTag.Get("hijack"))
+	if err != nil {
+		return "", "", nil, err
+	}
 
 	t := f.Type()
 	if t.NumIn() != 1 && t.NumIn() != 2 {
@@ -67,16 +95,43 @@ func (p Streaming) CreateHandler(serviceTag reflect.StructTag, fieldTag reflect.
 		p1 = t.In(1)
 	}
 
-	return path, method, &streamHandler{fname, endline, mime, marshaller, p1, f}, nil
+	return path, method, &streamHandler{
+		name:            fname,
+		endline:         endline,
+		serviceMime:     serviceMime,
+		mime:            mime,
+		marshaller:      marshaller,
+		inputType:       p1,
+		f:               f,
+		compressMinSize: compressMinSize,
+		maxBody:         maxBody,
+		hijack:          hijack,
+	}, nil
+}
+
+// parseHijackTag parses hijack tag, which is true if empty.
+func parseHijackTag(tag string) (bool, error) {
+	switch tag {
+	case "", "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid hijack tag %q", tag)
 }
 
 type streamHandler struct {
-	name       string
-	endline    string
-	mime       string
-	marshaller Marshaller
-	inputType  reflect.Type
-	f          reflect.Value
+	name        string
+	endline     string
+	serviceMime string // mime in service tag, which may be registered in Rest or service only.
+	mime        string
+	marshaller  Marshaller
+	inputType   reflect.Type
+	f           reflect.Value
+
+	compressMinSize int
+	maxBody         int64
+	hijack          bool
 }
 
 func (h *streamHandler) Name() string {
@@ -84,22 +139,53 @@ func (h *streamHandler) Name() string {
 }
 
 func (h *streamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, vars map[string]string) {
-	mime, marshaller := getMarshallerFromRequest(h.mime, h.marshaller, r)
+	defaultMime, defaultMarshaller := resolveMarshaller(r, h.serviceMime, h.mime, h.marshaller)
+	mime, marshaller, ok := getResponseMarshaller(defaultMime, defaultMarshaller, r)
+	if !ok {
+		w.Header().Add("Vary", "Accept")
+		ctx := newBaseContext(h.name, defaultMarshaller, "utf-8", vars, r, w)
+		returnError(ctx, http.StatusNotAcceptable, "can't find acceptable mime for %s", r.Header.Get("Accept"))
+		return
+	}
+	mime, marshaller, err := marshallerForRequest(r, mime, marshaller)
+	if err != nil {
+		ctx := newBaseContext(h.name, defaultMarshaller, "utf-8", vars, r, w)
+		returnError(ctx, http.StatusBadRequest, "%s", err)
+		return
+	}
 
-	ctx, err := newStreamContext(h.name, marshaller, "utf-8", vars, h.endline, r, w)
+	charset := ""
+	if !isBinaryMarshaller(marshaller) {
+		charset = getResponseCharset(r)
+	}
+	ctx, err := openStreamContext(h.name, marshaller, charset, vars, h.endline, r, w, h.hijack)
 	if err != nil {
 		ctx := newBaseContext(h.name, marshaller, "utf-8", vars, r, w)
-		ctx.Return(http.StatusInternalServerError, "%s", err)
+		returnError(ctx, http.StatusInternalServerError, "%s", err)
 		return
 	}
 	defer ctx.close()
-	ctx.Response().Header().Set("Content-Type", mime)
+	ctx.Response().Header().Add("Vary", "Accept")
+	if h.compressMinSize >= 0 {
+		ctx.Response().Header().Add("Vary", "Accept-Encoding")
+		if encoding := getCompressEncoding(r); encoding != "" {
+			ctx.setCompress(encoding, h.compressMinSize)
+		}
+	}
+	ctx.setContentType(contentType(mime, charset))
+	if m := getSessionManager(r); m != nil {
+		ctx.enableSession(m)
+	}
+
+	if err := limitRequestBody(w, r, h.maxBody); err != nil {
+		returnBodyError(ctx, err)
+		return
+	}
 
 	args := []reflect.Value{reflect.ValueOf(ctx)}
 	if h.inputType != nil {
-		arg, err := unmarshallFromReader(h.inputType, marshaller, r.Body)
-		if err != nil {
-			ctx.Return(http.StatusBadRequest, "decode request body error: %s", err)
+		arg, ok := decodeRequestBody(ctx, h.inputType, defaultMarshaller)
+		if !ok {
 			return
 		}
 		args = append(args, arg)
@@ -111,6 +197,7 @@ func (h *streamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, vars m
 type streamResponseWriter struct {
 	header         http.Header
 	hasWriteHeader bool
+	code           int
 	writer         io.Writer
 }
 
@@ -139,6 +226,7 @@ func (w *streamResponseWriter) WriteHeader(code int) {
 	}
 	w.writer.Write([]byte("\r\n"))
 	w.hasWriteHeader = true
+	w.code = code
 }
 
 func (w *streamResponseWriter) Write(p []byte) (int, error) {
@@ -146,12 +234,98 @@ func (w *streamResponseWriter) Write(p []byte) (int, error) {
 	return w.writer.Write(p)
 }
 
+// flushResponseWriter is the response of streaming without hijacking, flushing with http.Flusher.
+type flushResponseWriter struct {
+	http.ResponseWriter
+	flusher        http.Flusher
+	hasWriteHeader bool
+}
+
+func (w *flushResponseWriter) WriteHeader(code int) {
+	if w.hasWriteHeader {
+		return
+	}
+	w.hasWriteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *flushResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *flushResponseWriter) Flush() {
+	w.flusher.Flush()
+}
+
+// canFlush reports whether response w can flush. A writer with Unwrap, like the one wrapped by Rest,
+// flushes the one it wraps, so it's unwrapped to check the original one.
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		rw, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = rw.Unwrap()
+	}
+	_, ok := w.(http.Flusher)
+	return ok
+}
+
+// setWriteDeadline sets write deadline of response w, unwrapping w until one supports it.
+func setWriteDeadline(w http.ResponseWriter, t time.Time) error {
+	for {
+		switch rw := w.(type) {
+		case interface{ SetWriteDeadline(time.Time) error }:
+			return rw.SetWriteDeadline(t)
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return fmt.Errorf("webserver doesn't support write deadline")
+		}
+	}
+}
+
+// streamContext is context of streaming, on a hijacked connection, or with flusher if conn is nil.
 type streamContext struct {
 	*baseContext
 
-	endLine string
-	conn    net.Conn
-	bufrw   *bufio.ReadWriter
+	endLine    string
+	conn       net.Conn
+	bufrw      *bufio.ReadWriter
+	stream     *streamResponseWriter
+	flusher    *flushResponseWriter
+	compressor *compressResponseWriter
+	encoder    StreamEncoder
+	ended      bool
+}
+
+// openStreamContext creates streamContext on hijacked connection if hijack is true and the request is HTTP/1,
+// otherwise or if hijacking fails, with flusher.
+func openStreamContext(handlerName string, marshaller Marshaller, charset string, vars map[string]string, endLine string, req *http.Request, resp http.ResponseWriter, hijack bool) (*streamContext, error) {
+	if hijack && req.ProtoMajor == 1 {
+		if ctx, err := newStreamContext(handlerName, marshaller, charset, vars, endLine, req, resp); err == nil {
+			return ctx, nil
+		}
+	}
+	return newFlushStreamContext(handlerName, marshaller, charset, vars, endLine, req, resp)
+}
+
+func newFlushStreamContext(handlerName string, marshaller Marshaller, charset string, vars map[string]string, endLine string, req *http.Request, resp http.ResponseWriter) (*streamContext, error) {
+	f, ok := resp.(http.Flusher)
+	if !ok || !canFlush(resp) {
+		return nil, fmt.Errorf("webserver doesn't support hijacking or flushing")
+	}
+	flusher := &flushResponseWriter{
+		ResponseWriter: resp,
+		flusher:        f,
+	}
+	baseContext := newBaseContext(handlerName, marshaller, charset, vars, req, flusher)
+	return &streamContext{
+		baseContext: baseContext,
+		endLine:     endLine,
+		flusher:     flusher,
+	}, nil
 }
 
 func newStreamContext(handlerName string, marshaller Marshaller, charset string, vars map[string]string, endLine string, req *http.Request, resp http.ResponseWriter) (*streamContext, error) {
@@ -163,41 +337,137 @@ func newStreamContext(handlerName string, marshaller Marshaller, charset string,
 	if err != nil {
 		return nil, err
 	}
-	resp = newStreamResponseWriter(bufrw)
-	baseContext := newBaseContext(handlerName, marshaller, charset, vars, req, resp)
+	stream := newStreamResponseWriter(bufrw)
+	if id := RequestID(req); id != "" {
+		stream.Header().Set(requestIDHeader, id)
+	}
+	baseContext := newBaseContext(handlerName, marshaller, charset, vars, req, stream)
 	return &streamContext{
 		baseContext: baseContext,
 		endLine:     endLine,
 		conn:        conn,
 		bufrw:       bufrw,
+		stream:      stream,
 	}, nil
 }
 
+// setCompress compresses the response with encoding.
+func (ctx *streamContext) setCompress(encoding string, minSize int) {
+	ctx.compressor = newCompressResponseWriter(ctx.response, encoding, minSize)
+	ctx.response = ctx.compressor
+}
+
 func (ctx *streamContext) Return(code int, fmtAndArgs ...interface{}) {
+	if ctx.encoder != nil {
+		// The error can't be written into a begun stream without breaking its format,
+		// so end the stream and report the error through hooks.
+		if err := ctx.endStream(); err != nil {
+			reportError(ctx.request, fmt.Errorf("end stream error: %s", err))
+		}
+		reportError(ctx.request, fmt.Errorf("return %d after stream begun: %s", code, formatMessage(code, fmtAndArgs...)))
+		ctx.flush()
+		return
+	}
 	ctx.baseContext.Return(code, fmtAndArgs...)
-	ctx.bufrw.Flush()
+	ctx.flush()
 }
 
 func (ctx *streamContext) Render(v interface{}) error {
-	if err := ctx.baseContext.Render(v); err != nil {
+	if err := ctx.encode(v); err != nil {
 		return err
 	}
-	if len(ctx.endLine) > 0 {
-		if _, err := ctx.bufrw.Write([]byte(ctx.endLine)); err != nil {
+	if err := ctx.flush(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// encode writes message v, with the stream encoder if the marshaller is a StreamMarshaller.
+func (ctx *streamContext) encode(v interface{}) error {
+	_, isRaw := rawBody(v)
+	m, ok := ctx.marshaller.(StreamMarshaller)
+	if !ok || isRaw {
+		if err := ctx.baseContext.Render(v); err != nil {
 			return err
 		}
+		if len(ctx.endLine) > 0 {
+			if _, err := ctx.bodyWriter().Write([]byte(ctx.endLine)); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	if err := ctx.bufrw.Flush(); err != nil {
-		return err
+	if ctx.encoder == nil {
+		encoder, err := m.Begin(ctx.bodyWriter(), ctx.handlerName)
+		if err != nil {
+			return err
+		}
+		ctx.encoder = encoder
 	}
-	return nil
+	return ctx.encoder.Encode(v)
+}
+
+// endStream finishes the stream of StreamMarshaller once. A stream is begun if nothing has been written,
+// so an empty stream is still well-formed, like [] of JSONArrayMarshaller.
+func (ctx *streamContext) endStream() error {
+	m, ok := ctx.marshaller.(StreamMarshaller)
+	if !ok || ctx.ended {
+		return nil
+	}
+	ctx.ended = true
+	if ctx.encoder == nil && !ctx.hasWriteHeader() {
+		encoder, err := m.Begin(ctx.bodyWriter(), ctx.handlerName)
+		if err != nil {
+			return err
+		}
+		ctx.encoder = encoder
+	}
+	if ctx.encoder == nil {
+		return nil
+	}
+	return ctx.encoder.End()
+}
+
+func (ctx *streamContext) RenderStatus(code int, v interface{}) error {
+	if raw, ok := rawBody(v); ok {
+		setRawContentType(ctx.response.Header(), raw, ctx.contentType)
+	}
+	ctx.Response().WriteHeader(code)
+	return ctx.Render(v)
+}
+
+// hasWriteHeader reports whether the header of response has been written.
+func (ctx *streamContext) hasWriteHeader() bool {
+	if ctx.conn == nil {
+		return ctx.flusher.hasWriteHeader
+	}
+	return ctx.stream.hasWriteHeader
+}
+
+func (ctx *streamContext) flush() error {
+	if ctx.compressor != nil {
+		ctx.compressor.Flush()
+	}
+	if ctx.conn == nil {
+		ctx.flusher.Flush()
+		return ctx.request.Context().Err()
+	}
+	return ctx.bufrw.Flush()
 }
 
 func (ctx *streamContext) SetWriteDeadline(t time.Time) error {
+	if ctx.conn == nil {
+		return setWriteDeadline(ctx.flusher.ResponseWriter, t)
+	}
 	return ctx.conn.SetWriteDeadline(t)
 }
 
+// Ping checks the connection by reading it if hijacked, otherwise by the context of request,
+// which is canceled when the client disconnects.
 func (ctx *streamContext) Ping() error {
+	if ctx.conn == nil {
+		return ctx.request.Context().Err()
+	}
 	ctx.conn.SetReadDeadline(time.Now().Add(time.Second / 100))
 	p := make([]byte, 1)
 	_, err := ctx.conn.Read(p)
@@ -211,7 +481,21 @@ func (ctx *streamContext) Ping() error {
 }
 
 func (ctx *streamContext) close() {
+	if err := ctx.saveSession(); err != nil {
+		reportError(ctx.Request(), fmt.Errorf("save session error: %s", err))
+	}
+	if err := ctx.endStream(); err != nil {
+		reportError(ctx.Request(), fmt.Errorf("end stream error: %s", err))
+	}
 	ctx.Response().WriteHeader(http.StatusOK)
+	if ctx.compressor != nil {
+		ctx.compressor.close()
+	}
+	if ctx.conn == nil {
+		ctx.flusher.Flush()
+		return
+	}
 	ctx.bufrw.Flush()
 	ctx.conn.Close()
+	setResponseCode(ctx.request, ctx.stream.code)
 }
@@ -54,13 +54,14 @@ func TestStream(t *testing.T) {
 	}
 	f := new(streamFuncs)
 	var tests = []Test{
-		{`mime:"application/json"`, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/", "GET", "rest.JSONMarshaller{}", "<nil>"},
-		{`mime:"application/json" prefix:"/prefix"`, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/prefix", "GET", "rest.JSONMarshaller{}", "<nil>"},
-		{`prefix:"/prefix"`, `route:"/route" method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/prefix/route", "GET", "rest.JSONMarshaller{}", "<nil>"},
-		{`prefix:"/prefix"`, `path:"/path" method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/path", "GET", "rest.JSONMarshaller{}", "<nil>"},
-		{``, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/", "GET", "rest.JSONMarshaller{}", "<nil>"},
-		{``, `method:"GET"`, "CtxInt", reflect.ValueOf(f.CtxInt), true, "/", "GET", "rest.JSONMarshaller{}", "int"},
-		{``, `method:"GET"`, "CtxPString", reflect.ValueOf(f.CtxPString), true, "/", "GET", "rest.JSONMarshaller{}", "*string"},
+		{`mime:"application/json"`, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{`mime:"application/json" prefix:"/prefix"`, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/prefix", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{`prefix:"/prefix"`, `route:"/route" method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/prefix/route", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{`prefix:"/prefix"`, `path:"/path" method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/path", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{``, `method:"GET"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
+		{``, `method:"GET"`, "CtxInt", reflect.ValueOf(f.CtxInt), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "int"},
+		{``, `method:"GET"`, "CtxPString", reflect.ValueOf(f.CtxPString), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "*string"},
+		{``, `method:"GET" hijack:"false"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/", "GET", `rest.JSONMarshaller{Indent:"", NoEscapeHTML:false, Callback:"", Naming:0, jsonp:""}`, "<nil>"},
 
 		{``, ``, "NoMethod", reflect.ValueOf(f.Ctx), false, "/", "", "<nil>", "<nil>"},
 		{``, `method:"GET"`, "NoArg", reflect.ValueOf(f.NoArg), false, "/", "", "<nil>", "<nil>"},
@@ -69,6 +70,7 @@ func TestStream(t *testing.T) {
 		{``, `method:"GET"`, "MoreArg", reflect.ValueOf(f.MoreArg), false, "/", "", "<nil>", "<nil>"},
 		{``, `method:"GET"`, "NoContext1", reflect.ValueOf(f.NoContext1), false, "/", "", "<nil>", "<nil>"},
 		{``, `method:"GET"`, "NoContext2", reflect.ValueOf(f.NoContext2), false, "/", "", "<nil>", "<nil>"},
+		{``, `method:"GET" hijack:"no"`, "Ctx", reflect.ValueOf(f.Ctx), false, "/", "", "<nil>", "<nil>"},
 	}
 	for i, test := range tests {
 		var p Node
@@ -115,7 +117,8 @@ func TestStreamHandler(t *testing.T) {
 	RegisterMarshaller("fake/mime", fakeMarshaller)
 	str := ""
 	var tests = []Test{
-		{"Ctx", fakeMarshaller, reflect.TypeOf(nil), reflect.ValueOf(f.Ctx), map[string][]string{"Content-Type": []string{"application/json"}}, "", nil, "called ctx", jsonMarshaller},
+		{"Ctx", fakeMarshaller, reflect.TypeOf(nil), reflect.ValueOf(f.Ctx), map[string][]string{"Content-Type": []string{"application/json"}}, "", nil, "called ctx", fakeMarshaller},
+		{"Ctx", fakeMarshaller, reflect.TypeOf(nil), reflect.ValueOf(f.Ctx), map[string][]string{"Accept": []string{"application/json"}}, "", nil, "called ctx", jsonMarshaller},
 		{"Ctx", jsonMarshaller, reflect.TypeOf(nil), reflect.ValueOf(f.Ctx), nil, "", map[string]string{"ab": "cd"}, "called ctx", jsonMarshaller},
 		{"CtxInt", jsonMarshaller, reflect.TypeOf(1), reflect.ValueOf(f.CtxInt), nil, "1", nil, "called ctxInt with 1", jsonMarshaller},
 		{"CtxPString", jsonMarshaller, reflect.TypeOf(&str), reflect.ValueOf(f.CtxPString), nil, `"str"`, nil, "called ctxPString with str", jsonMarshaller},
@@ -158,9 +161,51 @@ func TestStreamHandlerHijackFailed(t *testing.T) {
 	}
 	req, err := http.NewRequest("GET", "http://domain/path", nil)
 	assert.MustEqual(t, err, nil)
+
 	resp := httptest.NewRecorder()
 	handler.ServeHTTP(resp, req, nil)
-	assert.Equal(t, resp.Code, http.StatusInternalServerError)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Flushed, true)
+
+	noFlush := noFlushResponseWriter{httptest.NewRecorder()}
+	handler.ServeHTTP(noFlush, req, nil)
+	assert.Equal(t, noFlush.recorder.Code, http.StatusInternalServerError)
+
+	r := New()
+	err = r.Add(new(http2StreamService))
+	assert.MustEqual(t, err, nil)
+	for i, path := range []string{"/stream/hijack", "/stream/nohijack"} {
+		req, err := http.NewRequest("GET", "http://domain"+path, nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusOK, "test %d", i)
+		assert.Equal(t, resp.Flushed, true, "test %d", i)
+		assert.Equal(t, resp.Body.String(), "\"HTTP/1.1\"\n2\n", "test %d", i)
+
+		noFlush := noFlushResponseWriter{httptest.NewRecorder()}
+		r.ServeHTTP(noFlush, req)
+		assert.Equal(t, noFlush.recorder.Code, http.StatusInternalServerError, "test %d", i)
+		assert.Equal(t, strings.HasPrefix(noFlush.recorder.Body.String(), "webserver doesn't support hijacking or flushing"), true, "test %d", i)
+	}
+}
+
+// noFlushResponseWriter is a response writer which can't hijack or flush.
+type noFlushResponseWriter struct {
+	recorder *httptest.ResponseRecorder
+}
+
+func (w noFlushResponseWriter) Header() http.Header {
+	return w.recorder.Header()
+}
+
+func (w noFlushResponseWriter) Write(p []byte) (int, error) {
+	return w.recorder.Write(p)
+}
+
+func (w noFlushResponseWriter) WriteHeader(code int) {
+	w.recorder.WriteHeader(code)
 }
 
 func TestStreamHandlerUnmarshallFailed(t *testing.T) {
@@ -318,6 +363,116 @@ func TestStreamContext(t *testing.T) {
 	<-p
 }
 
+type FakeFlushStreamHandler struct {
+	t *testing.T
+	p chan int
+	r chan int
+}
+
+func (h *FakeFlushStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, err := newFlushStreamContext("context", jsonMarshaller, "utf-8", nil, "\nend\n", r, w)
+	assert.MustEqual(h.t, err, nil)
+	defer ctx.close()
+
+	_, ok := ctx.Response().(*flushResponseWriter)
+	assert.MustEqual(h.t, ok, true)
+	ctx.Return(http.StatusOK, "with resp %d", http.StatusOK)
+	h.p <- 1
+	<-h.r
+	assert.Equal(h.t, ctx.Ping(), nil)
+	assert.Equal(h.t, ctx.SetWriteDeadline(time.Now().Add(time.Second)), nil)
+	assert.Equal(h.t, ctx.Render(1), nil)
+	h.p <- 1
+	<-h.r
+	select {
+	case <-r.Context().Done():
+	case <-time.After(time.Second):
+	}
+	assert.NotEqual(h.t, ctx.Ping(), nil)
+	assert.NotEqual(h.t, ctx.Render(2), nil)
+	h.p <- 1
+}
+
+func TestFlushStreamContext(t *testing.T) {
+	p, r := make(chan int), make(chan int)
+	server := httptest.NewServer(&FakeFlushStreamHandler{t, p, r})
+	defer server.Close()
+	req, err := http.NewRequest("GET", server.URL, nil)
+	assert.MustEqual(t, err, nil)
+	resp, err := http.DefaultClient.Do(req)
+	<-p
+	assert.MustEqual(t, err, nil, "error: %s", err)
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+	r <- 1
+	<-p
+	b := make([]byte, 1024)
+	n, err := resp.Body.Read(b[:])
+	assert.MustEqual(t, err, nil, "error: %s", err)
+	assert.Equal(t, string(b[:n]), "with resp 200\n")
+	n, err = resp.Body.Read(b[:])
+	assert.MustEqual(t, err, nil, "error: %s", err)
+	assert.Equal(t, string(b[:n]), "1\n\nend\n")
+	resp.Body.Close()
+	r <- 1
+	<-p
+}
+
+type http2StreamService struct {
+	Service `prefix:"/stream"`
+
+	hijack   Streaming `route:"/hijack" method:"GET"`
+	noHijack Streaming `route:"/nohijack" method:"GET" hijack:"false"`
+}
+
+func (s *http2StreamService) Hijack(ctx StreamContext) {
+	ctx.Render(ctx.Request().Proto)
+	ctx.Render(2)
+}
+
+func (s *http2StreamService) NoHijack(ctx StreamContext) {
+	s.Hijack(ctx)
+}
+
+func TestStreamWithoutHijack(t *testing.T) {
+	r := New()
+	err := r.Add(new(http2StreamService))
+	assert.MustEqual(t, err, nil)
+
+	http1 := httptest.NewServer(r)
+	defer http1.Close()
+	http2 := httptest.NewUnstartedServer(r)
+	http2.EnableHTTP2 = true
+	http2.StartTLS()
+	defer http2.Close()
+
+	type Test struct {
+		server *httptest.Server
+		path   string
+		proto  string
+		chunk  bool
+	}
+	var tests = []Test{
+		{http1, "/stream/hijack", "HTTP/1.1", false},
+		{http1, "/stream/nohijack", "HTTP/1.1", true},
+		{http2, "/stream/hijack", "HTTP/2.0", false},
+		{http2, "/stream/nohijack", "HTTP/2.0", false},
+	}
+	for i, test := range tests {
+		resp, err := test.server.Client().Get(test.server.URL + test.path)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		buf := bytes.NewBuffer(nil)
+		_, err = buf.ReadFrom(resp.Body)
+		resp.Body.Close()
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, resp.StatusCode, http.StatusOK, "test %d", i)
+		assert.Equal(t, resp.Proto, test.proto, "test %d", i)
+		assert.Equal(t, len(resp.TransferEncoding) > 0, test.chunk, "test %d", i)
+		assert.Equal(t, resp.Header.Get("Content-Type"), "application/json; charset=utf-8", "test %d", i)
+		assert.NotEqual(t, resp.Header.Get(requestIDHeader), "", "test %d", i)
+		assert.Equal(t, buf.String(), fmt.Sprintf("%q\n2\n", test.proto), "test %d", i)
+	}
+}
+
 func TestStreamHandlerFail(t *testing.T) {
 	failMarshaller := FailMarshaller{}
 	RegisterMarshaller("fail/mime", failMarshaller)
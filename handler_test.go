@@ -52,27 +52,74 @@ func TestParseHeaderField(t *testing.T) {
 	}
 }
 
-func TestGetMarshallerFromRequest(t *testing.T) {
+func TestGetRequestMarshaller(t *testing.T) {
+	fakeMarshaller := FakeMarshaller{}
+	RegisterMarshaller("fake/mime", fakeMarshaller)
+	type Test struct {
+		marshaller       Marshaller
+		header           http.Header
+		ok               bool
+		targetMarshaller Marshaller
+	}
+	var tests = []Test{
+		{nil, nil, true, jsonMarshaller},
+		{fakeMarshaller, nil, true, fakeMarshaller},
+		{fakeMarshaller, http.Header{"Content-Type": []string{"application/json"}}, true, jsonMarshaller},
+		{fakeMarshaller, http.Header{"Content-Type": []string{"Application/JSON; charset=utf-8"}}, true, jsonMarshaller},
+		{jsonMarshaller, http.Header{"Content-Type": []string{"fake/mime"}}, true, fakeMarshaller},
+		{jsonMarshaller, http.Header{"Content-Type": []string{"non/exist"}}, false, nil},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain/", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header = test.header
+		marshaller, ok := getRequestMarshaller(test.marshaller, req)
+		assert.MustEqual(t, ok, test.ok, "test %d", i)
+		assert.Equal(t, marshaller, test.targetMarshaller, "test %d", i)
+	}
+}
+
+func TestGetResponseMarshaller(t *testing.T) {
 	fakeMarshaller := FakeMarshaller{}
 	RegisterMarshaller("fake/mime", fakeMarshaller)
 	type Test struct {
 		mime             string
 		marshaller       Marshaller
 		header           http.Header
+		ok               bool
 		targetMime       string
 		targetMarshaller Marshaller
 	}
 	var tests = []Test{
-		{"", nil, nil, "application/json", jsonMarshaller},
-		{"fake/mime", fakeMarshaller, nil, "fake/mime", fakeMarshaller},
-		{"fake/mime", fakeMarshaller, map[string][]string{"Content-Type": []string{"application/json"}}, "application/json", jsonMarshaller},
-		{"fake/mime", fakeMarshaller, map[string][]string{"Content-Type": []string{"application/json; charset=utf-8"}}, "application/json", jsonMarshaller},
+		{"", nil, nil, true, "application/json", jsonMarshaller},
+		{"fake/mime", fakeMarshaller, nil, true, "fake/mime", fakeMarshaller},
+		{"fake/mime", fakeMarshaller, http.Header{"Content-Type": []string{"application/json"}}, true, "fake/mime", fakeMarshaller},
+		{"fake/mime", fakeMarshaller, http.Header{"Accept": []string{"application/json"}}, true, "application/json", jsonMarshaller},
+		{"fake/mime", fakeMarshaller, http.Header{"Accept": []string{"*/*"}}, true, "fake/mime", fakeMarshaller},
+		{"fake/mime", fakeMarshaller, http.Header{"Accept": []string{"application/*"}}, true, "application/json", jsonMarshaller},
+		{"fake/mime", fakeMarshaller, http.Header{"Accept": []string{"application/json, fake/mime"}}, true, "application/json", jsonMarshaller},
+		{"fake/mime", fakeMarshaller, http.Header{"Accept": []string{"application/json;q=0.5, fake/mime"}}, true, "fake/mime", fakeMarshaller},
+		{"fake/mime", fakeMarshaller, http.Header{"Accept": []string{"fake/mime;q=0.5, */*;q=0.8"}}, true, "application/json", jsonMarshaller},
+		{"application/json", jsonMarshaller, http.Header{"Accept": []string{"application/*, application/json;q=0"}}, true, "application/cbor", CBORMarshaller{}},
+		{"application/json", jsonMarshaller, http.Header{"Accept": []string{"application/*, application/json;q=0, application/xml;q=0, application/cbor;q=0, application/msgpack;q=0, application/x-msgpack;q=0, application/x-ndjson;q=0"}}, false, "", nil},
+		{"application/json", jsonMarshaller, http.Header{"Accept": []string{"image/*, application/json;q=0"}}, false, "", nil},
+		{"application/json", jsonMarshaller, http.Header{"Accept": []string{"application/x-www-form-urlencoded"}}, false, "", nil},
+		{"application/json", jsonMarshaller, http.Header{"Accept": []string{"multipart/form-data"}}, false, "", nil},
+		{"application/json", jsonMarshaller, http.Header{"Accept": []string{"text/html, image/*"}}, false, "", nil},
+		{"application/json", jsonMarshaller, http.Header{"Accept": []string{"text/html", "application/json;q=0.1"}}, true, "application/json", jsonMarshaller},
+		{"application/json", jsonMarshaller, http.Header{"Accept": []string{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}}, true, "application/json", jsonMarshaller},
+		{"fake/mime", fakeMarshaller, http.Header{"Accept": []string{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}}, true, "fake/mime", fakeMarshaller},
+		{"application/json", jsonMarshaller, http.Header{"Accept": []string{"application/xhtml+xml, application/xml;q=0.9"}}, true, "application/xml", xmlMarshaller},
+		{"application/json", jsonMarshaller, http.Header{"Accept": []string{"application/vnd.api+json"}}, true, "application/json", jsonMarshaller},
+		{"application/json", jsonMarshaller, http.Header{"Accept": []string{"application/vnd.api+json;q=0, */*"}}, true, "application/json", jsonMarshaller},
+		{"fake/mime", fakeMarshaller, http.Header{"Accept": []string{"application/vnd.api+json"}}, false, "", nil},
 	}
 	for i, test := range tests {
 		req, err := http.NewRequest("GET", "http://domain/", nil)
 		assert.MustEqual(t, err, nil, "test %d", i)
 		req.Header = test.header
-		mime, marshaller := getMarshallerFromRequest(test.mime, test.marshaller, req)
+		mime, marshaller, ok := getResponseMarshaller(test.mime, test.marshaller, req)
+		assert.MustEqual(t, ok, test.ok, "test %d", i)
 		assert.Equal(t, mime, test.targetMime, "test %d", i)
 		assert.Equal(t, marshaller, test.targetMarshaller, "test %d", i)
 	}
@@ -0,0 +1,371 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WSContext is informations of a websocket connection.
+type WSContext interface {
+	// Context is the context of opening handshake. Render(v) sends v as a message.
+	// Return(code, ...) closes the connection, with WSClosePolicyViolation if code is 4xx,
+	// or WSCloseInternalError if code is 5xx.
+	Context
+
+	// Receive reads the next text or binary message and unmarshals to v with the negotiated marshaller.
+	// It answers ping and close from the client, and returns *WSCloseError if the connection is closed.
+	Receive(v interface{}) error
+
+	// Send marshals v with the negotiated marshaller and sends as a message,
+	// in binary frame if the marshaller is binary, otherwise in text frame.
+	Send(v interface{}) error
+
+	// Subprotocol returns the subprotocol selected in handshake, or "" if none.
+	Subprotocol() string
+
+	// Ping sends a ping to the client, whose pong is ignored by Receive.
+	Ping() error
+
+	// Close sends close frame with code and reason. Receive still can read the close reply of the client.
+	Close(code int, reason string) error
+
+	// SetReadDeadline sets the deadline for future Receive calls.
+	SetReadDeadline(t time.Time) error
+
+	// SetWriteDeadline sets the deadline for future Send calls.
+	SetWriteDeadline(t time.Time) error
+}
+
+// WebSocket is node of websocket, which always handles GET request. It's tag has below parameters :
+//  - route: service's tag prefix add route is http request url path.
+//  - path: path will ignore service's prefix tag, and use as url path.
+//  - protocol: subprotocols supported in preference order, like "chat.v2, chat.v1".
+//  - maxbody: the maximum size of received message like "1MB", closing with WSCloseMessageTooBig if larger.
+//    Default is 1MB.
+//  - origin: origins allowed to connect, like "https://example.com, https://www.example.com", or "*" for any.
+//    Default allows only the same host as the request, and handshakes from other origins are answered with 403.
+//    Requests without Origin header are not from browsers, and always allowed.
+// Messages are marshalled with the marshaller negotiated by Accept, or the service mime.
+// Session can be read in WSContext, but can't be saved after handshake.
+type WebSocket struct{}
+
+// CreateHandler create websocket handler.
+func (p WebSocket) CreateHandler(serviceTag reflect.StructTag, fieldTag reflect.StructTag, fname string, f reflect.Value) (string, string, Handler, error) {
+	path := fieldTag.Get("path")
+	if path == "" {
+		path = serviceTag.Get("prefix") + fieldTag.Get("route")
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	serviceMime := serviceTag.Get("mime")
+	if serviceMime == "" {
+		serviceMime = "application/json"
+	}
+	mime := serviceMime
+	marshaller, ok := getMarshaller(mime)
+	if !ok {
+		mime = "application/json"
+		marshaller, _ = getMarshaller(mime)
+	}
+
+	var protocols []string
+	for _, protocol := range strings.Split(fieldTag.Get("protocol"), ",") {
+		if protocol = strings.TrimSpace(protocol); protocol != "" {
+			protocols = append(protocols, protocol)
+		}
+	}
+	maxBody, err := getMaxBodyTag(serviceTag, fieldTag)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if maxBody == 0 {
+		maxBody = defaultWSMaxMessage
+	}
+	var origins []string
+	for _, origin := range strings.Split(fieldTag.Get("origin"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	t := f.Type()
+	if t.NumIn() != 1 {
+		return "", "", nil, fmt.Errorf("handler method %s should have 1 input parameter", fname)
+	}
+	if t.NumOut() != 0 {
+		return "", "", nil, fmt.Errorf("handler method %s should not have return parameter", fname)
+	}
+	p0 := t.In(0)
+	if p0.Kind() != reflect.Interface || p0.Name() != "WSContext" {
+		return "", "", nil, fmt.Errorf("handler method %s's 1st parameter must be rest.WSContext", fname)
+	}
+
+	return path, "GET", &wsHandler{
+		name:        fname,
+		serviceMime: serviceMime,
+		mime:        mime,
+		marshaller:  marshaller,
+		protocols:   protocols,
+		origins:     origins,
+		f:           f,
+		maxBody:     maxBody,
+	}, nil
+}
+
+// defaultWSMaxMessage is the maximum size of received message without maxbody tag.
+const defaultWSMaxMessage = 1 << 20
+
+type wsHandler struct {
+	name        string
+	serviceMime string // mime in service tag, which may be registered in Rest or service only.
+	mime        string
+	marshaller  Marshaller
+	protocols   []string
+	origins     []string
+	f           reflect.Value
+	maxBody     int64
+}
+
+func (h *wsHandler) Name() string {
+	return h.name
+}
+
+func (h *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	defaultMime, defaultMarshaller := resolveMarshaller(r, h.serviceMime, h.mime, h.marshaller)
+	if code, err := checkWSHandshake(r); err != nil {
+		if code == http.StatusUpgradeRequired {
+			w.Header().Set("Sec-WebSocket-Version", "13")
+		}
+		ctx := newBaseContext(h.name, defaultMarshaller, "utf-8", vars, r, w)
+		returnError(ctx, code, "%s", err)
+		return
+	}
+	if !checkWSOrigin(r, h.origins) {
+		ctx := newBaseContext(h.name, defaultMarshaller, "utf-8", vars, r, w)
+		returnError(ctx, http.StatusForbidden, "origin %s isn't allowed", r.Header.Get("Origin"))
+		return
+	}
+	_, marshaller, ok := getResponseMarshaller(defaultMime, defaultMarshaller, r)
+	if !ok {
+		w.Header().Add("Vary", "Accept")
+		ctx := newBaseContext(h.name, defaultMarshaller, "utf-8", vars, r, w)
+		returnError(ctx, http.StatusNotAcceptable, "can't find acceptable mime for %s", r.Header.Get("Accept"))
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		ctx := newBaseContext(h.name, marshaller, "utf-8", vars, r, w)
+		returnError(ctx, http.StatusInternalServerError, "webserver doesn't support hijacking")
+		return
+	}
+	conn, bufrw, err := hj.Hijack()
+	if err != nil {
+		ctx := newBaseContext(h.name, marshaller, "utf-8", vars, r, w)
+		returnError(ctx, http.StatusInternalServerError, "%s", err)
+		return
+	}
+	protocol := selectWSProtocol(h.protocols, r.Header)
+	handshake := newStreamResponseWriter(bufrw)
+	handshake.Header().Set("Upgrade", "websocket")
+	handshake.Header().Set("Connection", "Upgrade")
+	handshake.Header().Set("Sec-WebSocket-Accept", wsAcceptKey(r.Header.Get("Sec-WebSocket-Key")))
+	if protocol != "" {
+		handshake.Header().Set("Sec-WebSocket-Protocol", protocol)
+	}
+	if id := RequestID(r); id != "" {
+		handshake.Header().Set(requestIDHeader, id)
+	}
+	handshake.WriteHeader(http.StatusSwitchingProtocols)
+	setResponseCode(r, http.StatusSwitchingProtocols)
+	if err := bufrw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	ctx := newWSContext(h.name, marshaller, vars, r, w, conn, bufrw, protocol, h.maxBody)
+	defer ctx.close()
+	if m := getSessionManager(r); m != nil {
+		ctx.enableSession(m)
+	}
+	h.f.Call([]reflect.Value{reflect.ValueOf(WSContext(ctx))})
+}
+
+type wsContext struct {
+	*baseContext
+
+	conn     net.Conn
+	bufrw    *bufio.ReadWriter
+	protocol string
+	maxSize  int64
+
+	writeLocker sync.Mutex
+	closeSent   bool
+	readErr     error
+}
+
+func newWSContext(handlerName string, marshaller Marshaller, vars map[string]string, req *http.Request, resp http.ResponseWriter,
+	conn net.Conn, bufrw *bufio.ReadWriter, protocol string, maxSize int64) *wsContext {
+	return &wsContext{
+		baseContext: newBaseContext(handlerName, marshaller, "utf-8", vars, req, resp),
+		conn:        conn,
+		bufrw:       bufrw,
+		protocol:    protocol,
+		maxSize:     maxSize,
+	}
+}
+
+func (ctx *wsContext) Subprotocol() string {
+	return ctx.protocol
+}
+
+func (ctx *wsContext) Receive(v interface{}) error {
+	payload, err := ctx.readMessage()
+	if err != nil {
+		return err
+	}
+	return ctx.marshaller.Unmarshal(bytes.NewReader(payload), v)
+}
+
+// readMessage reads frames until a whole text or binary message, answering control frames.
+// A protocol error closes the connection, and is returned by all later calls.
+func (ctx *wsContext) readMessage() ([]byte, error) {
+	if ctx.readErr != nil {
+		return nil, ctx.readErr
+	}
+	var message bytes.Buffer
+	var opcode byte
+	for {
+		limit := int64(-1)
+		if ctx.maxSize > 0 {
+			limit = ctx.maxSize - int64(message.Len())
+		}
+		frame, err := readWSFrame(ctx.bufrw, limit, true)
+		if err == nil {
+			switch frame.opcode {
+			case wsPing:
+				ctx.writeFrame(wsPong, frame.payload)
+				continue
+			case wsPong:
+				continue
+			case wsClose:
+				closeErr := parseWSClose(frame.payload)
+				ctx.readErr = closeErr
+				if closeErr.Code == WSCloseProtocolError || closeErr.Code == WSCloseInvalidData {
+					ctx.Close(closeErr.Code, closeErr.Reason)
+				} else {
+					ctx.Close(closeErr.Code, "")
+				}
+				return nil, closeErr
+			case wsContinuation:
+				if opcode == 0 {
+					err = &WSCloseError{WSCloseProtocolError, "unexpected continuation frame"}
+				}
+			default:
+				if opcode != 0 {
+					err = &WSCloseError{WSCloseProtocolError, "expect continuation frame"}
+				}
+				opcode = frame.opcode
+			}
+		}
+		if err != nil {
+			ctx.readErr = err
+			if closeErr, ok := err.(*WSCloseError); ok {
+				ctx.Close(closeErr.Code, closeErr.Reason)
+			}
+			return nil, err
+		}
+		message.Write(frame.payload)
+		if !frame.fin {
+			continue
+		}
+		if opcode == wsText && !utf8.Valid(message.Bytes()) {
+			err := &WSCloseError{WSCloseInvalidData, "invalid utf-8 text message"}
+			ctx.readErr = err
+			ctx.Close(err.Code, err.Reason)
+			return nil, err
+		}
+		return message.Bytes(), nil
+	}
+}
+
+func (ctx *wsContext) Send(v interface{}) error {
+	var buf bytes.Buffer
+	if err := ctx.marshaller.Marshal(&buf, ctx.handlerName, v); err != nil {
+		return err
+	}
+	opcode := byte(wsText)
+	if isBinaryMarshaller(ctx.marshaller) {
+		opcode = wsBinary
+	}
+	return ctx.writeFrame(opcode, buf.Bytes())
+}
+
+func (ctx *wsContext) Ping() error {
+	return ctx.writeFrame(wsPing, nil)
+}
+
+func (ctx *wsContext) Close(code int, reason string) error {
+	if code != WSCloseNoStatus && !validWSCloseCode(code) {
+		return fmt.Errorf("invalid close code %d", code)
+	}
+	return ctx.writeFrame(wsClose, wsClosePayload(code, reason))
+}
+
+// writeFrame writes a frame, which is safe to call concurrently. Nothing can be sent after close frame.
+func (ctx *wsContext) writeFrame(opcode byte, payload []byte) error {
+	ctx.writeLocker.Lock()
+	defer ctx.writeLocker.Unlock()
+	if ctx.closeSent {
+		return &WSCloseError{WSCloseNormal, "websocket is closing"}
+	}
+	if opcode == wsClose {
+		ctx.closeSent = true
+	}
+	if err := writeWSFrame(ctx.bufrw, true, opcode, payload, nil); err != nil {
+		return err
+	}
+	return ctx.bufrw.Flush()
+}
+
+func (ctx *wsContext) SetReadDeadline(t time.Time) error {
+	return ctx.conn.SetReadDeadline(t)
+}
+
+func (ctx *wsContext) SetWriteDeadline(t time.Time) error {
+	return ctx.conn.SetWriteDeadline(t)
+}
+
+func (ctx *wsContext) Render(v interface{}) error {
+	return ctx.Send(v)
+}
+
+func (ctx *wsContext) RenderStatus(code int, v interface{}) error {
+	return ctx.Send(v)
+}
+
+func (ctx *wsContext) Return(code int, fmtAndArgs ...interface{}) {
+	closeCode := WSCloseNormal
+	switch {
+	case code >= 500:
+		closeCode = WSCloseInternalError
+	case code >= 400:
+		closeCode = WSClosePolicyViolation
+	}
+	ctx.Close(closeCode, formatMessage(code, fmtAndArgs...))
+}
+
+func (ctx *wsContext) close() {
+	ctx.Close(WSCloseNormal, "")
+	ctx.conn.Close()
+}
@@ -0,0 +1,301 @@
+package rest
+
+import (
+	"bufio"
+	"github.com/googollee/go-assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type wsFuncs struct{}
+
+func (f *wsFuncs) Ctx(ctx WSContext)            {}
+func (f *wsFuncs) NoArg()                       {}
+func (f *wsFuncs) WithReturn(ctx WSContext) int { return 1 }
+func (f *wsFuncs) StreamCtx(ctx StreamContext)  {}
+func (f *wsFuncs) MoreArg(ctx WSContext, i int) {}
+
+func TestWebSocket(t *testing.T) {
+	type Test struct {
+		serviceTag reflect.StructTag
+		fieldTag   reflect.StructTag
+		fname      string
+		f          reflect.Value
+
+		ok        bool
+		path      string
+		protocols []string
+		origins   []string
+		maxBody   int64
+	}
+	f := new(wsFuncs)
+	var tests = []Test{
+		{``, ``, "Ctx", reflect.ValueOf(f.Ctx), true, "/", nil, nil, 1 << 20},
+		{`prefix:"/prefix"`, `route:"/route" protocol:"chat.v2, chat.v1"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/prefix/route", []string{"chat.v2", "chat.v1"}, nil, 1 << 20},
+		{`prefix:"/prefix" maxbody:"1KB"`, `path:"/path"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/path", nil, nil, 1024},
+		{``, `origin:"https://a.com, *"`, "Ctx", reflect.ValueOf(f.Ctx), true, "/", nil, []string{"https://a.com", "*"}, 1 << 20},
+
+		{``, `maxbody:"abc"`, "Ctx", reflect.ValueOf(f.Ctx), false, "", nil, nil, 0},
+		{``, ``, "NoArg", reflect.ValueOf(f.NoArg), false, "", nil, nil, 0},
+		{``, ``, "WithReturn", reflect.ValueOf(f.WithReturn), false, "", nil, nil, 0},
+		{``, ``, "StreamCtx", reflect.ValueOf(f.StreamCtx), false, "", nil, nil, 0},
+		{``, ``, "MoreArg", reflect.ValueOf(f.MoreArg), false, "", nil, nil, 0},
+	}
+	for i, test := range tests {
+		var p Node
+		p = WebSocket{}
+		path, method, handler, err := p.CreateHandler(test.serviceTag, test.fieldTag, test.fname, test.f)
+		assert.MustEqual(t, err == nil, test.ok, "test %d: %s", i, err)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, path, test.path, "test %d", i)
+		assert.Equal(t, method, "GET", "test %d", i)
+		ph, ok := handler.(*wsHandler)
+		assert.MustEqual(t, ok, true, "test %d", i)
+		assert.Equal(t, ph.name, test.fname, "test %d", i)
+		assert.Equal(t, ph.protocols, test.protocols, "test %d", i)
+		assert.Equal(t, ph.origins, test.origins, "test %d", i)
+		assert.Equal(t, ph.maxBody, test.maxBody, "test %d", i)
+	}
+}
+
+type wsService struct {
+	Service `prefix:"/ws"`
+	Msgpack Service `prefix:"/msgpack" mime:"application/msgpack"`
+
+	echo   WebSocket `route:"/echo" protocol:"chat.v2, chat.v1" maxbody:"16"`
+	reject WebSocket `route:"/reject"`
+	public WebSocket `route:"/public" origin:"https://a.com"`
+	large  WebSocket `route:"/large"`
+}
+
+func (s *wsService) Echo(ctx WSContext) {
+	ctx.Send(ctx.Subprotocol())
+	for {
+		var v interface{}
+		if err := ctx.Receive(&v); err != nil {
+			return
+		}
+		ctx.Render(v)
+	}
+}
+
+func (s *wsService) Reject(ctx WSContext) {
+	ctx.Return(http.StatusForbidden, "forbidden")
+}
+
+func (s *wsService) Public(ctx WSContext) {
+	ctx.Send("public")
+}
+
+func (s *wsService) Large(ctx WSContext) {
+	var v string
+	err := ctx.Receive(&v)
+	ctx.Send(err == nil)
+}
+
+type wsTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialWSTest(t *testing.T, server *httptest.Server, path string, header http.Header) (*wsTestClient, *http.Response) {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	assert.MustEqual(t, err, nil)
+	conn.SetDeadline(time.Now().Add(time.Second * 5))
+	req, err := http.NewRequest("GET", server.URL+path, nil)
+	assert.MustEqual(t, err, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	err = req.Write(conn)
+	assert.MustEqual(t, err, nil)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	assert.MustEqual(t, err, nil)
+	return &wsTestClient{t, conn, r}, resp
+}
+
+func (c *wsTestClient) write(fin bool, opcode byte, payload string) {
+	err := writeWSFrame(c.conn, fin, opcode, []byte(payload), []byte{1, 2, 3, 4})
+	assert.MustEqual(c.t, err, nil)
+}
+
+func (c *wsTestClient) read() wsFrame {
+	frame, err := readWSFrame(c.r, -1, false)
+	assert.MustEqual(c.t, err, nil)
+	return frame
+}
+
+func (c *wsTestClient) readClose() *WSCloseError {
+	frame := c.read()
+	assert.MustEqual(c.t, frame.opcode, byte(wsClose))
+	return parseWSClose(frame.payload)
+}
+
+func TestWSContext(t *testing.T) {
+	r := New()
+	err := r.Add(new(wsService))
+	assert.MustEqual(t, err, nil)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	{
+		c, resp := dialWSTest(t, server, "/ws/echo", http.Header{"Sec-Websocket-Protocol": {"chat.v1, chat.v2"}})
+		defer c.conn.Close()
+		assert.Equal(t, resp.StatusCode, http.StatusSwitchingProtocols)
+		assert.Equal(t, resp.Header.Get("Sec-WebSocket-Accept"), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+		assert.Equal(t, resp.Header.Get("Sec-WebSocket-Protocol"), "chat.v2")
+		assert.Equal(t, resp.Header.Get("Upgrade"), "websocket")
+
+		frame := c.read()
+		assert.Equal(t, frame.opcode, byte(wsText))
+		assert.Equal(t, string(frame.payload), "\"chat.v2\"\n")
+
+		c.write(true, wsText, `{"a":1}`)
+		frame = c.read()
+		assert.Equal(t, frame.opcode, byte(wsText))
+		assert.Equal(t, string(frame.payload), "{\"a\":1}\n")
+
+		c.write(false, wsText, "[1,")
+		c.write(true, wsPing, "p")
+		c.write(false, wsContinuation, "2,")
+		c.write(true, wsContinuation, "3]")
+		frame = c.read()
+		assert.Equal(t, frame.opcode, byte(wsPong))
+		assert.Equal(t, string(frame.payload), "p")
+		frame = c.read()
+		assert.Equal(t, string(frame.payload), "[1,2,3]\n")
+
+		c.write(true, wsClose, "\x03\xe8bye")
+		closeErr := c.readClose()
+		assert.Equal(t, closeErr.Code, WSCloseNormal)
+		_, err := c.r.ReadByte()
+		assert.NotEqual(t, err, nil)
+	}
+
+	type Test struct {
+		path   string
+		frames [][]interface{}
+		code   int
+	}
+	var tests = []Test{
+		{"/ws/echo", [][]interface{}{{true, wsText, "\"12345678901234567\""}}, WSCloseMessageTooBig},
+		{"/ws/echo", [][]interface{}{{false, wsText, "\"1234567890"}, {true, wsContinuation, "1234567\""}}, WSCloseMessageTooBig},
+		{"/ws/echo", [][]interface{}{{true, wsContinuation, "1"}}, WSCloseProtocolError},
+		{"/ws/echo", [][]interface{}{{false, wsText, "[1"}, {true, wsText, "1"}}, WSCloseProtocolError},
+		{"/ws/echo", [][]interface{}{{true, wsText, "\"\xff\""}}, WSCloseInvalidData},
+		{"/ws/echo", [][]interface{}{{true, wsClose, "\x03\xed"}}, WSCloseProtocolError},
+		{"/ws/echo", [][]interface{}{{true, wsClose, ""}}, WSCloseNoStatus},
+		{"/ws/reject", nil, WSClosePolicyViolation},
+	}
+	for i, test := range tests {
+		c, resp := dialWSTest(t, server, test.path, nil)
+		assert.MustEqual(t, resp.StatusCode, http.StatusSwitchingProtocols, "test %d", i)
+		assert.Equal(t, resp.Header.Get("Sec-WebSocket-Protocol"), "", "test %d", i)
+		if test.path == "/ws/echo" {
+			frame := c.read()
+			assert.Equal(t, string(frame.payload), "\"\"\n", "test %d", i)
+		}
+		for _, frame := range test.frames {
+			c.write(frame[0].(bool), byte(frame[1].(int)), frame[2].(string))
+		}
+		frame := c.read()
+		assert.MustEqual(t, frame.opcode, byte(wsClose), "test %d", i)
+		if test.code == WSCloseNoStatus {
+			assert.Equal(t, len(frame.payload), 0, "test %d", i)
+		} else {
+			assert.Equal(t, parseWSClose(frame.payload).Code, test.code, "test %d", i)
+		}
+		c.conn.Close()
+	}
+
+	{
+		c, resp := dialWSTest(t, server, "/msgpack/echo", nil)
+		defer c.conn.Close()
+		assert.Equal(t, resp.StatusCode, http.StatusSwitchingProtocols)
+		frame := c.read()
+		assert.Equal(t, frame.opcode, byte(wsBinary))
+		assert.Equal(t, string(frame.payload), "\xa0")
+		c.write(true, wsBinary, "\x92\x01\x02")
+		frame = c.read()
+		assert.Equal(t, frame.opcode, byte(wsBinary))
+		assert.Equal(t, string(frame.payload), "\x92\x01\x02")
+	}
+
+	{
+		c, _ := dialWSTest(t, server, "/ws/reject", nil)
+		defer c.conn.Close()
+		closeErr := c.readClose()
+		assert.Equal(t, closeErr.Code, WSClosePolicyViolation)
+		assert.Equal(t, closeErr.Reason, "forbidden")
+	}
+
+	{
+		c, _ := dialWSTest(t, server, "/ws/large", nil)
+		defer c.conn.Close()
+		c.write(true, wsText, "\""+strings.Repeat("a", 1<<20)+"\"")
+		closeErr := c.readClose()
+		assert.Equal(t, closeErr.Code, WSCloseMessageTooBig)
+	}
+
+	type OriginTest struct {
+		path   string
+		origin string
+		code   int
+	}
+	host := server.Listener.Addr().String()
+	var originTests = []OriginTest{
+		{"/ws/echo", "", http.StatusSwitchingProtocols},
+		{"/ws/echo", "http://" + host, http.StatusSwitchingProtocols},
+		{"/ws/echo", "https://" + strings.ToUpper(host), http.StatusSwitchingProtocols},
+		{"/ws/echo", "http://evil.com", http.StatusForbidden},
+		{"/ws/echo", "null", http.StatusForbidden},
+		{"/ws/public", "https://a.com", http.StatusSwitchingProtocols},
+		{"/ws/public", "http://" + host, http.StatusForbidden},
+	}
+	for i, test := range originTests {
+		header := http.Header{}
+		if test.origin != "" {
+			header.Set("Origin", test.origin)
+		}
+		c, resp := dialWSTest(t, server, test.path, header)
+		assert.Equal(t, resp.StatusCode, test.code, "test %d", i)
+		c.conn.Close()
+	}
+
+	type HandshakeTest struct {
+		header  map[string]string
+		code    int
+		version string
+	}
+	var handshakeTests = []HandshakeTest{
+		{map[string]string{}, http.StatusBadRequest, ""},
+		{map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8"}, http.StatusUpgradeRequired, "13"},
+		{map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "bad"}, http.StatusBadRequest, ""},
+	}
+	for i, test := range handshakeTests {
+		req, err := http.NewRequest("GET", server.URL+"/ws/echo", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		for k, v := range test.header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		resp.Body.Close()
+		assert.Equal(t, resp.StatusCode, test.code, "test %d", i)
+		assert.Equal(t, resp.Header.Get("Sec-WebSocket-Version"), test.version, "test %d", i)
+		assert.Equal(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain"), true, "test %d", i)
+	}
+}
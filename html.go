@@ -0,0 +1,195 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrorMarshaller is a Marshaller which renders error responses too.
+// If the marshaller of response implements it, Context.Return uses it to render error message.
+type ErrorMarshaller interface {
+	Marshaller
+	MarshalError(w io.Writer, code int, message string) error
+}
+
+// HTMLError is the data of error template of HTMLMarshaller.
+type HTMLError struct {
+	Code    int
+	Status  string
+	Message string
+}
+
+// HTMLMarshaller is Marshaller rendering html/template, using the handler name as template name.
+// Handler can use other template with field tag like `template:"users/list"`.
+//
+// Templates are *.html files in template directory, named by the path relative to directory without extension,
+// like "Hello" for "Hello.html" and "users/list" for "users/list.html".
+// Templates in layouts/ and partials/ are shared by all other templates, so a page can define blocks
+// and execute a layout like {{template "layouts/base" .}}.
+//
+// A HTMLMarshaller is registered for text/html by default, without templates. It isn't negotiated by Accept
+// until templates are loaded with SetHTMLTemplateDir:
+//     err := rest.SetHTMLTemplateDir("./templates", false)
+// Or register another one to render text/html:
+//     m, err := rest.NewHTMLMarshaller("./templates")
+//     rest.RegisterMarshaller("text/html", m)
+type HTMLMarshaller struct {
+	// Reload parses templates again when rendering, for developing.
+	Reload bool
+	// ErrorTemplate is the name of template rendering errors with HTMLError. Default is "error".
+	// If the template doesn't exist, errors are responded as plain text.
+	ErrorTemplate string
+
+	dir       string
+	locker    sync.RWMutex
+	templates map[string]*template.Template
+}
+
+// NewHTMLMarshaller creates a HTMLMarshaller and loads templates in dir.
+func NewHTMLMarshaller(dir string) (*HTMLMarshaller, error) {
+	ret := &HTMLMarshaller{
+		ErrorTemplate: "error",
+		dir:           dir,
+	}
+	templates, err := loadHTMLTemplates(dir)
+	if err != nil {
+		return nil, err
+	}
+	ret.templates = templates
+	return ret, nil
+}
+
+// SetHTMLTemplateDir loads templates in dir to the HTMLMarshaller registered for text/html by default.
+// If reload is true, templates are parsed again when rendering, for developing.
+func SetHTMLTemplateDir(dir string, reload bool) error {
+	templates, err := loadHTMLTemplates(dir)
+	if err != nil {
+		return err
+	}
+	htmlMarshaller.locker.Lock()
+	defer htmlMarshaller.locker.Unlock()
+	htmlMarshaller.dir = dir
+	htmlMarshaller.Reload = reload
+	htmlMarshaller.templates = templates
+	return nil
+}
+
+func loadHTMLTemplates(dir string) (map[string]*template.Template, error) {
+	shared := template.New("")
+	pages := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".html" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), ".html")
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(name, "layouts/") || strings.HasPrefix(name, "partials/") {
+			if _, err := shared.New(name).Parse(string(b)); err != nil {
+				return err
+			}
+			return nil
+		}
+		pages[name] = string(b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]*template.Template)
+	for name, text := range pages {
+		t, err := shared.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.New(name).Parse(text); err != nil {
+			return nil, err
+		}
+		ret[name] = t
+	}
+	return ret, nil
+}
+
+// UseTemplate returns true, so m is passed the template tag of handler.
+func (m *HTMLMarshaller) UseTemplate() bool {
+	return true
+}
+
+// CanRespond reports whether m has loaded templates or loads them when rendering,
+// so the default one doesn't answer browsers before it's set up.
+func (m *HTMLMarshaller) CanRespond() bool {
+	m.locker.RLock()
+	defer m.locker.RUnlock()
+	return m.Reload || len(m.templates) > 0
+}
+
+func (m *HTMLMarshaller) lookup(name string) (*template.Template, error) {
+	m.locker.RLock()
+	reload, dir := m.Reload, m.dir
+	m.locker.RUnlock()
+	if reload {
+		templates, err := loadHTMLTemplates(dir)
+		if err != nil {
+			return nil, err
+		}
+		m.locker.Lock()
+		m.templates = templates
+		m.locker.Unlock()
+	}
+	m.locker.RLock()
+	defer m.locker.RUnlock()
+	t, ok := m.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("can't find template %s", name)
+	}
+	return t, nil
+}
+
+func (m *HTMLMarshaller) execute(w io.Writer, name string, v interface{}) error {
+	t, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, v); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// Marshal renders v with template name and writes to w.
+func (m *HTMLMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	return m.execute(w, name, v)
+}
+
+// Unmarshal isn't supported by HTMLMarshaller.
+func (m *HTMLMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	return fmt.Errorf("html marshaller can't unmarshal")
+}
+
+// MarshalError renders error with ErrorTemplate and writes to w.
+func (m *HTMLMarshaller) MarshalError(w io.Writer, code int, message string) error {
+	return m.execute(w, m.ErrorTemplate, HTMLError{
+		Code:    code,
+		Status:  http.StatusText(code),
+		Message: message,
+	})
+}
@@ -0,0 +1,191 @@
+package rest
+
+import (
+	"bytes"
+	"github.com/googollee/go-assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "rest-html")
+	assert.MustEqual(t, err, nil)
+	for name, text := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		assert.MustEqual(t, err, nil)
+		err = ioutil.WriteFile(path, []byte(text), 0644)
+		assert.MustEqual(t, err, nil)
+	}
+	return dir
+}
+
+func TestHTMLMarshaller(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layouts/base.html":   `<html><title>{{block "title" .}}default{{end}}</title><body>{{template "content" .}}</body></html>`,
+		"partials/name.html":  `<b>{{.}}</b>`,
+		"Hello.html":          `{{define "title"}}hello{{end}}{{define "content"}}hello {{template "partials/name" .}}{{end}}{{template "layouts/base" .}}`,
+		"users/list.html":     `{{define "content"}}{{range .}}<i>{{.}}</i>{{end}}{{end}}{{template "layouts/base" .}}`,
+		"error.html":          `<h1>{{.Code}} {{.Status}}</h1><p>{{.Message}}</p>`,
+		"ignored/readme.txt":  `not a template`,
+		"layouts/simple.html": `{{template "content" .}}`,
+	})
+	defer os.RemoveAll(dir)
+	m, err := NewHTMLMarshaller(dir)
+	assert.MustEqual(t, err, nil)
+
+	type Test struct {
+		name string
+		v    interface{}
+		ok   bool
+		html string
+	}
+	var tests = []Test{
+		{"Hello", "<rest>", true, "<html><title>hello</title><body>hello <b>&lt;rest&gt;</b></body></html>"},
+		{"users/list", []string{"a", "b"}, true, "<html><title>default</title><body><i>a</i><i>b</i></body></html>"},
+		{"NotExist", nil, false, ""},
+		{"layouts/base", nil, false, ""},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		err := m.Marshal(&buf, test.name, test.v)
+		assert.MustEqual(t, err == nil, test.ok, "test %d", i)
+		assert.Equal(t, buf.String(), test.html, "test %d", i)
+	}
+
+	var buf bytes.Buffer
+	err = m.MarshalError(&buf, http.StatusNotFound, "no <user>")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, buf.String(), "<h1>404 Not Found</h1><p>no &lt;user&gt;</p>")
+
+	err = m.Unmarshal(&buf, new(string))
+	assert.NotEqual(t, err, nil)
+
+	_, err = NewHTMLMarshaller(filepath.Join(dir, "not_exist"))
+	assert.NotEqual(t, err, nil)
+}
+
+func TestHTMLMarshallerReload(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"Hello.html": `hello`,
+	})
+	defer os.RemoveAll(dir)
+	m, err := NewHTMLMarshaller(dir)
+	assert.MustEqual(t, err, nil)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "Hello.html"), []byte("reloaded"), 0644)
+	assert.MustEqual(t, err, nil)
+	var buf bytes.Buffer
+	m.Marshal(&buf, "Hello", nil)
+	assert.Equal(t, buf.String(), "hello")
+
+	m.Reload = true
+	buf.Reset()
+	m.Marshal(&buf, "Hello", nil)
+	assert.Equal(t, buf.String(), "reloaded")
+}
+
+func TestHTMLHandler(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"Hello.html":  `hello {{.}}`,
+		"other.html":  `other {{.}}`,
+		"error.html":  `error {{.Code}}: {{.Message}}`,
+		"layouts/x.h": ``,
+	})
+	defer os.RemoveAll(dir)
+	m, err := NewHTMLMarshaller(dir)
+	assert.MustEqual(t, err, nil)
+
+	type Test struct {
+		fieldTag reflect.StructTag
+		f        reflect.Value
+		code     int
+		body     string
+	}
+	var tests = []Test{
+		{`method:"GET"`, reflect.ValueOf(func(ctx Context) string { return "rest" }), http.StatusOK, "hello rest"},
+		{`method:"GET" template:"other"`, reflect.ValueOf(func(ctx Context) string { return "rest" }), http.StatusOK, "other rest"},
+		{`method:"GET"`, reflect.ValueOf(func(ctx Context) (string, error) { return "", NewError(http.StatusForbidden, "no <way>") }), http.StatusForbidden, "error 403: no &lt;way&gt;"},
+	}
+	for i, test := range tests {
+		_, _, handler, err := SimpleNode{}.CreateHandler(``, test.fieldTag, "Hello", test.f)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		h := handler.(*baseHandler)
+		h.serviceMime, h.mime, h.marshaller = "text/html", "text/html", m
+		scoped := scopedHandler{handler, newMarshallerRegistry(map[string]Marshaller{"text/html": m})}
+		req, err := http.NewRequest("GET", "http://domain/", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		resp := httptest.NewRecorder()
+		scoped.ServeHTTP(resp, req, nil)
+		assert.Equal(t, resp.Code, test.code, "test %d", i)
+		assert.Equal(t, resp.Body.String(), test.body, "test %d", i)
+		assert.Equal(t, resp.Header().Get("Content-Type"), "text/html; charset=utf-8", "test %d", i)
+	}
+
+	_, _, handler, err := SimpleNode{}.CreateHandler(``, `method:"GET" template:"other"`, "Hello", reflect.ValueOf(func(ctx Context) string { return "rest" }))
+	assert.MustEqual(t, err, nil)
+	req, err := http.NewRequest("GET", "http://domain/", nil)
+	assert.MustEqual(t, err, nil)
+	req.Header.Set("Accept", "application/xml")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req, nil)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Body.String(), "<Hello>rest</Hello>")
+}
+
+type htmlRest struct {
+	Service
+
+	hello SimpleNode `path:"/hello" method:"GET"`
+}
+
+func (r *htmlRest) Hello(ctx Context) string {
+	return "rest"
+}
+
+func TestDefaultHTMLMarshaller(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"Hello.html": `hello {{.}}`,
+	})
+	defer os.RemoveAll(dir)
+	defer func() {
+		htmlMarshaller.locker.Lock()
+		htmlMarshaller.dir, htmlMarshaller.Reload, htmlMarshaller.templates = "", false, nil
+		htmlMarshaller.locker.Unlock()
+	}()
+	r := New()
+	err := r.Add(new(htmlRest))
+	assert.MustEqual(t, err, nil)
+
+	type Test struct {
+		setup       bool
+		contentType string
+		body        string
+	}
+	var tests = []Test{
+		{false, "application/json; charset=utf-8", "\"rest\"\n"},
+		{true, "text/html; charset=utf-8", "hello rest"},
+	}
+	for i, test := range tests {
+		if test.setup {
+			err := SetHTMLTemplateDir(dir, false)
+			assert.MustEqual(t, err, nil, "test %d", i)
+		}
+		req, err := http.NewRequest("GET", "http://domain/hello", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusOK, "test %d", i)
+		assert.Equal(t, resp.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		assert.Equal(t, resp.Body.String(), test.body, "test %d", i)
+	}
+
+	err = SetHTMLTemplateDir(filepath.Join(dir, "not-exist"), false)
+	assert.NotEqual(t, err, nil)
+}
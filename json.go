@@ -0,0 +1,357 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// NamingStrategy renames struct fields without json tag when marshalling json.
+type NamingStrategy int
+
+const (
+	// KeepNames keeps field names, like UserID.
+	KeepNames NamingStrategy = iota
+	// SnakeCase renames fields like UserID to user_id.
+	SnakeCase
+	// CamelCase renames fields like UserID to userID.
+	CamelCase
+)
+
+// Rename returns field name renamed with the naming strategy.
+func (n NamingStrategy) Rename(name string) string {
+	switch n {
+	case SnakeCase:
+		words := splitWords(name)
+		for i := range words {
+			words[i] = strings.ToLower(words[i])
+		}
+		return strings.Join(words, "_")
+	case CamelCase:
+		words := splitWords(name)
+		if len(words) == 0 {
+			return name
+		}
+		words[0] = strings.ToLower(words[0])
+		return strings.Join(words, "")
+	}
+	return name
+}
+
+// splitWords splits name at case changes, like UserID to User and ID, HTTPServer to HTTP and Server.
+func splitWords(name string) []string {
+	runes := []rune(name)
+	var ret []string
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if runes[i] == '_' {
+			if start < i {
+				ret = append(ret, string(runes[start:i]))
+			}
+			start = i + 1
+			continue
+		}
+		if !unicode.IsUpper(runes[i]) || start == i {
+			continue
+		}
+		prev := runes[i-1]
+		nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+			ret = append(ret, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		ret = append(ret, string(runes[start:]))
+	}
+	return ret
+}
+
+var jsonpCallbackRegexp = regexp.MustCompile(`^[A-Za-z_$][\w$.]*$`)
+
+const maxJSONPCallback = 128
+
+// validJSONPCallback reports whether name is safe as a JSONP callback, like "jQuery123" or "app.callback".
+func validJSONPCallback(name string) bool {
+	return len(name) <= maxJSONPCallback && jsonpCallbackRegexp.MatchString(name)
+}
+
+// isPrettyQuery reports whether query asks for indented json, like "?pretty" or "?pretty=true".
+func isPrettyQuery(query url.Values) bool {
+	values, ok := query["pretty"]
+	if !ok {
+		return false
+	}
+	if len(values) == 0 {
+		return true
+	}
+	switch strings.ToLower(values[0]) {
+	case "0", "false", "no":
+		return false
+	}
+	return true
+}
+
+// requestMarshaller is a Marshaller with options of request, like JSONMarshaller with "?pretty" query.
+type requestMarshaller interface {
+	// forRequest returns the marshaller for request r, and the mime of response if it changes, like JSONP.
+	forRequest(r *http.Request) (Marshaller, string, error)
+}
+
+// marshallerForRequest returns the marshaller and mime of response for request r.
+func marshallerForRequest(r *http.Request, mime string, marshaller Marshaller) (string, Marshaller, error) {
+	m, ok := marshaller.(requestMarshaller)
+	if !ok {
+		return mime, marshaller, nil
+	}
+	ret, retMime, err := m.forRequest(r)
+	if err != nil {
+		return mime, marshaller, err
+	}
+	if retMime == "" {
+		retMime = mime
+	}
+	return retMime, ret, nil
+}
+
+func (j JSONMarshaller) forRequest(r *http.Request) (Marshaller, string, error) {
+	return j.withRequest(r)
+}
+
+// withRequest returns j with options from request r: "?pretty" query and JSONP callback.
+func (j JSONMarshaller) withRequest(r *http.Request) (JSONMarshaller, string, error) {
+	query := r.URL.Query()
+	if j.Indent == "" && isPrettyQuery(query) {
+		j.Indent = "  "
+	}
+	if j.Callback == "" {
+		return j, "", nil
+	}
+	callback := query.Get(j.Callback)
+	if callback == "" {
+		return j, "", nil
+	}
+	if !validJSONPCallback(callback) {
+		return j, "", fmt.Errorf("invalid callback %q", callback)
+	}
+	j.jsonp = callback
+	return j, "application/javascript", nil
+}
+
+func (j StrictJSONMarshaller) forRequest(r *http.Request) (Marshaller, string, error) {
+	m, mime, err := j.JSONMarshaller.withRequest(r)
+	return StrictJSONMarshaller{m}, mime, err
+}
+
+// forRequest ignores JSONP callback, which can't wrap a stream of messages.
+func (m JSONArrayMarshaller) forRequest(r *http.Request) (Marshaller, string, error) {
+	j := m.JSONMarshaller
+	j.Callback = ""
+	j, _, err := j.withRequest(r)
+	return JSONArrayMarshaller{j}, "", err
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	interfaceType     = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// renameJSON converts v to a value which marshals to the same json as v,
+// but fields of struct without json tag are renamed with naming.
+// It returns an error if v has a cycle, like encoding/json.
+func renameJSON(v reflect.Value, naming NamingStrategy) (interface{}, error) {
+	r := jsonRenamer{
+		naming:  naming,
+		visited: make(map[jsonVisit]bool),
+	}
+	return r.rename(v)
+}
+
+// jsonVisit is a pointer, map or slice being renamed, to detect cycles.
+type jsonVisit struct {
+	ptr uintptr
+	len int
+	t   reflect.Type
+}
+
+type jsonRenamer struct {
+	naming  NamingStrategy
+	visited map[jsonVisit]bool
+}
+
+// enter marks v as being renamed, and returns a function to unmark it, or an error if v is already being renamed.
+func (r *jsonRenamer) enter(v reflect.Value) (func(), error) {
+	visit := jsonVisit{v.Pointer(), 0, v.Type()}
+	if v.Kind() == reflect.Slice {
+		visit.len = v.Len()
+	}
+	if r.visited[visit] {
+		return nil, fmt.Errorf("json: unsupported value: encountered a cycle via %s", v.Type())
+	}
+	r.visited[visit] = true
+	return func() { delete(r.visited, visit) }, nil
+}
+
+func (r *jsonRenamer) rename(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.CanInterface() {
+		t := v.Type()
+		if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+			return v.Interface(), nil
+		}
+		if v.CanAddr() && (reflect.PtrTo(t).Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)) {
+			return v.Addr().Interface(), nil
+		}
+	} else {
+		// Embedded unexported struct with json tag, whose exported fields are still marshalled.
+		if v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return nil, nil
+		}
+	}
+	t := v.Type()
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			if v.Kind() == reflect.Ptr {
+				return nil, nil
+			}
+			return v.Interface(), nil
+		}
+		leave, err := r.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return r.rename(v.Elem())
+	case reflect.Struct:
+		ret := jsonObject{}
+		for _, field := range jsonFields(t) {
+			fv, ok := structFieldValue(v, field.index)
+			if !ok || (field.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			name := field.name
+			if !field.tagged {
+				name = r.naming.Rename(name)
+			}
+			var value interface{}
+			if field.quoted {
+				if fv.Kind() == reflect.Ptr {
+					fv = fv.Elem()
+				}
+				if fv.IsValid() {
+					value = jsonQuoted{fv.Interface()}
+				}
+			} else {
+				var err error
+				if value, err = r.rename(fv); err != nil {
+					return nil, err
+				}
+			}
+			ret = append(ret, jsonMember{name, value})
+		}
+		return ret, nil
+	case reflect.Map:
+		ret := reflect.MakeMap(reflect.MapOf(t.Key(), interfaceType))
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, err := r.rename(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			value := reflect.Zero(interfaceType)
+			if elem != nil {
+				value = reflect.ValueOf(elem)
+			}
+			ret.SetMapIndex(iter.Key(), value)
+		}
+		return ret.Interface(), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return v.Interface(), nil
+		}
+		ret := make([]interface{}, v.Len())
+		for i := range ret {
+			elem, err := r.rename(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			ret[i] = elem
+		}
+		return ret, nil
+	}
+	return v.Interface(), nil
+}
+
+// jsonObject is a json object keeping the order of members.
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	name  string
+	value interface{}
+}
+
+// MarshalJSON implements json.Marshaler. HTML is escaped by the outer encoder if needed.
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	buf.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encoder.Encode(member.name); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		if err := encoder.Encode(member.value); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonQuoted is a value of field with ",string" option in json tag.
+type jsonQuoted struct {
+	value interface{}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (q jsonQuoted) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(q.value); err != nil {
+		return nil, err
+	}
+	switch reflect.ValueOf(q.value).Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.String:
+		s := strings.TrimSuffix(buf.String(), "\n")
+		buf.Reset()
+		if err := encoder.Encode(s); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,272 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/googollee/go-assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNamingStrategy(t *testing.T) {
+	type Test struct {
+		name  string
+		snake string
+		camel string
+	}
+	var tests = []Test{
+		{"Name", "name", "name"},
+		{"UserID", "user_id", "userID"},
+		{"ID", "id", "id"},
+		{"HTTPServer", "http_server", "httpServer"},
+		{"Version2Name", "version2_name", "version2Name"},
+		{"User_Name", "user_name", "userName"},
+		{"A", "a", "a"},
+	}
+	for i, test := range tests {
+		assert.Equal(t, KeepNames.Rename(test.name), test.name, "test %d", i)
+		assert.Equal(t, SnakeCase.Rename(test.name), test.snake, "test %d", i)
+		assert.Equal(t, CamelCase.Rename(test.name), test.camel, "test %d", i)
+	}
+}
+
+func TestJSONPCallback(t *testing.T) {
+	type Test struct {
+		callback string
+		ok       bool
+	}
+	var tests = []Test{
+		{"callback", true},
+		{"jQuery_123", true},
+		{"$.app.done", true},
+		{"", false},
+		{"1abc", false},
+		{"alert(1)", false},
+		{"a..b", true},
+		{"alert(1)//", false},
+		{"a;b", false},
+		{string(bytes.Repeat([]byte("a"), maxJSONPCallback+1)), false},
+	}
+	for i, test := range tests {
+		assert.Equal(t, validJSONPCallback(test.callback), test.ok, "test %d", i)
+	}
+}
+
+func TestPrettyQuery(t *testing.T) {
+	type Test struct {
+		query  string
+		pretty bool
+	}
+	var tests = []Test{
+		{"", false},
+		{"pretty", true},
+		{"pretty=", true},
+		{"pretty=1", true},
+		{"pretty=false", false},
+		{"pretty=0", false},
+		{"other=1", false},
+	}
+	for i, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, isPrettyQuery(query), test.pretty, "test %d", i)
+	}
+}
+
+type jsonNamingEmbed struct {
+	EmbedField int
+}
+
+type jsonNamingStruct struct {
+	jsonNamingEmbed
+	UserID     int
+	Tagged     string `json:"TaggedName"`
+	Omit       string `json:",omitempty"`
+	Ignore     string `json:"-"`
+	Quoted     int    `json:",string"`
+	Time       time.Time
+	Child      *jsonNamingStruct `json:",omitempty"`
+	Children   []jsonNamingEmbed
+	Maps       map[string]jsonNamingEmbed
+	HTML       string
+	unexported int
+}
+
+func TestJSONMarshallerOptions(t *testing.T) {
+	v := jsonNamingStruct{
+		jsonNamingEmbed: jsonNamingEmbed{1},
+		UserID:          2,
+		Tagged:          "t",
+		Ignore:          "i",
+		Quoted:          3,
+		Time:            time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Child:           &jsonNamingStruct{UserID: 4},
+		Children:        []jsonNamingEmbed{{5}},
+		Maps:            map[string]jsonNamingEmbed{"Key": {6}},
+		HTML:            "<a>",
+	}
+	type Test struct {
+		marshaller JSONMarshaller
+		v          interface{}
+		output     string
+	}
+	var tests = []Test{
+		{JSONMarshaller{}, map[string]string{"a": "<b>"}, "{\"a\":\"\\u003cb\\u003e\"}\n"},
+		{JSONMarshaller{NoEscapeHTML: true}, map[string]string{"a": "<b>"}, "{\"a\":\"<b>\"}\n"},
+		{JSONMarshaller{Indent: "  "}, map[string]int{"a": 1}, "{\n  \"a\": 1\n}\n"},
+		{JSONMarshaller{jsonp: "cb"}, []int{1}, "/**/cb([1]);\n"},
+		{JSONMarshaller{Naming: SnakeCase}, v, `{"embed_field":1,"user_id":2,"TaggedName":"t","quoted":"3","time":"2020-01-02T03:04:05Z",` +
+			`"child":{"embed_field":0,"user_id":4,"TaggedName":"","quoted":"0","time":"0001-01-01T00:00:00Z","children":null,"maps":null,"html":""},` +
+			`"children":[{"embed_field":5}],"maps":{"Key":{"embed_field":6}},"html":"\u003ca\u003e"}` + "\n"},
+		{JSONMarshaller{Naming: CamelCase, NoEscapeHTML: true}, []jsonNamingEmbed{{1}}, `[{"embedField":1}]` + "\n"},
+		{JSONMarshaller{Naming: CamelCase, NoEscapeHTML: true}, jsonNamingStruct{HTML: "<a>"}, `{"embedField":0,"userID":0,"TaggedName":"","quoted":"0",` +
+			`"time":"0001-01-01T00:00:00Z","children":null,"maps":null,"html":"<a>"}` + "\n"},
+		{JSONMarshaller{Naming: SnakeCase}, nil, "null\n"},
+	}
+	for i, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		err := test.marshaller.Marshal(buf, "name", test.v)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, buf.String(), test.output, "test %d", i)
+	}
+}
+
+type jsonNamingBase struct {
+	UserID int
+	Name   string
+}
+
+type jsonNamingPtrEmbed struct {
+	*jsonNamingBase
+	Extra int
+}
+
+type jsonNamingShadow struct {
+	jsonNamingBase
+	Name string
+}
+
+type jsonNamingTaggedShadow struct {
+	jsonNamingBase
+	jsonNamingEmbed
+	Tagged int `json:"Name"`
+}
+
+type jsonNamingCycle struct {
+	Name string
+	Next *jsonNamingCycle
+}
+
+func TestRenameJSON(t *testing.T) {
+	cycle := &jsonNamingCycle{Name: "a"}
+	cycle.Next = cycle
+	cycleSlice := []interface{}{1}
+	cycleSlice[0] = cycleSlice
+	cycleMap := map[string]interface{}{}
+	cycleMap["a"] = cycleMap
+
+	type Test struct {
+		v      interface{}
+		ok     bool
+		output string
+	}
+	var tests = []Test{
+		{jsonNamingPtrEmbed{&jsonNamingBase{1, "a"}, 2}, true, `{"user_id":1,"name":"a","extra":2}`},
+		{jsonNamingPtrEmbed{nil, 2}, true, `{"extra":2}`},
+		{jsonNamingShadow{jsonNamingBase{1, "a"}, "b"}, true, `{"user_id":1,"name":"b"}`},
+		{jsonNamingTaggedShadow{jsonNamingBase{1, "a"}, jsonNamingEmbed{2}, 3}, true, `{"user_id":1,"embed_field":2,"Name":3}`},
+		{&jsonNamingCycle{Name: "a", Next: &jsonNamingCycle{Name: "b"}}, true, `{"name":"a","next":{"name":"b","next":null}}`},
+		{[]*jsonNamingCycle{cycle.Next, cycle.Next}, false, ""},
+		{cycle, false, ""},
+		{cycleSlice, false, ""},
+		{cycleMap, false, ""},
+	}
+	for i, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		err := JSONMarshaller{Naming: SnakeCase}.Marshal(buf, "name", test.v)
+		assert.MustEqual(t, err == nil, test.ok, "test %d: %s", i, err)
+		_, jsonErr := json.Marshal(test.v)
+		assert.Equal(t, jsonErr == nil, test.ok, "test %d: %s", i, jsonErr)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, buf.String(), test.output+"\n", "test %d", i)
+
+		v, err := renameJSON(reflect.ValueOf(test.v), KeepNames)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		renamed, err := json.Marshal(v)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		expect, err := json.Marshal(test.v)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, string(renamed), string(expect), "test %d", i)
+	}
+}
+
+type jsonOptionsService struct {
+	Default Service `prefix:"/default"`
+	JSONP   Service `prefix:"/jsonp"`
+	Array   Service `prefix:"/array"`
+
+	get    SimpleNode `route:"/get" method:"GET"`
+	stream Streaming  `route:"/stream" method:"GET"`
+}
+
+func (s *jsonOptionsService) Get(ctx Context) map[string]int {
+	return map[string]int{"a": 1}
+}
+
+func (s *jsonOptionsService) Stream(ctx StreamContext) {
+	ctx.Render(1)
+	ctx.Render(2)
+}
+
+func TestJSONOptionsRequest(t *testing.T) {
+	s := new(jsonOptionsService)
+	s.JSONP.RegisterMarshaller("application/json", JSONMarshaller{Callback: "callback"})
+	s.Array.RegisterMarshaller("application/json", JSONArrayMarshaller{JSONMarshaller{Callback: "callback"}})
+	r := New()
+	err := r.Add(s)
+	assert.MustEqual(t, err, nil)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	type Test struct {
+		path        string
+		code        int
+		contentType string
+		body        string
+	}
+	var tests = []Test{
+		{"/default/get", http.StatusOK, "application/json; charset=utf-8", "{\"a\":1}\n"},
+		{"/default/get?pretty", http.StatusOK, "application/json; charset=utf-8", "{\n  \"a\": 1\n}\n"},
+		{"/default/get?callback=cb", http.StatusOK, "application/json; charset=utf-8", "{\"a\":1}\n"},
+		{"/jsonp/get?callback=cb", http.StatusOK, "application/javascript; charset=utf-8", "/**/cb({\"a\":1});\n"},
+		{"/jsonp/get?callback=cb&pretty", http.StatusOK, "application/javascript; charset=utf-8", "/**/cb({\n  \"a\": 1\n});\n"},
+		{"/jsonp/get?callback=alert(1)", http.StatusBadRequest, "text/plain; charset=utf-8", ""},
+		{"/jsonp/get?callback=alert(1)//", http.StatusBadRequest, "text/plain; charset=utf-8", ""},
+		{"/jsonp/get", http.StatusOK, "application/json; charset=utf-8", "{\"a\":1}\n"},
+		{"/array/stream?callback=cb", http.StatusOK, "application/json; charset=utf-8", "[1,2]\n"},
+		{"/array/stream?pretty", http.StatusOK, "application/json; charset=utf-8", "[1,2]\n"},
+	}
+	for i, test := range tests {
+		resp, err := http.Get(server.URL + test.path)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		buf := bytes.NewBuffer(nil)
+		_, err = buf.ReadFrom(resp.Body)
+		resp.Body.Close()
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, resp.StatusCode, test.code, "test %d", i)
+		assert.Equal(t, resp.Header.Get("Content-Type"), test.contentType, "test %d", i)
+		if strings.HasPrefix(test.contentType, "application/javascript") {
+			assert.Equal(t, resp.Header.Get("X-Content-Type-Options"), "nosniff", "test %d", i)
+		}
+		if test.body != "" {
+			assert.Equal(t, buf.String(), test.body, "test %d", i)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package rest
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
+	"reflect"
 )
 
 // Marshaller is a mime type marshaller.
@@ -11,28 +14,136 @@ type Marshaller interface {
 	Unmarshal(r io.Reader, v interface{}) error
 }
 
-// RegisterMarshaller register a marshaller with corresponding mime.
+// BinaryMarshaller is a Marshaller of binary format.
+// If Binary returns true, response isn't converted to the charset negotiated by Accept-Charset,
+// and Content-Type doesn't have charset parameter.
+type BinaryMarshaller interface {
+	Marshaller
+	Binary() bool
+}
+
+func isBinaryMarshaller(m Marshaller) bool {
+	b, ok := m.(BinaryMarshaller)
+	return ok && b.Binary()
+}
+
+// RequestOnlyMarshaller is a Marshaller only for request body.
+// If RequestOnly returns true, it isn't negotiated by Accept for response.
+type RequestOnlyMarshaller interface {
+	Marshaller
+	RequestOnly() bool
+}
+
+// ResponseMarshaller is a Marshaller which can respond only in some state, like HTMLMarshaller without
+// templates. If CanRespond returns false, it isn't negotiated by Accept for response.
+type ResponseMarshaller interface {
+	Marshaller
+	CanRespond() bool
+}
+
+// TemplateMarshaller is a Marshaller rendering templates, like HTMLMarshaller.
+// If UseTemplate returns true, it's passed the template tag of handler as name instead of the handler name.
+type TemplateMarshaller interface {
+	Marshaller
+	UseTemplate() bool
+}
+
+func isTemplateMarshaller(m Marshaller) bool {
+	t, ok := m.(TemplateMarshaller)
+	return ok && t.UseTemplate()
+}
+
+// isResponseMarshaller reports whether m can be negotiated by Accept for response.
+func isResponseMarshaller(m Marshaller) bool {
+	if ro, ok := m.(RequestOnlyMarshaller); ok && ro.RequestOnly() {
+		return false
+	}
+	if rm, ok := m.(ResponseMarshaller); ok {
+		return rm.CanRespond()
+	}
+	return true
+}
+
+// RegisterMarshaller register a marshaller with corresponding mime globally.
+// mime can have parameters like "application/json; profile=compact", which matches only requests with the same
+// parameters, or be a wildcard like "image/*". Unregistered types with suffix like "application/vnd.api+json"
+// use the marshaller of "application/json".
+// Marshallers registered with Rest.RegisterMarshaller or Service.RegisterMarshaller override it.
+// It's safe to call concurrently with serving requests.
 func RegisterMarshaller(mime string, marshaller Marshaller) {
-	marshallers[mime] = marshaller
+	marshallers.register(mime, marshaller)
 }
 
 var jsonMarshaller = JSONMarshaller{}
-var marshallers = map[string]Marshaller{
+var xmlMarshaller = XMLMarshaller{}
+var htmlMarshaller = &HTMLMarshaller{ErrorTemplate: "error"}
+var marshallers = newMarshallerRegistry(map[string]Marshaller{
 	"application/json": jsonMarshaller,
-}
+	"application/xml":  xmlMarshaller,
+	"text/xml":         xmlMarshaller,
+
+	"application/x-www-form-urlencoded": FormMarshaller{},
+	"multipart/form-data":               MultipartMarshaller{},
+
+	"application/msgpack":   MsgpackMarshaller{},
+	"application/x-msgpack": MsgpackMarshaller{},
+
+	"application/cbor": CBORMarshaller{},
+
+	"application/x-ndjson": NDJSONMarshaller{},
+
+	"text/html":                 htmlMarshaller,
+	"text/plain":                TextMarshaller{},
+	"text/csv":                  CSVMarshaller{},
+	"text/tab-separated-values": CSVMarshaller{Comma: '\t'},
+})
 
 func getMarshaller(mime string) (Marshaller, bool) {
-	ret, ok := marshallers[mime]
-	return ret, ok
+	return marshallers.get(mime)
 }
 
-// JSONMarshaller is Marshaller using json.
-type JSONMarshaller struct{}
+// JSONMarshaller is Marshaller using json. Register it with options for a service or globally, like:
+//     s.Service.RegisterMarshaller("application/json", rest.JSONMarshaller{Naming: rest.SnakeCase})
+// Request with query "?pretty" gets indented json.
+type JSONMarshaller struct {
+	// Indent indents json with the string, like "  ".
+	Indent string
+	// NoEscapeHTML disables escaping <, > and & in json strings.
+	NoEscapeHTML bool
+	// Callback is the query parameter of JSONP callback function, like "callback". JSONP is disabled if empty.
+	// Response of JSONP request is application/javascript, and invalid callback is answered with 400.
+	Callback string
+	// Naming renames struct fields without json tag when marshalling.
+	Naming NamingStrategy
+
+	jsonp string // callback function of request.
+}
 
 // Marshal will marshal v and write to w, with the handler function name.
 func (j JSONMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	if j.Naming != KeepNames {
+		renamed, err := renameJSON(reflect.ValueOf(v), j.Naming)
+		if err != nil {
+			return err
+		}
+		v = renamed
+	}
+	if j.jsonp == "" {
+		return j.newEncoder(w).Encode(v)
+	}
+	var buf bytes.Buffer
+	if err := j.newEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "/**/%s(%s);\n", j.jsonp, bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return err
+}
+
+func (j JSONMarshaller) newEncoder(w io.Writer) *json.Encoder {
 	encoder := json.NewEncoder(w)
-	return encoder.Encode(v)
+	encoder.SetEscapeHTML(!j.NoEscapeHTML)
+	encoder.SetIndent("", j.Indent)
+	return encoder
 }
 
 // Unmarshal will read r and unmarshal to v.
@@ -41,3 +152,24 @@ func (j JSONMarshaller) Unmarshal(r io.Reader, v interface{}) error {
 	decoder.UseNumber()
 	return decoder.Decode(v)
 }
+
+// StrictJSONMarshaller is JSONMarshaller which rejects unknown fields of struct and data after the json value
+// when unmarshalling. Register it to enable strict mode:
+//     rest.RegisterMarshaller("application/json", rest.StrictJSONMarshaller{})
+type StrictJSONMarshaller struct {
+	JSONMarshaller
+}
+
+// Unmarshal will read r and unmarshal to v strictly.
+func (j StrictJSONMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after json value")
+	}
+	return nil
+}
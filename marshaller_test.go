@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/googollee/go-assert"
 	"io"
+	"strings"
 	"testing"
 )
 
@@ -54,3 +55,29 @@ func TestGetMarshallerConcurrency(t *testing.T) {
 		<-quit
 	}
 }
+
+func TestStrictJSONMarshaller(t *testing.T) {
+	type Value struct {
+		A int `json:"a"`
+	}
+	type Test struct {
+		input  string
+		strict bool
+		loose  bool
+	}
+	var tests = []Test{
+		{`{"a":1}`, true, true},
+		{"{\"a\":1}\n  ", true, true},
+		{`{"a":1,"b":2}`, false, true},
+		{`{"a":1}{"a":2}`, false, true},
+		{`{"a":1} xyz`, false, true},
+		{`{"a":`, false, false},
+	}
+	for i, test := range tests {
+		var v Value
+		err := StrictJSONMarshaller{}.Unmarshal(strings.NewReader(test.input), &v)
+		assert.Equal(t, err == nil, test.strict, "test %d", i)
+		err = JSONMarshaller{}.Unmarshal(strings.NewReader(test.input), &v)
+		assert.Equal(t, err == nil, test.loose, "test %d", i)
+	}
+}
@@ -0,0 +1,107 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+)
+
+// parseMediaType splits media type like "application/vnd.api+json; profile=x" to lower case "type/subtype"
+// and parameters. Names of parameters are lower case, values are unquoted.
+func parseMediaType(s string) (string, map[string]string) {
+	splits := strings.Split(s, ";")
+	base := strings.ToLower(strings.TrimSpace(splits[0]))
+	var params map[string]string
+	for _, param := range splits[1:] {
+		i := strings.Index(param, "=")
+		if i <= 0 {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		name := strings.ToLower(strings.TrimSpace(param[:i]))
+		params[name] = strings.Trim(strings.TrimSpace(param[i+1:]), `"`)
+	}
+	return base, params
+}
+
+// hasParams reports whether params contains all of want, comparing values case-insensitively.
+func hasParams(params, want map[string]string) bool {
+	for name, value := range want {
+		v, ok := params[name]
+		if !ok || !strings.EqualFold(v, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// mediaTypeSuffix returns the structured syntax suffix of base, like "json" of "application/vnd.api+json".
+func mediaTypeSuffix(base string) string {
+	i := strings.LastIndex(base, "+")
+	if i < 0 || strings.Contains(base[i:], "/") {
+		return ""
+	}
+	return base[i+1:]
+}
+
+// Scores of registered media type matching a media type, larger is better.
+const (
+	matchNone = iota
+	matchAny
+	matchWildcard
+	matchSuffix
+	matchExact
+)
+
+// matchMediaType returns how registered media type reg matches media type base with params,
+// and the number of matched parameters of reg.
+// A registration:
+//  - "type/subtype; name=value" matches only if the parameters are given with the same values.
+//  - "application/json" matches "application/vnd.api+json" by the +json suffix.
+//  - "type/*" matches any subtype of type, and "*/*" matches any type.
+func matchMediaType(reg string, base string, params map[string]string) (int, int) {
+	regBase, regParams := parseMediaType(reg)
+	if !hasParams(params, regParams) {
+		return matchNone, 0
+	}
+	switch {
+	case regBase == base:
+		return matchExact, len(regParams)
+	case regBase == "application/"+mediaTypeSuffix(base):
+		return matchSuffix, len(regParams)
+	case regBase == "*/*":
+		return matchAny, len(regParams)
+	case strings.HasSuffix(regBase, "/*") && strings.HasPrefix(base, regBase[:len(regBase)-1]):
+		return matchWildcard, len(regParams)
+	}
+	return matchNone, 0
+}
+
+// isWildcardMediaType reports whether media type has wildcard, which can't be a response Content-Type.
+func isWildcardMediaType(mime string) bool {
+	return strings.Contains(mime, "*")
+}
+
+// lookupMarshaller finds the marshaller matching media type mime in registries of request r.
+// The best match wins, see matchMediaType. With the same match, registries of service and Rest go first.
+func lookupMarshaller(r *http.Request, mime string) (Marshaller, bool) {
+	base, params := parseMediaType(mime)
+	if base == "" {
+		return nil, false
+	}
+	var ret Marshaller
+	bestScore, bestParams := matchNone, -1
+	for _, registry := range requestMarshallers(r) {
+		for _, reg := range registry.mimes() {
+			score, n := matchMediaType(reg, base, params)
+			if score == matchNone || score < bestScore || (score == bestScore && n <= bestParams) {
+				continue
+			}
+			if m, ok := registry.get(reg); ok {
+				ret, bestScore, bestParams = m, score, n
+			}
+		}
+	}
+	return ret, ret != nil
+}
@@ -0,0 +1,115 @@
+package rest
+
+import (
+	"github.com/googollee/go-assert"
+	"net/http"
+	"testing"
+)
+
+func TestParseMediaType(t *testing.T) {
+	type Test struct {
+		s      string
+		base   string
+		params map[string]string
+	}
+	var tests = []Test{
+		{"", "", nil},
+		{"Application/JSON", "application/json", nil},
+		{"application/json; Charset=UTF-8", "application/json", map[string]string{"charset": "UTF-8"}},
+		{` application/ld+json ; profile="http://a/b" ; q=0.5 `, "application/ld+json", map[string]string{"profile": "http://a/b", "q": "0.5"}},
+		{"text/plain; invalid", "text/plain", nil},
+	}
+	for i, test := range tests {
+		base, params := parseMediaType(test.s)
+		assert.Equal(t, base, test.base, "test %d", i)
+		assert.Equal(t, params, test.params, "test %d", i)
+	}
+}
+
+func TestMatchMediaType(t *testing.T) {
+	type Test struct {
+		reg    string
+		mime   string
+		score  int
+		params int
+	}
+	var tests = []Test{
+		{"application/json", "application/json", matchExact, 0},
+		{"application/json", "application/json; charset=utf-8", matchExact, 0},
+		{"application/json; profile=a", "application/json; profile=A", matchExact, 1},
+		{"application/json; profile=a", "application/json; profile=b", matchNone, 0},
+		{"application/json; profile=a", "application/json", matchNone, 0},
+		{"application/json", "application/merge-patch+json", matchSuffix, 0},
+		{"application/xml", "image/svg+xml", matchSuffix, 0},
+		{"application/json", "application/vnd.api+xml", matchNone, 0},
+		{"image/*", "image/png", matchWildcard, 0},
+		{"image/*", "text/plain", matchNone, 0},
+		{"*/*", "text/plain", matchAny, 0},
+		{"text/plain", "text/html", matchNone, 0},
+	}
+	for i, test := range tests {
+		base, params := parseMediaType(test.mime)
+		score, n := matchMediaType(test.reg, base, params)
+		assert.Equal(t, score, test.score, "test %d", i)
+		assert.Equal(t, n, test.params, "test %d", i)
+	}
+}
+
+func TestMediaTypeNegotiation(t *testing.T) {
+	compact := prefixMarshaller{"compact"}
+	image := prefixMarshaller{"image"}
+	registry := newMarshallerRegistry(map[string]Marshaller{
+		"application/json; profile=compact": compact,
+		"image/*":                           image,
+	})
+
+	type Test struct {
+		contentType string
+		ok          bool
+		marshaller  Marshaller
+	}
+	var tests = []Test{
+		{"application/json", true, jsonMarshaller},
+		{"application/json; profile=compact", true, compact},
+		{"application/json; profile=other", true, jsonMarshaller},
+		{"application/vnd.acme+json", true, jsonMarshaller},
+		{"application/vnd.acme+json; profile=compact", true, compact},
+		{"image/png", true, image},
+		{"application/vnd.acme+unknown", false, nil},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("POST", "http://domain/", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req = withMarshallers(req, registry)
+		req.Header.Set("Content-Type", test.contentType)
+		m, ok := getRequestMarshaller(nil, req)
+		assert.MustEqual(t, ok, test.ok, "test %d", i)
+		assert.Equal(t, m, test.marshaller, "test %d", i)
+	}
+
+	type AcceptTest struct {
+		accept     string
+		ok         bool
+		mime       string
+		marshaller Marshaller
+	}
+	var acceptTests = []AcceptTest{
+		{"application/json", true, "application/json", jsonMarshaller},
+		{"application/json; profile=compact", true, "application/json; profile=compact", compact},
+		{"application/json; profile=other", false, "", nil},
+		{"application/vnd.acme+json", true, "application/json", jsonMarshaller},
+		{"application/vnd.acme+json; q=0.5, application/xml", true, "application/xml", xmlMarshaller},
+		{"image/png", false, "", nil},
+		{"image/*", false, "", nil},
+	}
+	for i, test := range acceptTests {
+		req, err := http.NewRequest("GET", "http://domain/", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req = withMarshallers(req, registry)
+		req.Header.Set("Accept", test.accept)
+		mime, m, ok := getResponseMarshaller("application/json", jsonMarshaller, req)
+		assert.MustEqual(t, ok, test.ok, "test %d", i)
+		assert.Equal(t, mime, test.mime, "test %d", i)
+		assert.Equal(t, m, test.marshaller, "test %d", i)
+	}
+}
@@ -0,0 +1,656 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// MsgpackMarshaller is Marshaller using MessagePack.
+// Struct is encoded as map, with field names in json tag.
+// time.Time is encoded with timestamp extension type -1.
+// Each Render writes one value, so values can be decoded one by one from a Streaming response.
+type MsgpackMarshaller struct{}
+
+// Binary implements BinaryMarshaller.
+func (m MsgpackMarshaller) Binary() bool {
+	return true
+}
+
+// Marshal will marshal v and write to w.
+func (m MsgpackMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	var buf bytes.Buffer
+	if err := encodeMsgpack(&buf, reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Unmarshal will read one value from r and unmarshal to v.
+func (m MsgpackMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("msgpack: unmarshal to non-pointer %T", v)
+	}
+	d := &msgpackDecoder{r: r}
+	return d.decode(rv.Elem())
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func msgpackWriteUint(buf *bytes.Buffer, code byte, size int, n uint64) {
+	buf.WriteByte(code)
+	for i := size - 1; i >= 0; i-- {
+		buf.WriteByte(byte(n >> (uint(i) * 8)))
+	}
+}
+
+// msgpackWriteLen writes the header of str, bin, array or map with length n.
+// codes are fix format mask (0 if no fix format), 8-bit, 16-bit and 32-bit format codes (0 if no such format).
+func msgpackWriteLen(buf *bytes.Buffer, n int, fixMax int, codes [4]byte) error {
+	switch {
+	case n <= fixMax:
+		buf.WriteByte(codes[0] | byte(n))
+	case n <= math.MaxUint8 && codes[1] != 0:
+		msgpackWriteUint(buf, codes[1], 1, uint64(n))
+	case n <= math.MaxUint16:
+		msgpackWriteUint(buf, codes[2], 2, uint64(n))
+	case uint64(n) <= math.MaxUint32:
+		msgpackWriteUint(buf, codes[3], 4, uint64(n))
+	default:
+		return fmt.Errorf("msgpack: length %d is too large", n)
+	}
+	return nil
+}
+
+func encodeMsgpack(buf *bytes.Buffer, v reflect.Value) error {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || ((v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()) {
+		buf.WriteByte(0xc0)
+		return nil
+	}
+	if v.Type() == timeType {
+		encodeMsgpackTime(buf, v.Interface().(time.Time))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		encodeMsgpackInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		encodeMsgpackUint(buf, v.Uint())
+	case reflect.Float32:
+		msgpackWriteUint(buf, 0xca, 4, uint64(math.Float32bits(float32(v.Float()))))
+	case reflect.Float64:
+		msgpackWriteUint(buf, 0xcb, 8, math.Float64bits(v.Float()))
+	case reflect.String:
+		s := v.String()
+		if err := msgpackWriteLen(buf, len(s), 31, [4]byte{0xa0, 0xd9, 0xda, 0xdb}); err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			if err := msgpackWriteLen(buf, len(b), -1, [4]byte{0, 0xc4, 0xc5, 0xc6}); err != nil {
+				return err
+			}
+			buf.Write(b)
+			return nil
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		if err := msgpackWriteLen(buf, v.Len(), 15, [4]byte{0x90, 0, 0xdc, 0xdd}); err != nil {
+			return err
+		}
+		for i, n := 0, v.Len(); i < n; i++ {
+			if err := encodeMsgpack(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		if err := msgpackWriteLen(buf, v.Len(), 15, [4]byte{0x80, 0, 0xde, 0xdf}); err != nil {
+			return err
+		}
+		// sort entries by encoded keys, to make output stable.
+		type entry struct {
+			key   []byte
+			value reflect.Value
+		}
+		entries := make([]entry, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			var kb bytes.Buffer
+			if err := encodeMsgpack(&kb, key); err != nil {
+				return err
+			}
+			entries = append(entries, entry{kb.Bytes(), v.MapIndex(key)})
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].key, entries[j].key) < 0 })
+		for _, e := range entries {
+			buf.Write(e.key)
+			if err := encodeMsgpack(buf, e.value); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		var fields []structField
+		var values []reflect.Value
+		for _, f := range jsonFields(v.Type()) {
+			fv, ok := structFieldValue(v, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			fields = append(fields, f)
+			values = append(values, fv)
+		}
+		if err := msgpackWriteLen(buf, len(fields), 15, [4]byte{0x80, 0, 0xde, 0xdf}); err != nil {
+			return err
+		}
+		for i, f := range fields {
+			encodeMsgpack(buf, reflect.ValueOf(f.name))
+			if err := encodeMsgpack(buf, values[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func encodeMsgpackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		encodeMsgpackUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		msgpackWriteUint(buf, 0xd0, 1, uint64(i))
+	case i >= math.MinInt16:
+		msgpackWriteUint(buf, 0xd1, 2, uint64(i))
+	case i >= math.MinInt32:
+		msgpackWriteUint(buf, 0xd2, 4, uint64(i))
+	default:
+		msgpackWriteUint(buf, 0xd3, 8, uint64(i))
+	}
+}
+
+func encodeMsgpackUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u <= 0x7f:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		msgpackWriteUint(buf, 0xcc, 1, u)
+	case u <= math.MaxUint16:
+		msgpackWriteUint(buf, 0xcd, 2, u)
+	case u <= math.MaxUint32:
+		msgpackWriteUint(buf, 0xce, 4, u)
+	default:
+		msgpackWriteUint(buf, 0xcf, 8, u)
+	}
+}
+
+func encodeMsgpackTime(buf *bytes.Buffer, t time.Time) {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec <= math.MaxUint32 && nsec == 0:
+		buf.Write([]byte{0xd6, 0xff})
+		binary.Write(buf, binary.BigEndian, uint32(sec))
+	case sec >= 0 && sec < 1<<34:
+		buf.Write([]byte{0xd7, 0xff})
+		binary.Write(buf, binary.BigEndian, uint64(nsec)<<34|uint64(sec))
+	default:
+		buf.Write([]byte{0xc7, 12, 0xff})
+		binary.Write(buf, binary.BigEndian, uint32(nsec))
+		binary.Write(buf, binary.BigEndian, sec)
+	}
+}
+
+// maxDecodeDepth is the maximum nesting depth of decoded values, which stops deeply nested input
+// from overflowing the stack.
+const maxDecodeDepth = 1000
+
+type msgpackDecoder struct {
+	r     io.Reader
+	buf   [8]byte
+	depth int
+}
+
+func (d *msgpackDecoder) readN(n int) ([]byte, error) {
+	if _, err := io.ReadFull(d.r, d.buf[:n]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return d.buf[:n], nil
+}
+
+func (d *msgpackDecoder) readUint(n int) (uint64, error) {
+	b, err := d.readN(n)
+	if err != nil {
+		return 0, err
+	}
+	var ret uint64
+	for _, c := range b {
+		ret = ret<<8 | uint64(c)
+	}
+	return ret, nil
+}
+
+// readBytes reads n bytes, growing the buffer with data actually read to avoid huge allocation with bad length.
+func (d *msgpackDecoder) readBytes(n uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	got, err := io.CopyN(&buf, d.r, int64(n))
+	if err != nil && uint64(got) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), nil
+}
+
+// msgpackValue is the header of a decoded value.
+type msgpackValue struct {
+	kind   reflect.Kind // Invalid for nil, Bool, Int64, Uint64, Float64, String (str), Slice (bin), Array, Map, Struct (ext)
+	b      bool
+	i      int64
+	u      uint64
+	f      float64
+	n      uint64 // length of str, bin, array, map and ext
+	extTyp int8
+}
+
+// msgpackSizes is the size of data following format code, which is the value or the length.
+var msgpackSizes = map[byte]int{
+	0xcc: 1, 0xcd: 2, 0xce: 4, 0xcf: 8,
+	0xd0: 1, 0xd1: 2, 0xd2: 4, 0xd3: 8,
+	0xca: 4, 0xcb: 8,
+	0xd9: 1, 0xda: 2, 0xdb: 4,
+	0xc4: 1, 0xc5: 2, 0xc6: 4,
+	0xdc: 2, 0xdd: 4, 0xde: 2, 0xdf: 4,
+	0xc7: 1, 0xc8: 2, 0xc9: 4,
+}
+
+func (d *msgpackDecoder) readHeader() (msgpackValue, error) {
+	b, err := d.readN(1)
+	if err != nil {
+		return msgpackValue{}, err
+	}
+	c := b[0]
+	var ret msgpackValue
+	switch {
+	case c <= 0x7f:
+		return msgpackValue{kind: reflect.Uint64, u: uint64(c)}, nil
+	case c >= 0xe0:
+		return msgpackValue{kind: reflect.Int64, i: int64(int8(c))}, nil
+	case c&0xf0 == 0x80:
+		return msgpackValue{kind: reflect.Map, n: uint64(c & 0x0f)}, nil
+	case c&0xf0 == 0x90:
+		return msgpackValue{kind: reflect.Array, n: uint64(c & 0x0f)}, nil
+	case c&0xe0 == 0xa0:
+		return msgpackValue{kind: reflect.String, n: uint64(c & 0x1f)}, nil
+	}
+	var n uint64
+	if size, ok := msgpackSizes[c]; ok {
+		if n, err = d.readUint(size); err != nil {
+			return ret, err
+		}
+	}
+	switch c {
+	case 0xc0:
+		ret.kind = reflect.Invalid
+	case 0xc2, 0xc3:
+		ret.kind, ret.b = reflect.Bool, c == 0xc3
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		ret.kind, ret.u = reflect.Uint64, n
+	case 0xd0:
+		ret.kind, ret.i = reflect.Int64, int64(int8(n))
+	case 0xd1:
+		ret.kind, ret.i = reflect.Int64, int64(int16(n))
+	case 0xd2:
+		ret.kind, ret.i = reflect.Int64, int64(int32(n))
+	case 0xd3:
+		ret.kind, ret.i = reflect.Int64, int64(n)
+	case 0xca:
+		ret.kind, ret.f = reflect.Float64, float64(math.Float32frombits(uint32(n)))
+	case 0xcb:
+		ret.kind, ret.f = reflect.Float64, math.Float64frombits(n)
+	case 0xd9, 0xda, 0xdb:
+		ret.kind, ret.n = reflect.String, n
+	case 0xc4, 0xc5, 0xc6:
+		ret.kind, ret.n = reflect.Slice, n
+	case 0xdc, 0xdd:
+		ret.kind, ret.n = reflect.Array, n
+	case 0xde, 0xdf:
+		ret.kind, ret.n = reflect.Map, n
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xc7, 0xc8, 0xc9:
+		ret.kind = reflect.Struct
+		if c >= 0xd4 && c <= 0xd8 {
+			ret.n = 1 << (c - 0xd4)
+		} else {
+			ret.n = n
+		}
+		t, err := d.readN(1)
+		if err != nil {
+			return ret, err
+		}
+		ret.extTyp = int8(t[0])
+	default:
+		return ret, fmt.Errorf("msgpack: invalid format 0x%02x", c)
+	}
+	return ret, nil
+}
+
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	h, err := d.readHeader()
+	if err != nil {
+		return err
+	}
+	return d.decodeValue(h, v)
+}
+
+func (d *msgpackDecoder) decodeValue(h msgpackValue, v reflect.Value) error {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxDecodeDepth {
+		return fmt.Errorf("msgpack: exceeded max depth %d", maxDecodeDepth)
+	}
+	if h.kind == reflect.Invalid {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decodeValue(h, v.Elem())
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		ret, err := d.decodeInterface(h)
+		if err != nil {
+			return err
+		}
+		if ret == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(ret))
+		}
+		return nil
+	}
+	mismatch := func() error {
+		return fmt.Errorf("msgpack: can't decode %s into %s", h.kind, v.Type())
+	}
+	switch h.kind {
+	case reflect.Bool:
+		if v.Kind() != reflect.Bool {
+			return mismatch()
+		}
+		v.SetBool(h.b)
+	case reflect.Int64, reflect.Uint64, reflect.Float64:
+		return setMsgpackNumber(h, v)
+	case reflect.String, reflect.Slice:
+		b, err := d.readBytes(h.n)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(b))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(b)
+		default:
+			return mismatch()
+		}
+	case reflect.Array:
+		switch v.Kind() {
+		case reflect.Slice:
+			ret := reflect.MakeSlice(v.Type(), 0, int(minUint64(h.n, 1024)))
+			for i := uint64(0); i < h.n; i++ {
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := d.decode(elem); err != nil {
+					return err
+				}
+				ret = reflect.Append(ret, elem)
+			}
+			v.Set(ret)
+		case reflect.Array:
+			if h.n != uint64(v.Len()) {
+				return fmt.Errorf("msgpack: can't decode array of %d into %s", h.n, v.Type())
+			}
+			for i := 0; i < v.Len(); i++ {
+				if err := d.decode(v.Index(i)); err != nil {
+					return err
+				}
+			}
+		default:
+			return mismatch()
+		}
+	case reflect.Map:
+		switch v.Kind() {
+		case reflect.Map:
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			for i := uint64(0); i < h.n; i++ {
+				key := reflect.New(v.Type().Key()).Elem()
+				if err := d.decode(key); err != nil {
+					return err
+				}
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := d.decode(elem); err != nil {
+					return err
+				}
+				v.SetMapIndex(key, elem)
+			}
+		case reflect.Struct:
+			for i := uint64(0); i < h.n; i++ {
+				var name string
+				if err := d.decode(reflect.ValueOf(&name).Elem()); err != nil {
+					return err
+				}
+				field := findJSONField(v.Type(), name)
+				if field == nil {
+					if err := d.skip(); err != nil {
+						return err
+					}
+					continue
+				}
+				fv, err := structFieldAlloc(v, field.index)
+				if err != nil {
+					return fmt.Errorf("msgpack: %s", err)
+				}
+				if err := d.decode(fv); err != nil {
+					return err
+				}
+			}
+		default:
+			return mismatch()
+		}
+	case reflect.Struct:
+		if v.Type() != timeType {
+			return mismatch()
+		}
+		t, err := d.decodeExt(h)
+		if err != nil {
+			return err
+		}
+		tm, ok := t.(time.Time)
+		if !ok {
+			return mismatch()
+		}
+		v.Set(reflect.ValueOf(tm))
+	}
+	return nil
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func setMsgpackNumber(h msgpackValue, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch h.kind {
+		case reflect.Int64:
+			i = h.i
+		case reflect.Uint64:
+			if h.u > math.MaxInt64 {
+				return fmt.Errorf("msgpack: %d overflows %s", h.u, v.Type())
+			}
+			i = int64(h.u)
+		default:
+			return fmt.Errorf("msgpack: can't decode float into %s", v.Type())
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("msgpack: %d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch h.kind {
+		case reflect.Uint64:
+			u = h.u
+		case reflect.Int64:
+			if h.i < 0 {
+				return fmt.Errorf("msgpack: %d overflows %s", h.i, v.Type())
+			}
+			u = uint64(h.i)
+		default:
+			return fmt.Errorf("msgpack: can't decode float into %s", v.Type())
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("msgpack: %d overflows %s", u, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch h.kind {
+		case reflect.Int64:
+			v.SetFloat(float64(h.i))
+		case reflect.Uint64:
+			v.SetFloat(float64(h.u))
+		default:
+			v.SetFloat(h.f)
+		}
+	default:
+		return fmt.Errorf("msgpack: can't decode number into %s", v.Type())
+	}
+	return nil
+}
+
+// decodeInterface decodes value with header h to interface{}.
+// Maps with string keys are decoded to map[string]interface{}, other maps to map[interface{}]interface{}.
+func (d *msgpackDecoder) decodeInterface(h msgpackValue) (interface{}, error) {
+	switch h.kind {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Bool:
+		return h.b, nil
+	case reflect.Int64:
+		return h.i, nil
+	case reflect.Uint64:
+		if h.u <= math.MaxInt64 {
+			return int64(h.u), nil
+		}
+		return h.u, nil
+	case reflect.Float64:
+		return h.f, nil
+	case reflect.String:
+		b, err := d.readBytes(h.n)
+		return string(b), err
+	case reflect.Slice:
+		return d.readBytes(h.n)
+	case reflect.Array:
+		ret := make([]interface{}, 0, int(minUint64(h.n, 1024)))
+		for i := uint64(0); i < h.n; i++ {
+			var elem interface{}
+			if err := d.decode(reflect.ValueOf(&elem).Elem()); err != nil {
+				return nil, err
+			}
+			ret = append(ret, elem)
+		}
+		return ret, nil
+	case reflect.Map:
+		ret := make(map[interface{}]interface{})
+		stringKeys := true
+		for i := uint64(0); i < h.n; i++ {
+			var key, elem interface{}
+			if err := d.decode(reflect.ValueOf(&key).Elem()); err != nil {
+				return nil, err
+			}
+			if err := d.decode(reflect.ValueOf(&elem).Elem()); err != nil {
+				return nil, err
+			}
+			if _, ok := key.(string); !ok {
+				stringKeys = false
+			}
+			if key != nil && !reflect.TypeOf(key).Comparable() {
+				return nil, fmt.Errorf("msgpack: invalid map key type %T", key)
+			}
+			ret[key] = elem
+		}
+		if !stringKeys {
+			return ret, nil
+		}
+		m := make(map[string]interface{}, len(ret))
+		for k, v := range ret {
+			m[k.(string)] = v
+		}
+		return m, nil
+	case reflect.Struct:
+		return d.decodeExt(h)
+	}
+	return nil, fmt.Errorf("msgpack: invalid value")
+}
+
+// decodeExt decodes ext value. Timestamp (type -1) returns time.Time, other types return raw bytes.
+func (d *msgpackDecoder) decodeExt(h msgpackValue) (interface{}, error) {
+	b, err := d.readBytes(h.n)
+	if err != nil {
+		return nil, err
+	}
+	if h.extTyp != -1 {
+		return b, nil
+	}
+	switch len(b) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(b)), 0).UTC(), nil
+	case 8:
+		n := binary.BigEndian.Uint64(b)
+		return time.Unix(int64(n&(1<<34-1)), int64(n>>34)).UTC(), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(b[4:])), int64(binary.BigEndian.Uint32(b))).UTC(), nil
+	}
+	return nil, fmt.Errorf("msgpack: invalid timestamp length %d", len(b))
+}
+
+// skip reads and drops next value.
+func (d *msgpackDecoder) skip() error {
+	var v interface{}
+	return d.decode(reflect.ValueOf(&v).Elem())
+}
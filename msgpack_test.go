@@ -0,0 +1,182 @@
+package rest
+
+import (
+	"bytes"
+	"github.com/googollee/go-assert"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type msgpackUser struct {
+	ID    int       `json:"id"`
+	Name  string    `json:"name"`
+	Email string    `json:"email,omitempty"`
+	Skip  string    `json:"-"`
+	Tags  []string  `json:"tags"`
+	Time  time.Time `json:"time"`
+}
+
+func TestMsgpackMarshal(t *testing.T) {
+	type Test struct {
+		v    interface{}
+		data []byte
+	}
+	var tests = []Test{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{false, []byte{0xc2}},
+		{1, []byte{0x01}},
+		{-1, []byte{0xff}},
+		{-33, []byte{0xd0, 0xdf}},
+		{200, []byte{0xcc, 0xc8}},
+		{-200, []byte{0xd1, 0xff, 0x38}},
+		{70000, []byte{0xce, 0x00, 0x01, 0x11, 0x70}},
+		{uint64(math.MaxUint64), []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{int64(math.MinInt64), []byte{0xd3, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{float32(1.5), []byte{0xca, 0x3f, 0xc0, 0x00, 0x00}},
+		{1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"abc", []byte{0xa3, 'a', 'b', 'c'}},
+		{strings.Repeat("a", 32), append([]byte{0xd9, 32}, strings.Repeat("a", 32)...)},
+		{[]byte{1, 2}, []byte{0xc4, 2, 1, 2}},
+		{[]int{1, 2}, []byte{0x92, 1, 2}},
+		{[]int(nil), []byte{0xc0}},
+		{map[string]int{"b": 2, "a": 1}, []byte{0x82, 0xa1, 'a', 1, 0xa1, 'b', 2}},
+		{&msgpackUser{ID: 1, Name: "a", Skip: "x", Time: time.Unix(1, 0)}, []byte{0x84,
+			0xa2, 'i', 'd', 1,
+			0xa4, 'n', 'a', 'm', 'e', 0xa1, 'a',
+			0xa4, 't', 'a', 'g', 's', 0xc0,
+			0xa4, 't', 'i', 'm', 'e', 0xd6, 0xff, 0, 0, 0, 1}},
+		{time.Unix(1, 1), []byte{0xd7, 0xff, 0, 0, 0, 0x04, 0, 0, 0, 0x01}},
+		{time.Unix(-1, 0), []byte{0xc7, 12, 0xff, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		err := MsgpackMarshaller{}.Marshal(&buf, "test", test.v)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, buf.Bytes(), test.data, "test %d", i)
+	}
+
+	var buf bytes.Buffer
+	err := MsgpackMarshaller{}.Marshal(&buf, "test", make(chan int))
+	assert.NotEqual(t, err, nil)
+}
+
+func TestMsgpackUnmarshal(t *testing.T) {
+	type Test struct {
+		data   []byte
+		t      reflect.Type
+		ok     bool
+		target interface{}
+	}
+	var tests = []Test{
+		{[]byte{0x01}, reflect.TypeOf(0), true, 1},
+		{[]byte{0xd0, 0xdf}, reflect.TypeOf(int8(0)), true, int8(-33)},
+		{[]byte{0xcc, 0xc8}, reflect.TypeOf(int8(0)), false, nil},
+		{[]byte{0xff}, reflect.TypeOf(uint(0)), false, nil},
+		{[]byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, reflect.TypeOf(0.0), true, 1.5},
+		{[]byte{0x01}, reflect.TypeOf(0.0), true, 1.0},
+		{[]byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, reflect.TypeOf(0), false, nil},
+		{[]byte{0xa3, 'a', 'b', 'c'}, reflect.TypeOf(""), true, "abc"},
+		{[]byte{0xc4, 2, 1, 2}, reflect.TypeOf([]byte{}), true, []byte{1, 2}},
+		{[]byte{0x92, 1, 2}, reflect.TypeOf([]int{}), true, []int{1, 2}},
+		{[]byte{0x92, 1, 2}, reflect.TypeOf([2]int{}), true, [2]int{1, 2}},
+		{[]byte{0x92, 1, 2}, reflect.TypeOf([3]int{}), false, nil},
+		{[]byte{0x82, 0xa1, 'a', 1, 0xa1, 'b', 2}, reflect.TypeOf(map[string]int{}), true, map[string]int{"a": 1, "b": 2}},
+		{[]byte{0xc0}, reflect.TypeOf(&msgpackUser{}), true, (*msgpackUser)(nil)},
+		{[]byte{0x83, 0xa2, 'I', 'D', 1, 0xa1, 'x', 0x91, 0x01, 0xa4, 't', 'i', 'm', 'e', 0xd6, 0xff, 0, 0, 0, 1}, reflect.TypeOf(msgpackUser{}), true, msgpackUser{ID: 1, Time: time.Unix(1, 0).UTC()}},
+		{[]byte{0x92, 0x01, 0x81, 0xa1, 'a', 0xc3}, reflect.TypeOf([]interface{}{}), true, []interface{}{int64(1), map[string]interface{}{"a": true}}},
+		{[]byte{0x81, 0x01, 0xa1, 'a'}, reflect.TypeOf(map[interface{}]interface{}{}), true, map[interface{}]interface{}{int64(1): "a"}},
+		{[]byte{0xd7, 0xff, 0, 0, 0, 0x04, 0, 0, 0, 0x01}, reflect.TypeOf(time.Time{}), true, time.Unix(1, 1).UTC()},
+		{[]byte{0xc7, 12, 0xff, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, reflect.TypeOf(time.Time{}), true, time.Unix(-1, 0).UTC()},
+		{[]byte{0xa3, 'a'}, reflect.TypeOf(""), false, nil},
+		{[]byte{0xdb, 0xff, 0xff, 0xff, 0xff}, reflect.TypeOf(""), false, nil},
+		{[]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, reflect.TypeOf([]int{}), false, nil},
+		{[]byte{0xc1}, reflect.TypeOf(0), false, nil},
+		{[]byte{}, reflect.TypeOf(0), false, nil},
+	}
+	for i, test := range tests {
+		v := reflect.New(test.t)
+		err := MsgpackMarshaller{}.Unmarshal(bytes.NewReader(test.data), v.Interface())
+		assert.MustEqual(t, err == nil, test.ok, "test %d", i)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, v.Elem().Interface(), test.target, "test %d", i)
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	user := msgpackUser{ID: 10, Name: "rest", Email: "a@b", Tags: []string{"x", "y"}, Time: time.Unix(1234567890, 123).UTC()}
+	var buf bytes.Buffer
+	m := MsgpackMarshaller{}
+	err := m.Marshal(&buf, "test", user)
+	assert.MustEqual(t, err, nil)
+	err = m.Marshal(&buf, "test", 2)
+	assert.MustEqual(t, err, nil)
+
+	var got msgpackUser
+	err = m.Unmarshal(&buf, &got)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, got, user)
+	var i int
+	err = m.Unmarshal(&buf, &i)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, i, 2)
+
+	embed := jsonNamingPtrEmbed{&jsonNamingBase{1, "a"}, 2}
+	err = m.Marshal(&buf, "test", embed)
+	assert.MustEqual(t, err, nil)
+	gotEmbed := jsonNamingPtrEmbed{jsonNamingBase: new(jsonNamingBase)}
+	err = m.Unmarshal(&buf, &gotEmbed)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, gotEmbed, embed)
+}
+
+func TestMsgpackUnmarshalDepth(t *testing.T) {
+	type Test struct {
+		data []byte
+		ok   bool
+	}
+	var tests = []Test{
+		{append(bytes.Repeat([]byte{0x91}, 100), 0xc0), true},
+		{append(bytes.Repeat([]byte{0x91}, 1<<20), 0xc0), false},
+		{append(bytes.Repeat([]byte{0x81, 0xa1, 'a'}, 1<<20), 0xc0), false},
+	}
+	for i, test := range tests {
+		var v interface{}
+		err := MsgpackMarshaller{}.Unmarshal(bytes.NewReader(test.data), &v)
+		assert.Equal(t, err == nil, test.ok, "test %d: %s", i, err)
+		var s []interface{}
+		err = MsgpackMarshaller{}.Unmarshal(bytes.NewReader(test.data), &s)
+		assert.Equal(t, err == nil, test.ok, "test %d: %s", i, err)
+	}
+}
+
+func TestMsgpackHandler(t *testing.T) {
+	f := reflect.ValueOf(func(ctx Context, arg []int) map[string]int {
+		return map[string]int{"sum": arg[0] + arg[1]}
+	})
+	handler := &baseHandler{
+		name:            "Sum",
+		mime:            "application/json",
+		marshaller:      jsonMarshaller,
+		inputType:       f.Type().In(1),
+		f:               f,
+		compressMinSize: -1,
+	}
+	req, err := http.NewRequest("POST", "http://domain/", bytes.NewReader([]byte{0x92, 1, 2}))
+	assert.MustEqual(t, err, nil)
+	req.Header.Set("Content-Type", "application/msgpack")
+	req.Header.Set("Accept", "application/x-msgpack")
+	req.Header.Set("Accept-Charset", "utf-16")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req, nil)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Header().Get("Content-Type"), "application/x-msgpack")
+	assert.Equal(t, resp.Body.Bytes(), []byte{0x81, 0xa3, 's', 'u', 'm', 3})
+}
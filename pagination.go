@@ -0,0 +1,136 @@
+package rest
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Page is the pagination parameters of request, bound by Context.Paginate.
+// Handlers paginating with cursor should set NextCursor and PrevCursor before calling Context.RenderPage.
+type Page struct {
+	// Number is the page number, starting from 1.
+	Number int
+	// PerPage is the number of items in one page.
+	PerPage int
+	// Cursor is the opaque cursor in request. It's "" when requesting the first page.
+	Cursor string
+
+	// NextCursor is the cursor of next page, "" means no next page.
+	NextCursor string
+	// PrevCursor is the cursor of previous page, "" means no previous page.
+	PrevCursor string
+}
+
+// Offset returns the number of items before this page.
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.PerPage
+}
+
+func (p Page) useCursor() bool {
+	return p.Cursor != "" || p.NextCursor != "" || p.PrevCursor != ""
+}
+
+// bindPage parses query parameters page, per_page and cursor.
+func bindPage(query url.Values, defaultPerPage, maxPerPage int) (Page, error) {
+	ret := Page{
+		Number:  1,
+		PerPage: defaultPerPage,
+		Cursor:  query.Get("cursor"),
+	}
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return ret, fmt.Errorf("page(%s) is invalid", v)
+		}
+		ret.Number = n
+	}
+	if v := query.Get("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return ret, fmt.Errorf("per_page(%s) is invalid", v)
+		}
+		ret.PerPage = n
+	}
+	if maxPerPage > 0 && ret.PerPage > maxPerPage {
+		ret.PerPage = maxPerPage
+	}
+	return ret, nil
+}
+
+// pageLinks returns the value of Link header (RFC 8288) of page in u.
+// total is the number of all items, or negative if unknown. count is the number of items in this page.
+func pageLinks(u *url.URL, page Page, total, count int) string {
+	var links []string
+	add := func(rel string, set func(query url.Values)) {
+		query := u.Query()
+		query.Set("per_page", strconv.Itoa(page.PerPage))
+		query.Del("page")
+		query.Del("cursor")
+		set(query)
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, u.EscapedPath(), query.Encode(), rel))
+	}
+	setPage := func(n int) func(url.Values) {
+		return func(query url.Values) {
+			query.Set("page", strconv.Itoa(n))
+		}
+	}
+	setCursor := func(cursor string) func(url.Values) {
+		return func(query url.Values) {
+			query.Set("cursor", cursor)
+		}
+	}
+
+	if page.useCursor() {
+		add("first", func(url.Values) {})
+		if page.PrevCursor != "" {
+			add("prev", setCursor(page.PrevCursor))
+		}
+		if page.NextCursor != "" {
+			add("next", setCursor(page.NextCursor))
+		}
+		return strings.Join(links, ", ")
+	}
+
+	last := 0
+	if total >= 0 && page.PerPage > 0 {
+		last = (total + page.PerPage - 1) / page.PerPage
+		if last < 1 {
+			last = 1
+		}
+	}
+	add("first", setPage(1))
+	if page.Number > 1 {
+		add("prev", setPage(page.Number-1))
+	}
+	if (last > 0 && page.Number < last) || (last == 0 && count >= page.PerPage) {
+		add("next", setPage(page.Number+1))
+	}
+	if last > 0 {
+		add("last", setPage(last))
+	}
+	return strings.Join(links, ", ")
+}
+
+func (ctx *baseContext) Paginate(defaultPerPage, maxPerPage int) Page {
+	page, err := bindPage(ctx.request.URL.Query(), defaultPerPage, maxPerPage)
+	if err != nil && ctx.bindError == nil {
+		ctx.bindError = err
+	}
+	return page
+}
+
+func (ctx *baseContext) RenderPage(v interface{}, page Page, total int) error {
+	count := -1
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		count = rv.Len()
+	}
+	header := ctx.Response().Header()
+	header.Set("Link", pageLinks(ctx.request.URL, page, total, count))
+	if total >= 0 {
+		header.Set("X-Total-Count", strconv.Itoa(total))
+	}
+	return ctx.Render(v)
+}
@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"github.com/googollee/go-assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestBindPage(t *testing.T) {
+	type Test struct {
+		query string
+		ok    bool
+		page  Page
+	}
+	var tests = []Test{
+		{"", true, Page{Number: 1, PerPage: 20}},
+		{"page=3&per_page=10", true, Page{Number: 3, PerPage: 10}},
+		{"per_page=1000", true, Page{Number: 1, PerPage: 100}},
+		{"cursor=abc", true, Page{Number: 1, PerPage: 20, Cursor: "abc"}},
+		{"page=0", false, Page{Number: 1, PerPage: 20}},
+		{"page=abc", false, Page{Number: 1, PerPage: 20}},
+		{"per_page=-1", false, Page{Number: 1, PerPage: 20}},
+	}
+	for i, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		page, err := bindPage(query, 20, 100)
+		assert.Equal(t, err == nil, test.ok, "test %d", i)
+		assert.Equal(t, page, test.page, "test %d", i)
+	}
+}
+
+func TestPageLinks(t *testing.T) {
+	type Test struct {
+		url   string
+		page  Page
+		total int
+		count int
+		links string
+	}
+	var tests = []Test{
+		{"/users", Page{Number: 1, PerPage: 10}, 25, 10,
+			`</users?page=1&per_page=10>; rel="first", </users?page=2&per_page=10>; rel="next", </users?page=3&per_page=10>; rel="last"`},
+		{"/users?page=2&per_page=10&sort=name", Page{Number: 2, PerPage: 10}, 25, 10,
+			`</users?page=1&per_page=10&sort=name>; rel="first", </users?page=1&per_page=10&sort=name>; rel="prev", </users?page=3&per_page=10&sort=name>; rel="next", </users?page=3&per_page=10&sort=name>; rel="last"`},
+		{"/users?page=3&per_page=10", Page{Number: 3, PerPage: 10}, 25, 5,
+			`</users?page=1&per_page=10>; rel="first", </users?page=2&per_page=10>; rel="prev", </users?page=3&per_page=10>; rel="last"`},
+		{"/users", Page{Number: 1, PerPage: 10}, 0, 0,
+			`</users?page=1&per_page=10>; rel="first", </users?page=1&per_page=10>; rel="last"`},
+		{"/users", Page{Number: 1, PerPage: 10}, -1, 10,
+			`</users?page=1&per_page=10>; rel="first", </users?page=2&per_page=10>; rel="next"`},
+		{"/users?page=2", Page{Number: 2, PerPage: 10}, -1, 3,
+			`</users?page=1&per_page=10>; rel="first", </users?page=1&per_page=10>; rel="prev"`},
+		{"/groups/a%20b/users?cursor=c2", Page{Number: 1, PerPage: 10, Cursor: "c2", PrevCursor: "c1", NextCursor: "c3"}, -1, 10,
+			`</groups/a%20b/users?per_page=10>; rel="first", </groups/a%20b/users?cursor=c1&per_page=10>; rel="prev", </groups/a%20b/users?cursor=c3&per_page=10>; rel="next"`},
+	}
+	for i, test := range tests {
+		u, err := url.Parse(test.url)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, pageLinks(u, test.page, test.total, test.count), test.links, "test %d", i)
+	}
+}
+
+func TestContextPagination(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://domain/users?page=2&per_page=2", nil)
+	assert.MustEqual(t, err, nil)
+	resp := httptest.NewRecorder()
+	ctx := newBaseContext("test", nil, "", nil, req, resp)
+	page := ctx.Paginate(10, 100)
+	assert.Equal(t, ctx.BindError(), nil)
+	assert.Equal(t, page.Offset(), 2)
+	err = ctx.RenderPage([]int{3, 4}, page, 5)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, resp.Body.String(), "[3,4]\n")
+	assert.Equal(t, resp.Header().Get("X-Total-Count"), "5")
+	assert.Equal(t, resp.Header().Get("Link"), `</users?page=1&per_page=2>; rel="first", </users?page=1&per_page=2>; rel="prev", </users?page=3&per_page=2>; rel="next", </users?page=3&per_page=2>; rel="last"`)
+
+	req, err = http.NewRequest("GET", "http://domain/users?page=x", nil)
+	assert.MustEqual(t, err, nil)
+	resp = httptest.NewRecorder()
+	ctx = newBaseContext("test", nil, "", nil, req, resp)
+	ctx.Paginate(10, 100)
+	assert.NotEqual(t, ctx.BindError(), nil)
+}
@@ -0,0 +1,64 @@
+package rest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Raw is a response body written directly without marshaller and charset conversion.
+// Body can be []byte, string, io.Reader or io.WriterTo. If it's an io.Closer, it's closed after writing.
+// ContentType overrides the Content-Type of response. If it's empty and the handler doesn't set Content-Type,
+// application/octet-stream is used.
+// Example:
+//     return rest.Raw{ContentType: "application/pdf", Body: file}, nil
+type Raw struct {
+	ContentType string
+	Body        interface{}
+}
+
+// rawBody returns v as Raw if it should be written without marshaller.
+func rawBody(v interface{}) (Raw, bool) {
+	switch b := v.(type) {
+	case Raw:
+		return b, true
+	case *Raw:
+		if b != nil {
+			return *b, true
+		}
+	case []byte, io.Reader, io.WriterTo:
+		return Raw{Body: v}, true
+	}
+	return Raw{}, false
+}
+
+// setRawContentType sets Content-Type of raw body to header.
+// defaultType is the Content-Type set by framework, which is replaced with application/octet-stream.
+func setRawContentType(header http.Header, raw Raw, defaultType string) {
+	switch {
+	case raw.ContentType != "":
+		header.Set("Content-Type", raw.ContentType)
+	case header.Get("Content-Type") == defaultType:
+		header.Set("Content-Type", "application/octet-stream")
+	}
+}
+
+func writeRawBody(w io.Writer, body interface{}) error {
+	if c, ok := body.(io.Closer); ok {
+		defer c.Close()
+	}
+	var err error
+	switch b := body.(type) {
+	case []byte:
+		_, err = w.Write(b)
+	case string:
+		_, err = io.WriteString(w, b)
+	case io.Reader:
+		_, err = io.Copy(w, b)
+	case io.WriterTo:
+		_, err = b.WriteTo(w)
+	default:
+		err = fmt.Errorf("unsupported raw body type %T", body)
+	}
+	return err
+}
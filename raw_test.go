@@ -0,0 +1,88 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/googollee/go-assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type rawCloser struct {
+	io.Reader
+	closed bool
+}
+
+func (c *rawCloser) Close() error {
+	c.closed = true
+	return nil
+}
+
+type rawWriterTo string
+
+func (w rawWriterTo) WriteTo(writer io.Writer) (int64, error) {
+	n, err := io.WriteString(writer, string(w))
+	return int64(n), err
+}
+
+type rawFailReader struct{}
+
+func (r rawFailReader) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("read failed")
+}
+
+func TestBaseHandlerRaw(t *testing.T) {
+	closer := &rawCloser{Reader: strings.NewReader("closer")}
+	type Test struct {
+		f        reflect.Value
+		buffered bool
+
+		code        int
+		contentType string
+		body        string
+	}
+	var tests = []Test{
+		{reflect.ValueOf(func(ctx Context) []byte { return []byte("bytes") }), false, http.StatusOK, "application/octet-stream", "bytes"},
+		{reflect.ValueOf(func(ctx Context) io.Reader { return strings.NewReader("reader") }), false, http.StatusOK, "application/octet-stream", "reader"},
+		{reflect.ValueOf(func(ctx Context) io.Reader { return closer }), false, http.StatusOK, "application/octet-stream", "closer"},
+		{reflect.ValueOf(func(ctx Context) rawWriterTo { return "writer to" }), false, http.StatusOK, "application/octet-stream", "writer to"},
+		{reflect.ValueOf(func(ctx Context) (Raw, error) {
+			return Raw{ContentType: "application/pdf", Body: bytes.NewBufferString("%PDF")}, nil
+		}), false, http.StatusOK, "application/pdf", "%PDF"},
+		{reflect.ValueOf(func(ctx Context) (int, *Raw, error) {
+			return http.StatusCreated, &Raw{ContentType: "text/plain; charset=utf-8", Body: "created"}, nil
+		}), false, http.StatusCreated, "text/plain; charset=utf-8", "created"},
+		{reflect.ValueOf(func(ctx Context) []byte {
+			ctx.Response().Header().Set("Content-Type", "image/png")
+			return []byte("png")
+		}), false, http.StatusOK, "image/png", "png"},
+		{reflect.ValueOf(func(ctx Context) json.RawMessage { return json.RawMessage(`{"a":1}`) }), false, http.StatusOK, "application/json; charset=utf-16", "\xfe\xff\x00{\x00\"\x00a\x00\"\x00:\x001\x00}\x00\n"},
+		{reflect.ValueOf(func(ctx Context) io.Reader { return rawFailReader{} }), true, http.StatusInternalServerError, "text/plain; charset=utf-8", ""},
+	}
+	for i, test := range tests {
+		handler := &baseHandler{
+			name:            "Raw",
+			mime:            "application/json",
+			marshaller:      jsonMarshaller,
+			f:               test.f,
+			compressMinSize: -1,
+			buffered:        test.buffered,
+		}
+		req, err := http.NewRequest("GET", "http://domain/", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header.Set("Accept-Charset", "utf-16")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req, nil)
+		assert.Equal(t, resp.Code, test.code, "test %d", i)
+		assert.Equal(t, resp.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		if test.body != "" {
+			assert.Equal(t, resp.Body.String(), test.body, "test %d", i)
+		}
+	}
+	assert.Equal(t, closer.closed, true)
+}
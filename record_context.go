@@ -32,6 +32,12 @@ func (ctx *RecordContext) Render(v interface{}) error {
 	return ctx.Context.Render(v)
 }
 
+// RenderStatus implement Context's RenderStatus.
+func (ctx *RecordContext) RenderStatus(code int, v interface{}) error {
+	ctx.Renders = append(ctx.Renders, v)
+	return ctx.Context.RenderStatus(code, v)
+}
+
 // Ping implement StreamContext's Ping.
 func (ctx *RecordContext) Ping() error {
 	return nil
@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// marshallerRegistry is a set of marshallers with mime, safe for concurrent use.
+type marshallerRegistry struct {
+	locker      sync.RWMutex
+	marshallers map[string]Marshaller
+}
+
+func newMarshallerRegistry(marshallers map[string]Marshaller) *marshallerRegistry {
+	if marshallers == nil {
+		marshallers = make(map[string]Marshaller)
+	}
+	return &marshallerRegistry{
+		marshallers: marshallers,
+	}
+}
+
+func (r *marshallerRegistry) register(mime string, marshaller Marshaller) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.marshallers[mime] = marshaller
+}
+
+func (r *marshallerRegistry) get(mime string) (Marshaller, bool) {
+	r.locker.RLock()
+	defer r.locker.RUnlock()
+	ret, ok := r.marshallers[mime]
+	return ret, ok
+}
+
+func (r *marshallerRegistry) mimes() []string {
+	r.locker.RLock()
+	defer r.locker.RUnlock()
+	ret := make([]string, 0, len(r.marshallers))
+	for mime := range r.marshallers {
+		ret = append(ret, mime)
+	}
+	return ret
+}
+
+type marshallersKey struct{}
+
+// withMarshallers returns request with registry m, which is looked up before registries already in r.
+func withMarshallers(r *http.Request, m *marshallerRegistry) *http.Request {
+	registries, _ := r.Context().Value(marshallersKey{}).([]*marshallerRegistry)
+	registries = append([]*marshallerRegistry{m}, registries...)
+	return r.WithContext(context.WithValue(r.Context(), marshallersKey{}, registries))
+}
+
+// requestMarshallers returns registries of request r in lookup order, the global one is the last.
+func requestMarshallers(r *http.Request) []*marshallerRegistry {
+	registries, _ := r.Context().Value(marshallersKey{}).([]*marshallerRegistry)
+	return append(registries[:len(registries):len(registries)], marshallers)
+}
+
+// resolveMarshaller returns mime and the marshaller registered with it for request r,
+// or fallbackMime and fallback if mime isn't registered.
+func resolveMarshaller(r *http.Request, mime string, fallbackMime string, fallback Marshaller) (string, Marshaller) {
+	if mime != "" {
+		if ret, ok := lookupMarshaller(r, mime); ok {
+			return mime, ret
+		}
+	}
+	return fallbackMime, fallback
+}
+
+// marshallerMimes returns all mimes registered for request r in order, with defaultMime as the first one.
+// Wildcard mimes like image/* and request only marshallers are excluded.
+// application/json goes before others, so a wildcard like application/* prefers json.
+func marshallerMimes(r *http.Request, defaultMime string) []string {
+	seen := map[string]bool{defaultMime: true}
+	var ret []string
+	for _, registry := range requestMarshallers(r) {
+		for _, mime := range registry.mimes() {
+			if seen[mime] || isWildcardMediaType(mime) {
+				continue
+			}
+			seen[mime] = true
+			if m, ok := registry.get(mime); ok && !isResponseMarshaller(m) {
+				continue
+			}
+			ret = append(ret, mime)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if (ret[i] == "application/json") != (ret[j] == "application/json") {
+			return ret[i] == "application/json"
+		}
+		return ret[i] < ret[j]
+	})
+	return append([]string{defaultMime}, ret...)
+}
+
+// scopedHandler serves handler with marshallers registered in its service.
+type scopedHandler struct {
+	Handler
+	marshallers *marshallerRegistry
+}
+
+func (h scopedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+	h.Handler.ServeHTTP(w, withMarshallers(r, h.marshallers), vars)
+}
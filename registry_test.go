@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/googollee/go-assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type prefixMarshaller struct {
+	prefix string
+}
+
+func (m prefixMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	_, err := fmt.Fprintf(w, "%s:%v", m.prefix, v)
+	return err
+}
+
+func (m prefixMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	return fmt.Errorf("not supported")
+}
+
+type registryService struct {
+	Users  Service `prefix:"/users"`
+	Orders Service `prefix:"/orders" mime:"application/vnd.orders"`
+
+	get SimpleNode `method:"GET"`
+}
+
+func (s *registryService) Get(ctx Context) string {
+	return "ok"
+}
+
+func TestMarshallerRegistry(t *testing.T) {
+	registry := newMarshallerRegistry(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			registry.register(fmt.Sprintf("text/%d", i), prefixMarshaller{})
+			registry.get("text/0")
+			registry.mimes()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, len(registry.mimes()), 10)
+
+	req, err := http.NewRequest("GET", "http://domain/", nil)
+	assert.MustEqual(t, err, nil)
+	restRegistry := newMarshallerRegistry(map[string]Marshaller{
+		"application/json": prefixMarshaller{"rest"},
+		"text/rest":        prefixMarshaller{"rest"},
+	})
+	serviceRegistry := newMarshallerRegistry(map[string]Marshaller{
+		"application/json": prefixMarshaller{"service"},
+	})
+	scoped := withMarshallers(withMarshallers(req, restRegistry), serviceRegistry)
+
+	type Test struct {
+		r          *http.Request
+		mime       string
+		ok         bool
+		marshaller Marshaller
+	}
+	var tests = []Test{
+		{req, "application/json", true, jsonMarshaller},
+		{req, "text/rest", false, nil},
+		{scoped, "application/json", true, prefixMarshaller{"service"}},
+		{scoped, "text/rest", true, prefixMarshaller{"rest"}},
+		{scoped, "application/xml", true, xmlMarshaller},
+		{scoped, "non/exist", false, nil},
+	}
+	for i, test := range tests {
+		m, ok := lookupMarshaller(test.r, test.mime)
+		assert.MustEqual(t, ok, test.ok, "test %d", i)
+		assert.Equal(t, m, test.marshaller, "test %d", i)
+	}
+
+	mimes := marshallerMimes(scoped, "text/rest")
+	assert.Equal(t, mimes[0], "text/rest")
+	assert.Equal(t, mimes[1], "application/json")
+	assert.Equal(t, len(mimes), len(marshallerMimes(req, "text/rest")))
+
+	mime, m := resolveMarshaller(scoped, "text/rest", "application/json", jsonMarshaller)
+	assert.Equal(t, mime, "text/rest")
+	assert.Equal(t, m, prefixMarshaller{"rest"})
+	mime, m = resolveMarshaller(req, "text/rest", "application/json", jsonMarshaller)
+	assert.Equal(t, mime, "application/json")
+	assert.Equal(t, m, jsonMarshaller)
+}
+
+func TestRestMarshallers(t *testing.T) {
+	s := new(registryService)
+	s.Users.RegisterMarshaller("application/json", prefixMarshaller{"users"})
+	r1 := New()
+	err := r1.Add(s)
+	assert.MustEqual(t, err, nil)
+	r1.RegisterMarshaller("application/json", prefixMarshaller{"r1"})
+	r1.RegisterMarshaller("application/vnd.orders", prefixMarshaller{"orders"})
+	r2 := New()
+	err = r2.Add(new(registryService))
+	assert.MustEqual(t, err, nil)
+
+	type Test struct {
+		r           *Rest
+		path        string
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}
+	var tests = []Test{
+		{r1, "/users", "", http.StatusOK, "application/json; charset=utf-8", "users:ok"},
+		{r1, "/orders", "", http.StatusOK, "application/vnd.orders; charset=utf-8", "orders:ok"},
+		{r1, "/orders", "application/json", http.StatusOK, "application/json; charset=utf-8", "r1:ok"},
+		{r2, "/users", "", http.StatusOK, "application/json; charset=utf-8", "\"ok\"\n"},
+		{r2, "/orders", "", http.StatusOK, "application/json; charset=utf-8", "\"ok\"\n"},
+		{r2, "/orders", "application/vnd.orders", http.StatusNotAcceptable, "text/plain; charset=utf-8", ""},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain"+test.path, nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		resp := httptest.NewRecorder()
+		test.r.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, test.code, "test %d", i)
+		assert.Equal(t, resp.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		if test.body != "" {
+			assert.Equal(t, resp.Body.String(), test.body, "test %d", i)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package rest
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// requestIDHeader is the http header carrying request id.
+const requestIDHeader = "X-Request-ID"
+
+// Hooks are callbacks to log or trace requests.
+type Hooks struct {
+	// OnStart is called before serving request r with request id.
+	// For streaming request, it's called before the long-lived connection starts.
+	OnStart func(id string, r *http.Request)
+
+	// OnFinish is called after serving request r with request id, response code and duration.
+	OnFinish func(id string, r *http.Request, code int, duration time.Duration)
+
+	// OnError is called with request id when serving request r meets an error which can't be answered to the client,
+	// like failing to save the session or to end the stream after the response header is sent.
+	OnError func(id string, r *http.Request, err error)
+}
+
+type requestInfo struct {
+	id      string
+	code    int
+	onError func(err error)
+}
+
+type requestInfoKey struct{}
+
+func withRequestInfo(r *http.Request, id string) (*http.Request, *requestInfo) {
+	info := &requestInfo{
+		id: id,
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)), info
+}
+
+func getRequestInfo(r *http.Request) *requestInfo {
+	info, _ := r.Context().Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// RequestID returns the id of request r, which is assigned by Rest.ServeHTTP.
+// It returns "" if r isn't served by Rest.
+func RequestID(r *http.Request) string {
+	if info := getRequestInfo(r); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+// setResponseCode records response code of request r, for hooks.
+func setResponseCode(r *http.Request, code int) {
+	if info := getRequestInfo(r); info != nil {
+		info.code = code
+	}
+}
+
+// reportError reports err of request r through Hooks.OnError.
+func reportError(r *http.Request, err error) {
+	if info := getRequestInfo(r); info != nil && info.onError != nil {
+		info.onError(err)
+	}
+}
+
+// validRequestID checks whether id from client is safe to use in header and log.
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':' || c == '/' || c == '+' || c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRandomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// errorMessage formats fmtAndArgs as the message of error generated by framework, with the request id of r.
+func errorMessage(r *http.Request, code int, fmtAndArgs ...interface{}) string {
+	message := formatMessage(code, fmtAndArgs...)
+	if id := RequestID(r); id != "" {
+		message += " (request id: " + id + ")"
+	}
+	return message
+}
+
+// returnError returns error generated by framework to ctx, with request id in message.
+func returnError(ctx Context, code int, fmtAndArgs ...interface{}) {
+	ctx.Return(code, "%s", errorMessage(ctx.Request(), code, fmtAndArgs...))
+}
+
+// statusResponseWriter records response code to requestInfo. It forwards optional interfaces like
+// http.Hijacker, http.Pusher and io.ReaderFrom to the original response writer.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	info *requestInfo
+}
+
+func (w *statusResponseWriter) WriteHeader(code int) {
+	if w.info.code == 0 {
+		w.info.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusResponseWriter) Write(p []byte) (int, error) {
+	if w.info.code == 0 {
+		w.info.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original response writer.
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("webserver doesn't support hijacking")
+	}
+	return hj.Hijack()
+}
+
+func (w *statusResponseWriter) Push(target string, opts *http.PushOptions) error {
+	p, ok := w.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return p.Push(target, opts)
+}
+
+func (w *statusResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.info.code == 0 {
+		w.info.code = http.StatusOK
+	}
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(struct{ io.Writer }{w.ResponseWriter}, r)
+}
+
+func (w *statusResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
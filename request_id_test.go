@@ -0,0 +1,175 @@
+package rest
+
+import (
+	"bufio"
+	"github.com/googollee/go-assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidRequestID(t *testing.T) {
+	type Test struct {
+		id    string
+		valid bool
+	}
+	var tests = []Test{
+		{"", false},
+		{"abc-123", true},
+		{"Root=1-5759e988;Parent=53995c3f", false},
+		{"a/b+c=d:e.f_g", true},
+		{"a b", false},
+		{"a\r\nb", false},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+	}
+	for i, test := range tests {
+		assert.Equal(t, validRequestID(test.id), test.valid, "test %d", i)
+	}
+	assert.Equal(t, validRequestID(newRandomID()), true)
+	assert.NotEqual(t, newRandomID(), newRandomID())
+}
+
+type requestIDRest struct {
+	Service
+
+	get    SimpleNode `path:"/get" method:"GET"`
+	post   SimpleNode `path:"/post" method:"POST"`
+	fail   SimpleNode `path:"/fail" method:"GET"`
+	stream Streaming  `path:"/stream" method:"GET"`
+}
+
+func (r *requestIDRest) Get(ctx Context) string {
+	return ctx.RequestID()
+}
+
+func (r *requestIDRest) Post(ctx Context, arg string) string {
+	return arg
+}
+
+func (r *requestIDRest) Fail(ctx Context) error {
+	return NewError(http.StatusForbidden, "forbidden")
+}
+
+func (r *requestIDRest) Stream(ctx StreamContext) {
+	ctx.Render(ctx.RequestID())
+}
+
+func TestRestRequestID(t *testing.T) {
+	type Test struct {
+		trust    bool
+		method   string
+		path     string
+		id       string
+		body     string
+		code     int
+		sameID   bool
+		respBody string
+	}
+	var tests = []Test{
+		{false, "GET", "/get", "", "", http.StatusOK, false, ""},
+		{false, "GET", "/get", "client-id", "", http.StatusOK, false, ""},
+		{true, "GET", "/get", "client-id", "", http.StatusOK, true, "\"client-id\"\n"},
+		{true, "GET", "/get", "invalid id", "", http.StatusOK, false, ""},
+		{true, "GET", "/fail", "client-id", "", http.StatusForbidden, true, "forbidden (request id: client-id)\n"},
+		{true, "POST", "/post", "client-id", "{", http.StatusBadRequest, true, "decode request body error: unexpected EOF (request id: client-id)\n"},
+		{true, "GET", "/non/exist", "client-id", "", http.StatusNotFound, true, "404 page not found (request id: client-id)\n"},
+	}
+	for i, test := range tests {
+		r := New()
+		err := r.Add(new(requestIDRest))
+		assert.MustEqual(t, err, nil)
+		if test.trust {
+			r.SetRequestIDTrust(func(req *http.Request) bool { return true })
+		}
+		var started, finished string
+		finishCode := 0
+		r.SetHooks(Hooks{
+			OnStart: func(id string, req *http.Request) {
+				started = id
+			},
+			OnFinish: func(id string, req *http.Request, code int, duration time.Duration) {
+				finished = id
+				finishCode = code
+			},
+		})
+
+		req, err := http.NewRequest(test.method, "http://domain"+test.path, strings.NewReader(test.body))
+		assert.MustEqual(t, err, nil, "test %d", i)
+		if test.id != "" {
+			req.Header.Set("X-Request-ID", test.id)
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		id := resp.Header().Get("X-Request-ID")
+		assert.Equal(t, resp.Code, test.code, "test %d", i)
+		assert.Equal(t, validRequestID(id), true, "test %d", i)
+		assert.Equal(t, id == test.id, test.sameID, "test %d", i)
+		assert.Equal(t, started, id, "test %d", i)
+		assert.Equal(t, finished, id, "test %d", i)
+		assert.Equal(t, finishCode, test.code, "test %d", i)
+		if test.respBody != "" {
+			assert.Equal(t, resp.Body.String(), test.respBody, "test %d", i)
+		} else if test.code == http.StatusOK {
+			assert.Equal(t, resp.Body.String(), "\""+id+"\"\n", "test %d", i)
+		}
+	}
+}
+
+func TestRestRequestIDStreaming(t *testing.T) {
+	r := New()
+	err := r.Add(new(requestIDRest))
+	assert.MustEqual(t, err, nil)
+	r.SetRequestIDTrust(func(req *http.Request) bool {
+		return req.Header.Get("X-Trusted") != ""
+	})
+	started := make(chan string, 1)
+	finished := make(chan int, 1)
+	r.SetHooks(Hooks{
+		OnStart: func(id string, req *http.Request) {
+			started <- id
+		},
+		OnFinish: func(id string, req *http.Request, code int, duration time.Duration) {
+			finished <- code
+		},
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL+"/stream", nil)
+	assert.MustEqual(t, err, nil)
+	req.Header.Set("X-Request-ID", "stream-id")
+	req.Header.Set("X-Trusted", "true")
+	resp, err := http.DefaultClient.Do(req)
+	assert.MustEqual(t, err, nil)
+	defer resp.Body.Close()
+	assert.Equal(t, resp.Header.Get("X-Request-ID"), "stream-id")
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Equal(t, err, nil)
+	assert.Equal(t, line, "\"stream-id\"\n")
+	assert.Equal(t, <-started, "stream-id")
+	assert.Equal(t, <-finished, http.StatusOK)
+}
+
+func TestStatusResponseWriter(t *testing.T) {
+	resp := httptest.NewRecorder()
+	info := &requestInfo{}
+	var w http.ResponseWriter = &statusResponseWriter{resp, info}
+
+	_, ok := w.(http.Hijacker)
+	assert.Equal(t, ok, true)
+	p, ok := w.(http.Pusher)
+	assert.MustEqual(t, ok, true)
+	assert.Equal(t, p.Push("/style.css", nil), http.ErrNotSupported)
+	rf, ok := w.(io.ReaderFrom)
+	assert.MustEqual(t, ok, true)
+	n, err := rf.ReadFrom(strings.NewReader("abc"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, int64(3))
+	assert.Equal(t, info.code, http.StatusOK)
+	assert.Equal(t, resp.Body.String(), "abc")
+}
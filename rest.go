@@ -8,16 +8,23 @@ import (
 	"github.com/ant0ine/go-urlrouter"
 	"net/http"
 	"reflect"
+	"time"
 )
 
 // Rest handle the http request and call to correspond handler.
 type Rest struct {
-	router urlrouter.Router
+	router         urlrouter.Router
+	sessions       *SessionManager
+	trustRequestID func(req *http.Request) bool
+	hooks          Hooks
+	marshallers    *marshallerRegistry
 }
 
 // New return a Rest.
 func New() *Rest {
-	return &Rest{}
+	return &Rest{
+		marshallers: newMarshallerRegistry(nil),
+	}
 }
 
 // Add add a service to rest.
@@ -56,17 +63,85 @@ func (r *Rest) Add(v interface{}) error {
 	return nil
 }
 
+// SetSessionManager set the session manager m used by Context.Session().
+// It returns error if m doesn't have keys or has invalid encrypt keys, and the session manager isn't changed.
+func (r *Rest) SetSessionManager(m *SessionManager) error {
+	if m != nil {
+		if err := m.check(); err != nil {
+			return err
+		}
+	}
+	r.sessions = m
+	return nil
+}
+
+// SetRequestIDTrust set the function to check whether the X-Request-ID header of request is trusted.
+// Trusted X-Request-ID is used as request id, otherwise rest generates a random one.
+func (r *Rest) SetRequestIDTrust(trust func(req *http.Request) bool) {
+	r.trustRequestID = trust
+}
+
+// RegisterMarshaller register a marshaller with corresponding mime for services in this rest only.
+// It overrides the marshaller registered globally with the same mime.
+// It's safe to call concurrently with serving requests.
+func (r *Rest) RegisterMarshaller(mime string, marshaller Marshaller) {
+	r.marshallers.register(mime, marshaller)
+}
+
+// SetHooks set hooks to log or trace requests.
+func (r *Rest) SetHooks(hooks Hooks) {
+	r.hooks = hooks
+}
+
 // ServeHTTP serve the http request.
 func (r *Rest) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	id := ""
+	if r.trustRequestID != nil && r.trustRequestID(req) {
+		if id = req.Header.Get(requestIDHeader); !validRequestID(id) {
+			id = ""
+		}
+	}
+	if id == "" {
+		id = newRandomID()
+	}
+	req, info := withRequestInfo(req, id)
+	w.Header().Set(requestIDHeader, id)
+	if r.hooks.OnError != nil {
+		info.onError = func(err error) {
+			r.hooks.OnError(id, req, err)
+		}
+	}
+	if r.hooks.OnStart != nil {
+		r.hooks.OnStart(id, req)
+	}
+	if r.hooks.OnFinish != nil {
+		w = &statusResponseWriter{w, info}
+		start := time.Now()
+		defer func() {
+			code := info.code
+			if code == 0 {
+				code = http.StatusOK
+			}
+			r.hooks.OnFinish(id, req, code, time.Since(start))
+		}()
+	}
+
 	route, vars, err := r.router.FindRoute(req.URL.Path)
 	if err != nil || route == nil {
-		http.NotFound(w, req)
+		http.Error(w, errorMessage(req, http.StatusNotFound, "404 page not found"), http.StatusNotFound)
 		return
 	}
 	endpoint, ok := route.Dest.(*EndPoint)
 	if !ok {
-		http.Error(w, "", http.StatusNotFound)
+		http.Error(w, errorMessage(req, http.StatusNotFound), http.StatusNotFound)
 		return
 	}
+	req = withValueStore(req)
+	if r.marshallers != nil {
+		req = withMarshallers(req, r.marshallers)
+	}
+	if r.sessions != nil {
+		req = withSessionManager(req, r.sessions)
+	}
 	endpoint.Call(w, req, vars)
 }
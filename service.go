@@ -13,7 +13,22 @@ type RestService interface {
 }
 
 // Service is a rest service creator.
-type Service struct{}
+type Service struct {
+	marshallers *marshallerRegistry
+}
+
+// RegisterMarshaller register a marshaller with corresponding mime for handlers of this service only.
+// It overrides the marshaller registered in Rest or globally with the same mime.
+// Call it before adding the service to Rest:
+//     s := new(HelloService)
+//     s.Service.RegisterMarshaller("application/json", CustomJSONMarshaller{})
+//     r.Add(s)
+func (s *Service) RegisterMarshaller(mime string, marshaller Marshaller) {
+	if s.marshallers == nil {
+		s.marshallers = newMarshallerRegistry(nil)
+	}
+	s.marshallers.register(mime, marshaller)
+}
 
 // MakeHandlers will use v's nodes to create a set of endpoint.
 func (s Service) MakeHandlers(tag reflect.StructTag, v interface{}) (map[string]*EndPoint, error) {
@@ -38,6 +53,9 @@ func (s Service) MakeHandlers(tag reflect.StructTag, v interface{}) (map[string]
 		if err != nil {
 			return nil, err
 		}
+		if s.marshallers != nil {
+			handler = scopedHandler{handler, s.marshallers}
+		}
 		endpoint, ok := ret[path]
 		if !ok {
 			endpoint = NewEndPoint()
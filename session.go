@@ -0,0 +1,487 @@
+package rest
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSessionDisabled is returned by Context.Session() if rest doesn't set a SessionManager.
+var ErrSessionDisabled = errors.New("session is disabled")
+
+// Session is a key/value store of a client, persisted across requests.
+// Values are stored with json encoding.
+type Session struct {
+	id        string
+	values    map[string]json.RawMessage
+	modified  bool
+	destroyed bool
+}
+
+func newSession() *Session {
+	return &Session{
+		id:     newRandomID(),
+		values: make(map[string]json.RawMessage),
+	}
+}
+
+// ID returns the id of session.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Get decodes the value of key to v. It returns false if key doesn't exist or decoding failed.
+func (s *Session) Get(key string, v interface{}) bool {
+	data, ok := s.values[key]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// Set sets the value of key to v.
+func (s *Session) Set(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.values[key] = data
+	s.modified = true
+	return nil
+}
+
+// Delete removes the value of key.
+func (s *Session) Delete(key string) {
+	if _, ok := s.values[key]; !ok {
+		return
+	}
+	delete(s.values, key)
+	s.modified = true
+}
+
+// Keys returns all keys in session, in order.
+func (s *Session) Keys() []string {
+	ret := make([]string, 0, len(s.values))
+	for k := range s.values {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Destroy removes all values and expires the session cookie.
+// Values set after Destroy are saved to a new session with a fresh id, like logging in after logging out.
+func (s *Session) Destroy() {
+	s.values = make(map[string]json.RawMessage)
+	s.modified = false
+	s.destroyed = true
+}
+
+// SessionStore is a server-side storage of session data.
+type SessionStore interface {
+	// Load returns the data of session id. It returns nil data if the session doesn't exist or expired.
+	Load(id string) ([]byte, error)
+	// Save saves data of session id, which will expire at expires.
+	Save(id string, data []byte, expires time.Time) error
+	// Delete removes session id.
+	Delete(id string) error
+}
+
+// SessionManager loads and saves sessions of requests.
+// If Store is nil, session data is stored in the cookie, otherwise the cookie only stores the session id.
+type SessionManager struct {
+	// Name is the cookie name.
+	Name string
+	// Keys are HMAC keys to sign cookie. The first key is used to sign, and all keys are used to verify,
+	// which allows to rotate keys.
+	Keys [][]byte
+	// EncryptKeys are optional AES keys (16, 24 or 32 bytes) to encrypt cookie data.
+	// The first key is used to encrypt, and all keys are used to decrypt.
+	EncryptKeys [][]byte
+	// Store is the server-side storage of session data.
+	Store SessionStore
+	// MaxAge is the life time of session.
+	MaxAge time.Duration
+
+	Path     string
+	Domain   string
+	Secure   bool
+	HTTPOnly bool
+	// SameSite is the SameSite attribute of cookie. Default is http.SameSiteLaxMode.
+	SameSite http.SameSite
+}
+
+// NewSessionManager creates a SessionManager with cookie name and HMAC keys.
+// It stores session data in cookie, and session will expire after 24 hours.
+// It panics if keys is empty.
+func NewSessionManager(name string, keys ...[]byte) *SessionManager {
+	if len(keys) == 0 {
+		panic("rest: session manager needs at least one key")
+	}
+	return &SessionManager{
+		Name:     name,
+		Keys:     keys,
+		MaxAge:   24 * time.Hour,
+		Path:     "/",
+		HTTPOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// check checks the settings of m before serving.
+func (m *SessionManager) check() error {
+	if len(m.Keys) == 0 {
+		return fmt.Errorf("session manager doesn't have key")
+	}
+	for _, key := range m.EncryptKeys {
+		if _, err := newGCM(key); err != nil {
+			return fmt.Errorf("invalid session encrypt key: %s", err)
+		}
+	}
+	return nil
+}
+
+type sessionManagerKey struct{}
+
+func withSessionManager(r *http.Request, m *SessionManager) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionManagerKey{}, m))
+}
+
+func getSessionManager(r *http.Request) *SessionManager {
+	m, _ := r.Context().Value(sessionManagerKey{}).(*SessionManager)
+	return m
+}
+
+type sessionData struct {
+	ID      string                     `json:"i"`
+	Expires int64                      `json:"e"`
+	Values  map[string]json.RawMessage `json:"v"`
+}
+
+// Load loads the session of request r. It returns a new session if request doesn't have a valid session.
+func (m *SessionManager) Load(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(m.Name)
+	if err != nil {
+		return newSession(), nil
+	}
+	payload, ok := m.verify(cookie.Value)
+	if !ok {
+		return newSession(), nil
+	}
+	if m.Store != nil {
+		id := string(payload)
+		b, err := m.Store.Load(id)
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			return newSession(), nil
+		}
+		payload = b
+	} else if payload, ok = m.decrypt(payload); !ok {
+		return newSession(), nil
+	}
+	var data sessionData
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return newSession(), nil
+	}
+	if time.Now().Unix() > data.Expires {
+		return newSession(), nil
+	}
+	if data.Values == nil {
+		data.Values = make(map[string]json.RawMessage)
+	}
+	return &Session{
+		id:     data.ID,
+		values: data.Values,
+	}, nil
+}
+
+// Save writes session s to response w with Set-Cookie header, if s was modified or destroyed.
+// A destroyed session is deleted, and if it has values set after Destroy, they are saved with a fresh id.
+// It should be called before writing response header.
+func (m *SessionManager) Save(w http.ResponseWriter, s *Session) error {
+	sameSite := m.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+	cookie := &http.Cookie{
+		Name:     m.Name,
+		Path:     m.Path,
+		Domain:   m.Domain,
+		Secure:   m.Secure,
+		HttpOnly: m.HTTPOnly,
+		SameSite: sameSite,
+	}
+	if s.destroyed {
+		if m.Store != nil {
+			if err := m.Store.Delete(s.id); err != nil {
+				return err
+			}
+		}
+		s.destroyed = false
+		s.id = newRandomID()
+		if !s.modified {
+			cookie.MaxAge = -1
+			http.SetCookie(w, cookie)
+			return nil
+		}
+	}
+	if !s.modified {
+		return nil
+	}
+	expires := time.Now().Add(m.MaxAge)
+	payload, err := json.Marshal(sessionData{
+		ID:      s.id,
+		Expires: expires.Unix(),
+		Values:  s.values,
+	})
+	if err != nil {
+		return err
+	}
+	if m.Store != nil {
+		if err := m.Store.Save(s.id, payload, expires); err != nil {
+			return err
+		}
+		payload = []byte(s.id)
+	} else if payload, err = m.encrypt(payload); err != nil {
+		return err
+	}
+	value, err := m.sign(payload)
+	if err != nil {
+		return err
+	}
+	if len(value) > 4000 {
+		return fmt.Errorf("session cookie is too large: %d bytes", len(value))
+	}
+	cookie.Value = value
+	cookie.Expires = expires
+	cookie.MaxAge = int(m.MaxAge / time.Second)
+	http.SetCookie(w, cookie)
+	s.modified = false
+	return nil
+}
+
+func (m *SessionManager) mac(key, payload []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(m.Name))
+	h.Write([]byte{'|'})
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+func (m *SessionManager) sign(payload []byte) (string, error) {
+	if len(m.Keys) == 0 {
+		return "", fmt.Errorf("session manager doesn't have key")
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(m.mac(m.Keys[0], payload)), nil
+}
+
+func (m *SessionManager) verify(value string) ([]byte, bool) {
+	i := strings.LastIndex(value, ".")
+	if i < 0 {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(value[:i])
+	if err != nil {
+		return nil, false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil {
+		return nil, false
+	}
+	for _, key := range m.Keys {
+		if hmac.Equal(sig, m.mac(key, payload)) {
+			return payload, true
+		}
+	}
+	return nil, false
+}
+
+func (m *SessionManager) encrypt(payload []byte) ([]byte, error) {
+	if len(m.EncryptKeys) == 0 {
+		return payload, nil
+	}
+	gcm, err := newGCM(m.EncryptKeys[0])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, payload, nil), nil
+}
+
+func (m *SessionManager) decrypt(payload []byte) ([]byte, bool) {
+	if len(m.EncryptKeys) == 0 {
+		return payload, true
+	}
+	for _, key := range m.EncryptKeys {
+		gcm, err := newGCM(key)
+		if err != nil || len(payload) < gcm.NonceSize() {
+			continue
+		}
+		nonce, data := payload[:gcm.NonceSize()], payload[gcm.NonceSize():]
+		if ret, err := gcm.Open(nil, nonce, data, nil); err == nil {
+			return ret, true
+		}
+	}
+	return nil, false
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// MemorySessionStore is a SessionStore in memory.
+type MemorySessionStore struct {
+	locker   sync.Mutex
+	sessions map[string]memorySession
+}
+
+type memorySession struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewMemorySessionStore creates a MemorySessionStore.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]memorySession),
+	}
+}
+
+// Load implements SessionStore's Load.
+func (s *MemorySessionStore) Load(id string) ([]byte, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(session.expires) {
+		delete(s.sessions, id)
+		return nil, nil
+	}
+	return session.data, nil
+}
+
+// memorySessionSweep is the number of sessions checked for expiration in each MemorySessionStore.Save.
+const memorySessionSweep = 10
+
+// Save implements SessionStore's Save. It also checks a few sessions in random order and removes expired ones,
+// so expired sessions are removed over time without scanning all sessions in each request.
+func (s *MemorySessionStore) Save(id string, data []byte, expires time.Time) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	now := time.Now()
+	n := 0
+	for k, session := range s.sessions {
+		if n++; n > memorySessionSweep {
+			break
+		}
+		if now.After(session.expires) {
+			delete(s.sessions, k)
+		}
+	}
+	s.sessions[id] = memorySession{
+		data:    append([]byte(nil), data...),
+		expires: expires,
+	}
+	return nil
+}
+
+// Delete implements SessionStore's Delete.
+func (s *MemorySessionStore) Delete(id string) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+// sessionResponseWriter saves the session before writing response header.
+type sessionResponseWriter struct {
+	http.ResponseWriter
+	manager *SessionManager
+	request *http.Request
+	session *Session
+	saved   bool
+}
+
+func newSessionResponseWriter(w http.ResponseWriter, r *http.Request, m *SessionManager) *sessionResponseWriter {
+	return &sessionResponseWriter{
+		ResponseWriter: w,
+		manager:        m,
+		request:        r,
+	}
+}
+
+func (w *sessionResponseWriter) get() (*Session, error) {
+	if w.session != nil {
+		return w.session, nil
+	}
+	session, err := w.manager.Load(w.request)
+	if err != nil {
+		return nil, err
+	}
+	w.session = session
+	return session, nil
+}
+
+// save saves the session once. It returns nil if the session was saved before.
+func (w *sessionResponseWriter) save() error {
+	if w.saved {
+		return nil
+	}
+	w.saved = true
+	if w.session == nil {
+		return nil
+	}
+	return w.manager.Save(w.ResponseWriter, w.session)
+}
+
+// saveOnWrite saves the session before the header is sent.
+// It's too late to answer the error to the client, so the error is reported through Hooks.OnError.
+func (w *sessionResponseWriter) saveOnWrite() {
+	if err := w.save(); err != nil {
+		reportError(w.request, fmt.Errorf("save session error: %s", err))
+	}
+}
+
+func (w *sessionResponseWriter) WriteHeader(code int) {
+	w.saveOnWrite()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionResponseWriter) Write(p []byte) (int, error) {
+	w.saveOnWrite()
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *sessionResponseWriter) Flush() {
+	w.saveOnWrite()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,337 @@
+package rest
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/googollee/go-assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func saveAndLoad(t *testing.T, save, load *SessionManager, s *Session) (*Session, *http.Cookie) {
+	resp := httptest.NewRecorder()
+	err := save.Save(resp, s)
+	assert.MustEqual(t, err, nil)
+	req, err := http.NewRequest("GET", "http://domain/", nil)
+	assert.MustEqual(t, err, nil)
+	cookies := (&http.Response{Header: resp.Header()}).Cookies()
+	var cookie *http.Cookie
+	if len(cookies) > 0 {
+		cookie = cookies[0]
+		req.AddCookie(cookie)
+	}
+	ret, err := load.Load(req)
+	assert.MustEqual(t, err, nil)
+	return ret, cookie
+}
+
+func TestSessionValues(t *testing.T) {
+	s := newSession()
+	assert.Equal(t, len(s.ID()), 32)
+	assert.Equal(t, s.modified, false)
+
+	var i int
+	assert.Equal(t, s.Get("i", &i), false)
+	assert.Equal(t, s.Set("i", 1), nil)
+	assert.Equal(t, s.Set("s", "str"), nil)
+	assert.Equal(t, s.modified, true)
+	assert.Equal(t, s.Get("i", &i), true)
+	assert.Equal(t, i, 1)
+	var str string
+	assert.Equal(t, s.Get("i", &str), false)
+	assert.Equal(t, s.Keys(), []string{"i", "s"})
+	s.Delete("i")
+	assert.Equal(t, s.Keys(), []string{"s"})
+	s.Destroy()
+	assert.Equal(t, s.Keys(), []string{})
+}
+
+func TestSessionCookie(t *testing.T) {
+	m := NewSessionManager("session", []byte("key1"))
+	s := newSession()
+	s.Set("user", "rest")
+	loaded, cookie := saveAndLoad(t, m, m, s)
+	assert.MustEqual(t, cookie != nil, true)
+	assert.Equal(t, cookie.Name, "session")
+	assert.Equal(t, cookie.HttpOnly, true)
+	assert.Equal(t, cookie.SameSite, http.SameSiteLaxMode)
+	assert.Equal(t, cookie.MaxAge, 24*60*60)
+	assert.Equal(t, loaded.ID(), s.ID())
+	var user string
+	assert.Equal(t, loaded.Get("user", &user), true)
+	assert.Equal(t, user, "rest")
+	assert.Equal(t, loaded.modified, false)
+
+	// not modified session doesn't set cookie.
+	_, cookie = saveAndLoad(t, m, m, loaded)
+	assert.Equal(t, cookie == nil, true)
+
+	// tampered cookie.
+	req, _ := http.NewRequest("GET", "http://domain/", nil)
+	value, _ := m.sign([]byte(`{"i":"abc","e":99999999999,"v":{"user":"\"admin\""}}`))
+	req.AddCookie(&http.Cookie{Name: "session", Value: "x" + value})
+	loaded, err := m.Load(req)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, loaded.Get("user", &user), false)
+}
+
+func TestSessionDestroyAndSet(t *testing.T) {
+	for _, store := range []SessionStore{nil, NewMemorySessionStore()} {
+		m := NewSessionManager("session", []byte("key"))
+		m.Store = store
+		s := newSession()
+		s.Set("user", "old")
+		loaded, _ := saveAndLoad(t, m, m, s)
+
+		loaded.Set("cart", 1)
+		loaded.Destroy()
+		loaded.Set("user", "new")
+		relogin, cookie := saveAndLoad(t, m, m, loaded)
+		assert.MustEqual(t, cookie != nil, true, "store %v", store)
+		assert.Equal(t, cookie.MaxAge, 24*60*60, "store %v", store)
+		assert.NotEqual(t, relogin.ID(), s.ID(), "store %v", store)
+		assert.Equal(t, relogin.Keys(), []string{"user"}, "store %v", store)
+		var user string
+		assert.Equal(t, relogin.Get("user", &user), true, "store %v", store)
+		assert.Equal(t, user, "new", "store %v", store)
+		if store != nil {
+			data, err := store.Load(s.ID())
+			assert.Equal(t, err, nil)
+			assert.Equal(t, data == nil, true)
+		}
+	}
+}
+
+func TestSessionManagerCheck(t *testing.T) {
+	r := New()
+	err := r.SetSessionManager(&SessionManager{Name: "session"})
+	assert.NotEqual(t, err, nil)
+	m := NewSessionManager("session", []byte("key"))
+	m.EncryptKeys = [][]byte{[]byte("short")}
+	err = r.SetSessionManager(m)
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, r.sessions == nil, true)
+	err = r.SetSessionManager(NewSessionManager("session", []byte("key")))
+	assert.Equal(t, err, nil)
+
+	defer func() {
+		assert.NotEqual(t, recover(), nil)
+	}()
+	NewSessionManager("session")
+}
+
+func TestMemorySessionStoreSweep(t *testing.T) {
+	store := NewMemorySessionStore()
+	for i := 0; i < 100; i++ {
+		store.sessions[fmt.Sprintf("expired%d", i)] = memorySession{[]byte("x"), time.Now().Add(-time.Minute)}
+	}
+	store.Save("live", []byte("x"), time.Now().Add(time.Minute))
+	assert.Equal(t, len(store.sessions) > 1, true)
+	for i := 0; i < 100 && len(store.sessions) > 1; i++ {
+		store.Save("live", []byte("x"), time.Now().Add(time.Minute))
+	}
+	assert.Equal(t, len(store.sessions), 1)
+	data, err := store.Load("live")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(data), "x")
+}
+
+func TestSessionKeyRotation(t *testing.T) {
+	old := NewSessionManager("session", []byte("key1"))
+	rotated := NewSessionManager("session", []byte("key2"), []byte("key1"))
+	removed := NewSessionManager("session", []byte("key2"))
+	s := newSession()
+	s.Set("user", "rest")
+	var user string
+
+	loaded, _ := saveAndLoad(t, old, rotated, s)
+	assert.Equal(t, loaded.Get("user", &user), true)
+	assert.Equal(t, user, "rest")
+
+	s.modified = true
+	loaded, _ = saveAndLoad(t, old, removed, s)
+	assert.Equal(t, loaded.Get("user", &user), false)
+	assert.NotEqual(t, loaded.ID(), s.ID())
+}
+
+func TestSessionEncrypt(t *testing.T) {
+	key1 := []byte("0123456789abcdef")
+	key2 := []byte("fedcba9876543210")
+	m := NewSessionManager("session", []byte("key"))
+	m.EncryptKeys = [][]byte{key1}
+	rotated := NewSessionManager("session", []byte("key"))
+	rotated.EncryptKeys = [][]byte{key2, key1}
+	plain := NewSessionManager("session", []byte("key"))
+	s := newSession()
+	s.Set("user", "rest")
+	var user string
+
+	loaded, cookie := saveAndLoad(t, m, rotated, s)
+	payload, ok := m.verify(cookie.Value)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, strings.Contains(string(payload), "rest"), false)
+	assert.Equal(t, loaded.Get("user", &user), true)
+	assert.Equal(t, user, "rest")
+
+	s.modified = true
+	loaded, _ = saveAndLoad(t, m, plain, s)
+	assert.Equal(t, loaded.Get("user", &user), false)
+}
+
+func TestSessionExpire(t *testing.T) {
+	m := NewSessionManager("session", []byte("key"))
+	m.MaxAge = -time.Minute
+	s := newSession()
+	s.Set("user", "rest")
+	var user string
+	loaded, _ := saveAndLoad(t, m, m, s)
+	assert.Equal(t, loaded.Get("user", &user), false)
+}
+
+func TestSessionStore(t *testing.T) {
+	m := NewSessionManager("session", []byte("key"))
+	m.Store = NewMemorySessionStore()
+	s := newSession()
+	s.Set("user", "rest")
+	var user string
+
+	loaded, cookie := saveAndLoad(t, m, m, s)
+	assert.Equal(t, loaded.Get("user", &user), true)
+	assert.Equal(t, user, "rest")
+	sign, _ := m.sign([]byte(s.ID()))
+	assert.Equal(t, cookie.Value, sign)
+
+	loaded.Destroy()
+	_, cookie = saveAndLoad(t, m, m, loaded)
+	assert.Equal(t, cookie.MaxAge, -1)
+	data, err := m.Store.Load(s.ID())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, data == nil, true)
+
+	m.MaxAge = -time.Minute
+	s.modified = true
+	loaded, _ = saveAndLoad(t, m, m, s)
+	assert.Equal(t, loaded.Get("user", &user), false)
+}
+
+type sessionRest struct {
+	Service
+
+	login       SimpleNode `path:"/login" method:"POST"`
+	loginStream Streaming  `path:"/login/stream" method:"GET"`
+	whoami      SimpleNode `path:"/whoami" method:"GET"`
+}
+
+func (r *sessionRest) Login(ctx Context, user string) error {
+	session, err := ctx.Session()
+	if err != nil {
+		return err
+	}
+	return session.Set("user", user)
+}
+
+func (r *sessionRest) LoginStream(ctx StreamContext) {
+	session, err := ctx.Session()
+	if err != nil {
+		return
+	}
+	session.Set("user", "stream")
+	ctx.Render("logged in")
+}
+
+func (r *sessionRest) Whoami(ctx Context) (string, error) {
+	session, err := ctx.Session()
+	if err != nil {
+		return "", err
+	}
+	var user string
+	if !session.Get("user", &user) {
+		return "", NewError(http.StatusUnauthorized)
+	}
+	return user, nil
+}
+
+func TestSessionRest(t *testing.T) {
+	r := New()
+	err := r.Add(new(sessionRest))
+	assert.MustEqual(t, err, nil)
+
+	req, err := http.NewRequest("GET", "http://domain/whoami", nil)
+	assert.MustEqual(t, err, nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusInternalServerError)
+	assert.Equal(t, resp.Body.String(), "session is disabled (request id: "+resp.Header().Get("X-Request-ID")+")\n")
+
+	err = r.SetSessionManager(NewSessionManager("session", []byte("key")))
+	assert.MustEqual(t, err, nil)
+
+	req, err = http.NewRequest("POST", "http://domain/login", strings.NewReader(`"rest"`))
+	assert.MustEqual(t, err, nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	cookies := (&http.Response{Header: resp.Header()}).Cookies()
+	assert.MustEqual(t, len(cookies), 1)
+
+	req, err = http.NewRequest("GET", "http://domain/whoami", nil)
+	assert.MustEqual(t, err, nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusUnauthorized)
+
+	req.AddCookie(cookies[0])
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Body.String(), "\"rest\"\n")
+	assert.Equal(t, resp.Header().Get("Set-Cookie"), "")
+}
+
+type failedSessionStore struct{}
+
+func (failedSessionStore) Load(id string) ([]byte, error) { return nil, nil }
+
+func (failedSessionStore) Save(id string, data []byte, expires time.Time) error {
+	return fmt.Errorf("store is down")
+}
+
+func (failedSessionStore) Delete(id string) error { return nil }
+
+func TestSessionSaveError(t *testing.T) {
+	r := New()
+	err := r.Add(new(sessionRest))
+	assert.MustEqual(t, err, nil)
+	m := NewSessionManager("session", []byte("key"))
+	m.Store = failedSessionStore{}
+	err = r.SetSessionManager(m)
+	assert.MustEqual(t, err, nil)
+	errs := make(chan string, 1)
+	r.SetHooks(Hooks{
+		OnError: func(id string, req *http.Request, err error) {
+			errs <- err.Error()
+		},
+	})
+
+	req, err := http.NewRequest("POST", "http://domain/login", strings.NewReader(`"rest"`))
+	assert.MustEqual(t, err, nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusInternalServerError)
+	assert.Equal(t, resp.Body.String(), "save session error: store is down (request id: "+resp.Header().Get("X-Request-ID")+")\n")
+	assert.Equal(t, resp.Header().Get("Set-Cookie"), "")
+	assert.Equal(t, len(errs), 0)
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+	streamResp, err := http.Get(server.URL + "/login/stream")
+	assert.MustEqual(t, err, nil)
+	defer streamResp.Body.Close()
+	line, err := bufio.NewReader(streamResp.Body).ReadString('\n')
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, line, "\"logged in\"\n")
+	assert.Equal(t, <-errs, "save session error: store is down")
+}
@@ -0,0 +1,193 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+)
+
+// StreamMarshaller is a Marshaller which encodes all messages rendered in a Streaming node as one stream.
+// Streaming node calls Begin before the first message, Encode for each message and End when handler returns.
+// The end tag of Streaming node is ignored with a StreamMarshaller.
+// Calling Return after the first message ends the stream instead of writing the error into it,
+// and the error is reported through Hooks.OnError.
+type StreamMarshaller interface {
+	Marshaller
+
+	// Begin starts a stream writing to w, with the handler function name.
+	Begin(w io.Writer, name string) (StreamEncoder, error)
+}
+
+// StreamEncoder encodes messages of one stream, created by StreamMarshaller's Begin.
+type StreamEncoder interface {
+	// Encode writes message v to the stream.
+	Encode(v interface{}) error
+
+	// End finishes the stream.
+	End() error
+}
+
+// NDJSONMarshaller is StreamMarshaller of newline delimited json, one value per line.
+// Unmarshalling to a pointer of slice reads all values, otherwise reads the first value only.
+type NDJSONMarshaller struct{}
+
+// Marshal will marshal v as one line and write to w.
+func (m NDJSONMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Unmarshal will read r and unmarshal to v.
+func (m NDJSONMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("ndjson: unmarshal to non-pointer %T", v)
+	}
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	slice := rv.Elem()
+	if slice.Kind() != reflect.Slice || slice.Type().Elem().Kind() == reflect.Uint8 {
+		return decoder.Decode(v)
+	}
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+	for {
+		elem := reflect.New(slice.Type().Elem())
+		err := decoder.Decode(elem.Interface())
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+}
+
+// Begin implements StreamMarshaller.
+func (m NDJSONMarshaller) Begin(w io.Writer, name string) (StreamEncoder, error) {
+	return ndjsonEncoder{json.NewEncoder(w)}, nil
+}
+
+type ndjsonEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e ndjsonEncoder) Encode(v interface{}) error {
+	return e.encoder.Encode(v)
+}
+
+func (e ndjsonEncoder) End() error {
+	return nil
+}
+
+// JSONArrayMarshaller is JSONMarshaller which streams all messages as elements of one json array,
+// like [1,2,3]. A stream without message is an empty array.
+// It isn't registered by default, register it to stream json array:
+//     service.RegisterMarshaller("application/json", rest.JSONArrayMarshaller{})
+type JSONArrayMarshaller struct {
+	JSONMarshaller
+}
+
+// Begin implements StreamMarshaller.
+func (m JSONArrayMarshaller) Begin(w io.Writer, name string) (StreamEncoder, error) {
+	if _, err := w.Write([]byte("[")); err != nil {
+		return nil, err
+	}
+	return &jsonArrayEncoder{m: m.JSONMarshaller, w: w, name: name}, nil
+}
+
+type jsonArrayEncoder struct {
+	m     JSONMarshaller
+	w     io.Writer
+	name  string
+	count int
+}
+
+func (e *jsonArrayEncoder) Encode(v interface{}) error {
+	var buf bytes.Buffer
+	if e.count > 0 {
+		buf.WriteByte(',')
+	}
+	if err := e.m.Marshal(&buf, e.name, v); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))); err != nil {
+		return err
+	}
+	e.count++
+	return nil
+}
+
+func (e *jsonArrayEncoder) End() error {
+	_, err := e.w.Write([]byte("]\n"))
+	return err
+}
+
+// LengthPrefixedMarshaller frames each message marshalled by Marshaller with its length
+// as 4 bytes big endian integer, so binary messages can be split from a stream.
+// It isn't registered by default, register it with a mime:
+//     rest.RegisterMarshaller("application/x-msgpack-stream", rest.LengthPrefixedMarshaller{rest.MsgpackMarshaller{}})
+type LengthPrefixedMarshaller struct {
+	Marshaller Marshaller
+}
+
+// Binary implements BinaryMarshaller.
+func (m LengthPrefixedMarshaller) Binary() bool {
+	return true
+}
+
+// Marshal will marshal v as one frame and write to w.
+func (m LengthPrefixedMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	var buf bytes.Buffer
+	buf.Write([]byte{0, 0, 0, 0})
+	if err := m.Marshaller.Marshal(&buf, name, v); err != nil {
+		return err
+	}
+	b := buf.Bytes()
+	if int64(len(b)-4) > math.MaxUint32 {
+		return fmt.Errorf("frame is too large: %d bytes", len(b)-4)
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	_, err := w.Write(b)
+	return err
+}
+
+// Unmarshal will read one frame from r and unmarshal to v.
+func (m LengthPrefixedMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return err
+	}
+	n := int64(binary.BigEndian.Uint32(size[:]))
+	frame, err := ioutil.ReadAll(io.LimitReader(r, n))
+	if err != nil {
+		return err
+	}
+	if int64(len(frame)) < n {
+		return io.ErrUnexpectedEOF
+	}
+	return m.Marshaller.Unmarshal(bytes.NewReader(frame), v)
+}
+
+// Begin implements StreamMarshaller.
+func (m LengthPrefixedMarshaller) Begin(w io.Writer, name string) (StreamEncoder, error) {
+	return lengthPrefixedEncoder{m, w, name}, nil
+}
+
+type lengthPrefixedEncoder struct {
+	marshaller LengthPrefixedMarshaller
+	w          io.Writer
+	name       string
+}
+
+func (e lengthPrefixedEncoder) Encode(v interface{}) error {
+	return e.marshaller.Marshal(e.w, e.name, v)
+}
+
+func (e lengthPrefixedEncoder) End() error {
+	return nil
+}
@@ -0,0 +1,182 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/googollee/go-assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamMarshaller(t *testing.T) {
+	type Test struct {
+		marshaller StreamMarshaller
+		messages   []interface{}
+		output     string
+	}
+	var tests = []Test{
+		{NDJSONMarshaller{}, nil, ""},
+		{NDJSONMarshaller{}, []interface{}{1, "a", map[string]int{"b": 2}}, "1\n\"a\"\n{\"b\":2}\n"},
+		{JSONArrayMarshaller{}, nil, "[]\n"},
+		{JSONArrayMarshaller{}, []interface{}{1}, "[1]\n"},
+		{JSONArrayMarshaller{}, []interface{}{1, "a", map[string]int{"b": 2}}, "[1,\"a\",{\"b\":2}]\n"},
+		{LengthPrefixedMarshaller{TextMarshaller{}}, nil, ""},
+		{LengthPrefixedMarshaller{TextMarshaller{}}, []interface{}{"a", "bc"}, "\x00\x00\x00\x01a\x00\x00\x00\x02bc"},
+	}
+	for i, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		encoder, err := test.marshaller.Begin(buf, "name")
+		assert.MustEqual(t, err, nil, "test %d", i)
+		for _, message := range test.messages {
+			err := encoder.Encode(message)
+			assert.MustEqual(t, err, nil, "test %d", i)
+		}
+		err = encoder.End()
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, buf.String(), test.output, "test %d", i)
+	}
+}
+
+func TestNDJSONMarshaller(t *testing.T) {
+	m := NDJSONMarshaller{}
+	var ints []int
+	err := m.Unmarshal(bytes.NewBufferString("1\n2\n\n3\n"), &ints)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, ints, []int{1, 2, 3})
+
+	var i int
+	err = m.Unmarshal(bytes.NewBufferString("1\n2\n"), &i)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, i, 1)
+
+	err = m.Unmarshal(bytes.NewBufferString("1\n{\n"), &ints)
+	assert.NotEqual(t, err, nil)
+	err = m.Unmarshal(bytes.NewBufferString("1\n"), ints)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestLengthPrefixedMarshaller(t *testing.T) {
+	m := LengthPrefixedMarshaller{MsgpackMarshaller{}}
+	assert.Equal(t, isBinaryMarshaller(m), true)
+	buf := bytes.NewBuffer(nil)
+	err := m.Marshal(buf, "name", []int{1, 2})
+	assert.MustEqual(t, err, nil)
+	err = m.Marshal(buf, "name", "abc")
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, buf.String(), "\x00\x00\x00\x03\x92\x01\x02\x00\x00\x00\x04\xa3abc")
+
+	var ints []int
+	err = m.Unmarshal(buf, &ints)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, ints, []int{1, 2})
+	var s string
+	err = m.Unmarshal(buf, &s)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, s, "abc")
+
+	err = m.Unmarshal(bytes.NewBufferString("\x00\x00\x00\x04\xa3a"), &s)
+	assert.NotEqual(t, err, nil)
+	err = m.Unmarshal(bytes.NewBufferString("\x00\x00"), &s)
+	assert.NotEqual(t, err, nil)
+}
+
+type streamMarshallerService struct {
+	Array   Service `prefix:"/array"`
+	NDJSON  Service `prefix:"/ndjson" mime:"application/x-ndjson"`
+	FailEnd Service `prefix:"/failend"`
+
+	list      Streaming `route:"/list" method:"GET" end:"\n"`
+	empty     Streaming `route:"/empty" method:"GET"`
+	fail      Streaming `route:"/fail" method:"GET"`
+	failAfter Streaming `route:"/failafter" method:"GET"`
+}
+
+type failEndMarshaller struct {
+	NDJSONMarshaller
+}
+
+func (m failEndMarshaller) Begin(w io.Writer, name string) (StreamEncoder, error) {
+	encoder, err := m.NDJSONMarshaller.Begin(w, name)
+	if err != nil {
+		return nil, err
+	}
+	return failEndEncoder{encoder}, nil
+}
+
+type failEndEncoder struct {
+	StreamEncoder
+}
+
+func (e failEndEncoder) End() error {
+	return fmt.Errorf("end failed")
+}
+
+func (s *streamMarshallerService) List(ctx StreamContext) {
+	for i := 1; i <= 3; i++ {
+		ctx.Render(i)
+	}
+}
+
+func (s *streamMarshallerService) Empty(ctx StreamContext) {}
+
+func (s *streamMarshallerService) Fail(ctx StreamContext) {
+	ctx.Return(http.StatusForbidden, "forbidden")
+}
+
+func (s *streamMarshallerService) FailAfter(ctx StreamContext) {
+	ctx.Render(1)
+	ctx.Return(http.StatusInternalServerError, "broken")
+}
+
+func TestStreamingWithStreamMarshaller(t *testing.T) {
+	s := new(streamMarshallerService)
+	s.Array.RegisterMarshaller("application/json", JSONArrayMarshaller{})
+	s.FailEnd.RegisterMarshaller("application/json", failEndMarshaller{})
+	r := New()
+	err := r.Add(s)
+	assert.MustEqual(t, err, nil)
+	errs := make(chan string, 10)
+	r.SetHooks(Hooks{
+		OnError: func(id string, req *http.Request, err error) {
+			errs <- err.Error()
+		},
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	type Test struct {
+		path        string
+		code        int
+		contentType string
+		body        string
+		errs        []string
+	}
+	var tests = []Test{
+		{"/array/list", http.StatusOK, "application/json; charset=utf-8", "[1,2,3]\n", nil},
+		{"/array/empty", http.StatusOK, "application/json; charset=utf-8", "[]\n", nil},
+		{"/array/fail", http.StatusForbidden, "text/plain; charset=utf-8", "forbidden\n", nil},
+		{"/array/failafter", http.StatusOK, "application/json; charset=utf-8", "[1]\n", []string{"return 500 after stream begun: broken"}},
+		{"/ndjson/list", http.StatusOK, "application/x-ndjson; charset=utf-8", "1\n2\n3\n", nil},
+		{"/ndjson/empty", http.StatusOK, "application/x-ndjson; charset=utf-8", "", nil},
+		{"/ndjson/failafter", http.StatusOK, "application/x-ndjson; charset=utf-8", "1\n", []string{"return 500 after stream begun: broken"}},
+		{"/failend/list", http.StatusOK, "application/json; charset=utf-8", "1\n2\n3\n", []string{"end stream error: end failed"}},
+	}
+	for i, test := range tests {
+		resp, err := http.Get(server.URL + test.path)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, resp.StatusCode, test.code, "test %d", i)
+		assert.Equal(t, resp.Header.Get("Content-Type"), test.contentType, "test %d", i)
+		assert.Equal(t, string(body), test.body, "test %d", i)
+		var got []string
+		for len(errs) > 0 {
+			got = append(got, <-errs)
+		}
+		assert.Equal(t, got, test.errs, "test %d", i)
+	}
+}
@@ -0,0 +1,55 @@
+package rest
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+// TextMarshaller is Marshaller using text/plain.
+// It writes v with MarshalText if v implements encoding.TextMarshaler, otherwise with fmt.Fprint.
+// It reads request body with UnmarshalText if v implements encoding.TextUnmarshaler,
+// otherwise parses it as string, bool or number.
+type TextMarshaller struct{}
+
+// Marshal will marshal v and write to w.
+func (m TextMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	if t, ok := v.(encoding.TextMarshaler); ok {
+		b, err := t.MarshalText()
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	_, err := fmt.Fprint(w, v)
+	return err
+}
+
+// Unmarshal will read r and unmarshal to v.
+func (m TextMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if t, ok := v.(encoding.TextUnmarshaler); ok {
+		return t.UnmarshalText(b)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("text: unmarshal to non-pointer %T", v)
+	}
+	rv = rv.Elem()
+	switch {
+	case rv.Kind() == reflect.String:
+		rv.SetString(string(b))
+		return nil
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+		rv.SetBytes(b)
+		return nil
+	}
+	return setFormString(rv, strings.TrimSpace(string(b)))
+}
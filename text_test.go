@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"bytes"
+	"github.com/googollee/go-assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextMarshallerMarshal(t *testing.T) {
+	type Test struct {
+		v    interface{}
+		text string
+	}
+	var tests = []Test{
+		{"str", "str"},
+		{12, "12"},
+		{1.5, "1.5"},
+		{true, "true"},
+		{net.IPv4(127, 0, 0, 1), "127.0.0.1"},
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), "2020-01-02T03:04:05Z"},
+		{[]int{1, 2}, "[1 2]"},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		err := TextMarshaller{}.Marshal(&buf, "test", test.v)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, buf.String(), test.text, "test %d", i)
+	}
+}
+
+func TestTextMarshallerUnmarshal(t *testing.T) {
+	type Test struct {
+		text   string
+		t      reflect.Type
+		ok     bool
+		target interface{}
+	}
+	var tests = []Test{
+		{" str\n", reflect.TypeOf(""), true, " str\n"},
+		{"bytes", reflect.TypeOf([]byte{}), true, []byte("bytes")},
+		{"12\n", reflect.TypeOf(0), true, 12},
+		{"1.5", reflect.TypeOf(0.0), true, 1.5},
+		{"true", reflect.TypeOf(false), true, true},
+		{"127.0.0.1", reflect.TypeOf(net.IP{}), true, net.IPv4(127, 0, 0, 1)},
+		{"abc", reflect.TypeOf(0), false, nil},
+		{"abc", reflect.TypeOf(net.IP{}), false, nil},
+		{"abc", reflect.TypeOf(struct{}{}), false, nil},
+	}
+	for i, test := range tests {
+		v := reflect.New(test.t)
+		err := TextMarshaller{}.Unmarshal(strings.NewReader(test.text), v.Interface())
+		assert.MustEqual(t, err == nil, test.ok, "test %d", i)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, v.Elem().Interface(), test.target, "test %d", i)
+	}
+}
+
+func TestTextHandler(t *testing.T) {
+	f := reflect.ValueOf(func(ctx Context, arg int) int {
+		return arg * 2
+	})
+	handler := &baseHandler{
+		name:            "Double",
+		mime:            "application/json",
+		marshaller:      jsonMarshaller,
+		inputType:       f.Type().In(1),
+		f:               f,
+		compressMinSize: -1,
+	}
+	req, err := http.NewRequest("POST", "http://domain/", strings.NewReader("21"))
+	assert.MustEqual(t, err, nil)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Accept", "text/plain")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req, nil)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Header().Get("Content-Type"), "text/plain; charset=utf-8")
+	assert.Equal(t, resp.Body.String(), "42")
+}
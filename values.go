@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// valueStore is the request-scoped key/value storage.
+type valueStore struct {
+	locker sync.RWMutex
+	values map[interface{}]interface{}
+}
+
+type valueStoreKey struct{}
+
+func getValueStore(r *http.Request) *valueStore {
+	store, _ := r.Context().Value(valueStoreKey{}).(*valueStore)
+	return store
+}
+
+// withValueStore returns a request with value storage. It returns r directly if r already has one.
+func withValueStore(r *http.Request) *http.Request {
+	if getValueStore(r) != nil {
+		return r
+	}
+	store := &valueStore{
+		values: make(map[interface{}]interface{}),
+	}
+	return r.WithContext(context.WithValue(r.Context(), valueStoreKey{}, store))
+}
+
+func (s *valueStore) set(key, v interface{}) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.values[key] = v
+}
+
+func (s *valueStore) get(key interface{}) (interface{}, bool) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// WithValue stores v with key in request r, and returns the request carrying the storage.
+// Middlewares use it to pass data to handlers, which can get v by Context.Value(key).
+// Like context.WithValue, key should be a user-defined type to avoid collisions.
+func WithValue(r *http.Request, key, v interface{}) *http.Request {
+	r = withValueStore(r)
+	getValueStore(r).set(key, v)
+	return r
+}
+
+// RequestValue returns the value of key stored by WithValue or Context.Set in request r.
+// If key isn't stored, it returns the value of key in r.Context().
+func RequestValue(r *http.Request, key interface{}) interface{} {
+	if store := getValueStore(r); store != nil {
+		if v, ok := store.get(key); ok {
+			return v
+		}
+	}
+	return r.Context().Value(key)
+}
@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"context"
+	"github.com/googollee/go-assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type valueKey string
+
+func TestRequestValue(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://domain/", nil)
+	assert.MustEqual(t, err, nil)
+	assert.Equal(t, RequestValue(req, valueKey("user")), nil)
+
+	req = req.WithContext(context.WithValue(req.Context(), valueKey("context"), "from context"))
+	req = WithValue(req, valueKey("user"), "rest")
+	assert.Equal(t, RequestValue(req, valueKey("user")), "rest")
+	assert.Equal(t, RequestValue(req, valueKey("context")), "from context")
+	assert.Equal(t, RequestValue(req, "user"), nil)
+
+	same := WithValue(req, valueKey("user"), "other")
+	assert.Equal(t, same, req)
+	assert.Equal(t, RequestValue(req, valueKey("user")), "other")
+}
+
+func TestBaseContextValue(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://domain/", nil)
+	assert.MustEqual(t, err, nil)
+	req = WithValue(req, valueKey("user"), "rest")
+	resp := httptest.NewRecorder()
+	ctx := newBaseContext("test", nil, "", nil, req, resp)
+	assert.Equal(t, ctx.Value(valueKey("user")), "rest")
+	ctx.Set(valueKey("id"), 1)
+	assert.Equal(t, ctx.Value(valueKey("id")), 1)
+	assert.Equal(t, RequestValue(req, valueKey("id")), 1)
+
+	req, err = http.NewRequest("GET", "http://domain/", nil)
+	assert.MustEqual(t, err, nil)
+	ctx = newBaseContext("test", nil, "", nil, req, resp)
+	assert.Equal(t, ctx.Value(valueKey("id")), nil)
+	ctx.Set(valueKey("id"), 1)
+	assert.Equal(t, ctx.Value(valueKey("id")), 1)
+}
+
+func TestRecordContextValue(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://domain/", nil)
+	assert.MustEqual(t, err, nil)
+	ctx := NewRecordContext(nil, WithValue(req, valueKey("user"), "rest"))
+	assert.Equal(t, ctx.Value(valueKey("user")), "rest")
+	ctx.Set(valueKey("id"), 1)
+	assert.Equal(t, ctx.Value(valueKey("id")), 1)
+}
+
+type valueRest struct {
+	Service
+
+	get    SimpleNode `path:"/get" method:"GET"`
+	stream Streaming  `path:"/stream" method:"GET"`
+}
+
+func (r *valueRest) Get(ctx Context) string {
+	ctx.Set(valueKey("handled"), true)
+	user, _ := ctx.Value(valueKey("user")).(string)
+	return user
+}
+
+func (r *valueRest) Stream(ctx StreamContext) {
+	user, _ := ctx.Value(valueKey("user")).(string)
+	ctx.Render(user)
+}
+
+type valueMiddleware struct {
+	next    http.Handler
+	handled interface{}
+}
+
+func (m *valueMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = WithValue(r, valueKey("user"), "rest")
+	m.next.ServeHTTP(w, r)
+	m.handled = RequestValue(r, valueKey("handled"))
+}
+
+func TestValueMiddleware(t *testing.T) {
+	r := New()
+	err := r.Add(new(valueRest))
+	assert.MustEqual(t, err, nil)
+	m := &valueMiddleware{next: r}
+
+	req, err := http.NewRequest("GET", "http://domain/get", nil)
+	assert.MustEqual(t, err, nil)
+	resp := httptest.NewRecorder()
+	m.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Body.String(), "\"rest\"\n")
+	assert.Equal(t, m.handled, true)
+
+	server := httptest.NewServer(m)
+	defer server.Close()
+	httpResp, err := http.Get(server.URL + "/stream")
+	assert.MustEqual(t, err, nil)
+	defer httpResp.Body.Close()
+	b, err := ioutil.ReadAll(httpResp.Body)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(b), "\"rest\"\n")
+}
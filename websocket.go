@@ -0,0 +1,277 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Close codes of websocket, see RFC 6455 section 7.4.
+const (
+	WSCloseNormal          = 1000
+	WSCloseGoingAway       = 1001
+	WSCloseProtocolError   = 1002
+	WSCloseUnsupportedData = 1003
+	WSCloseNoStatus        = 1005
+	WSCloseAbnormal        = 1006
+	WSCloseInvalidData     = 1007
+	WSClosePolicyViolation = 1008
+	WSCloseMessageTooBig   = 1009
+	WSCloseInternalError   = 1011
+)
+
+// WSCloseError is the error of closed websocket, with the close code and reason.
+type WSCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *WSCloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket closed: %d", e.Code)
+	}
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// Opcodes of websocket frame.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWSCloseReason is the maximum bytes of close reason, which fits in a control frame with the code.
+const maxWSCloseReason = 123
+
+// wsAcceptKey returns Sec-WebSocket-Accept of Sec-WebSocket-Key key.
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerHasToken reports whether comma separated header name of h contains token case-insensitively.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkWSHandshake checks the opening handshake of request r, and returns the status code if it's invalid.
+func checkWSHandshake(r *http.Request) (int, error) {
+	if r.Method != "GET" {
+		return http.StatusMethodNotAllowed, fmt.Errorf("websocket handshake must be GET")
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		return http.StatusBadRequest, fmt.Errorf("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return http.StatusUpgradeRequired, fmt.Errorf("unsupported websocket version %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key, err := base64.StdEncoding.DecodeString(r.Header.Get("Sec-WebSocket-Key"))
+	if err != nil || len(key) != 16 {
+		return http.StatusBadRequest, fmt.Errorf("invalid Sec-WebSocket-Key")
+	}
+	return 0, nil
+}
+
+// checkWSOrigin reports whether Origin of request r is allowed by origins, or is the same host as r
+// if origins is empty. Requests without Origin are allowed.
+func checkWSOrigin(r *http.Request, origins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(origins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectWSProtocol returns the first protocol of server's protocols requested by client in header,
+// or "" if none matches.
+func selectWSProtocol(protocols []string, h http.Header) string {
+	for _, protocol := range protocols {
+		if headerHasToken(h, "Sec-WebSocket-Protocol", protocol) {
+			return protocol
+		}
+	}
+	return ""
+}
+
+type wsFrame struct {
+	fin     bool
+	opcode  byte
+	payload []byte
+}
+
+// readWSFrame reads a frame from r. Frames from client must be masked, and frames from server must not.
+// limit is the maximum size of payload, negative means no limit.
+func readWSFrame(r io.Reader, limit int64, masked bool) (wsFrame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return wsFrame{}, err
+	}
+	frame := wsFrame{
+		fin:    head[0]&0x80 != 0,
+		opcode: head[0] & 0x0f,
+	}
+	if head[0]&0x70 != 0 {
+		return frame, &WSCloseError{WSCloseProtocolError, "reserved bits are set"}
+	}
+	switch frame.opcode {
+	case wsContinuation, wsText, wsBinary:
+	case wsClose, wsPing, wsPong:
+		if !frame.fin || head[1]&0x7f > 125 {
+			return frame, &WSCloseError{WSCloseProtocolError, "invalid control frame"}
+		}
+	default:
+		return frame, &WSCloseError{WSCloseProtocolError, fmt.Sprintf("unknown opcode %d", frame.opcode)}
+	}
+	if (head[1]&0x80 != 0) != masked {
+		return frame, &WSCloseError{WSCloseProtocolError, "invalid mask"}
+	}
+
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return frame, err
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return frame, err
+		}
+		n = binary.BigEndian.Uint64(b[:])
+		if n>>63 != 0 {
+			return frame, &WSCloseError{WSCloseProtocolError, "invalid payload length"}
+		}
+	}
+	if limit >= 0 && n > uint64(limit) {
+		return frame, &WSCloseError{WSCloseMessageTooBig, "message is too big"}
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return frame, err
+		}
+	}
+	var payload bytes.Buffer
+	if _, err := io.CopyN(&payload, r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return frame, err
+	}
+	frame.payload = payload.Bytes()
+	if masked {
+		for i := range frame.payload {
+			frame.payload[i] ^= mask[i%4]
+		}
+	}
+	return frame, nil
+}
+
+// writeWSFrame writes a frame with payload to w, masked with mask if it isn't nil.
+func writeWSFrame(w io.Writer, fin bool, opcode byte, payload []byte, mask []byte) error {
+	var buf bytes.Buffer
+	b := opcode
+	if fin {
+		b |= 0x80
+	}
+	buf.WriteByte(b)
+	var maskBit byte
+	if mask != nil {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		buf.WriteByte(maskBit | byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(maskBit | 126)
+		binary.Write(&buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(maskBit | 127)
+		binary.Write(&buf, binary.BigEndian, uint64(n))
+	}
+	if mask == nil {
+		buf.Write(payload)
+	} else {
+		buf.Write(mask[:4])
+		for i, c := range payload {
+			buf.WriteByte(c ^ mask[i%4])
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// validWSCloseCode reports whether code can be sent in a close frame.
+func validWSCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011, code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// parseWSClose parses the payload of close frame.
+func parseWSClose(payload []byte) *WSCloseError {
+	switch {
+	case len(payload) == 0:
+		return &WSCloseError{WSCloseNoStatus, ""}
+	case len(payload) == 1:
+		return &WSCloseError{WSCloseProtocolError, "invalid close frame"}
+	}
+	code := int(binary.BigEndian.Uint16(payload))
+	if !validWSCloseCode(code) {
+		return &WSCloseError{WSCloseProtocolError, fmt.Sprintf("invalid close code %d", code)}
+	}
+	if !utf8.Valid(payload[2:]) {
+		return &WSCloseError{WSCloseInvalidData, "invalid utf-8 close reason"}
+	}
+	return &WSCloseError{code, string(payload[2:])}
+}
+
+// wsClosePayload returns the payload of close frame with code and reason, truncating reason to fit.
+func wsClosePayload(code int, reason string) []byte {
+	if code == WSCloseNoStatus {
+		return nil
+	}
+	if len(reason) > maxWSCloseReason {
+		reason = reason[:maxWSCloseReason]
+		for !utf8.ValidString(reason) {
+			reason = reason[:len(reason)-1]
+		}
+	}
+	ret := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(ret, uint16(code))
+	return append(ret, reason...)
+}
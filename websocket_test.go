@@ -0,0 +1,179 @@
+package rest
+
+import (
+	"bytes"
+	"github.com/googollee/go-assert"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWSAcceptKey(t *testing.T) {
+	assert.Equal(t, wsAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+}
+
+func TestCheckWSHandshake(t *testing.T) {
+	type Test struct {
+		method  string
+		headers map[string]string
+		code    int
+		ok      bool
+	}
+	valid := map[string]string{
+		"Connection":            "keep-alive, Upgrade",
+		"Upgrade":               "websocket",
+		"Sec-WebSocket-Version": "13",
+		"Sec-WebSocket-Key":     "dGhlIHNhbXBsZSBub25jZQ==",
+	}
+	with := func(name, value string) map[string]string {
+		ret := make(map[string]string)
+		for k, v := range valid {
+			ret[k] = v
+		}
+		ret[name] = value
+		return ret
+	}
+	var tests = []Test{
+		{"GET", valid, 0, true},
+		{"GET", with("Upgrade", "WebSocket"), 0, true},
+		{"POST", valid, http.StatusMethodNotAllowed, false},
+		{"GET", with("Connection", "keep-alive"), http.StatusBadRequest, false},
+		{"GET", with("Upgrade", "h2c"), http.StatusBadRequest, false},
+		{"GET", with("Sec-WebSocket-Version", "8"), http.StatusUpgradeRequired, false},
+		{"GET", with("Sec-WebSocket-Key", "short"), http.StatusBadRequest, false},
+		{"GET", with("Sec-WebSocket-Key", ""), http.StatusBadRequest, false},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, "http://domain/", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		code, err := checkWSHandshake(req)
+		assert.Equal(t, err == nil, test.ok, "test %d: %s", i, err)
+		assert.Equal(t, code, test.code, "test %d", i)
+	}
+}
+
+func TestSelectWSProtocol(t *testing.T) {
+	type Test struct {
+		protocols []string
+		header    string
+		protocol  string
+	}
+	var tests = []Test{
+		{nil, "chat", ""},
+		{[]string{"chat"}, "", ""},
+		{[]string{"chat"}, "chat", "chat"},
+		{[]string{"chat.v2", "chat.v1"}, "chat.v1, chat.v2", "chat.v2"},
+		{[]string{"chat.v2", "chat.v1"}, "chat.v1", "chat.v1"},
+		{[]string{"chat.v2"}, "other", ""},
+	}
+	for i, test := range tests {
+		header := make(http.Header)
+		if test.header != "" {
+			header.Set("Sec-WebSocket-Protocol", test.header)
+		}
+		assert.Equal(t, selectWSProtocol(test.protocols, header), test.protocol, "test %d", i)
+	}
+}
+
+func TestWSFrame(t *testing.T) {
+	mask := []byte{1, 2, 3, 4}
+	type Test struct {
+		fin     bool
+		opcode  byte
+		payload []byte
+		mask    []byte
+	}
+	var tests = []Test{
+		{true, wsText, []byte("hello"), nil},
+		{true, wsText, []byte("hello"), mask},
+		{false, wsBinary, nil, mask},
+		{true, wsContinuation, bytes.Repeat([]byte("a"), 126), mask},
+		{true, wsBinary, bytes.Repeat([]byte("b"), 0x10000), nil},
+		{true, wsPing, []byte("ping"), mask},
+	}
+	for i, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		err := writeWSFrame(buf, test.fin, test.opcode, test.payload, test.mask)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		frame, err := readWSFrame(buf, -1, test.mask != nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, frame.fin, test.fin, "test %d", i)
+		assert.Equal(t, frame.opcode, test.opcode, "test %d", i)
+		assert.Equal(t, len(frame.payload), len(test.payload), "test %d", i)
+		assert.Equal(t, bytes.Equal(frame.payload, test.payload), true, "test %d", i)
+		assert.Equal(t, buf.Len(), 0, "test %d", i)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	writeWSFrame(buf, true, wsText, []byte("hello"), nil)
+	assert.Equal(t, buf.String(), "\x81\x05hello")
+	buf.Reset()
+	writeWSFrame(buf, true, wsText, []byte("Hello"), []byte{0x37, 0xfa, 0x21, 0x3d})
+	assert.Equal(t, buf.String(), "\x81\x85\x37\xfa\x21\x3d\x7f\x9f\x4d\x51\x58")
+}
+
+func TestReadWSFrameError(t *testing.T) {
+	type Test struct {
+		data  string
+		limit int64
+		code  int
+	}
+	var tests = []Test{
+		{"\xc1\x80\x00\x00\x00\x00", -1, WSCloseProtocolError},
+		{"\x83\x80\x00\x00\x00\x00", -1, WSCloseProtocolError},
+		{"\x09\x80\x00\x00\x00\x00", -1, WSCloseProtocolError},
+		{"\x89\xfe\x00\x7e", -1, WSCloseProtocolError},
+		{"\x81\x05hello", -1, WSCloseProtocolError},
+		{"\x81\xff\x80\x00\x00\x00\x00\x00\x00\x00", -1, WSCloseProtocolError},
+		{"\x81\x86\x00\x00\x00\x00hello!", 5, WSCloseMessageTooBig},
+		{"\x81\x80\x00\x00\x00\x00", 0, 0},
+		{"\x81\x85\x00\x00\x00\x00hel", -1, -1},
+		{"\x81", -1, -1},
+	}
+	for i, test := range tests {
+		_, err := readWSFrame(strings.NewReader(test.data), test.limit, true)
+		switch test.code {
+		case 0:
+			assert.Equal(t, err, nil, "test %d", i)
+		case -1:
+			assert.Equal(t, err == io.ErrUnexpectedEOF || err == io.EOF, true, "test %d: %s", i, err)
+		default:
+			closeErr, ok := err.(*WSCloseError)
+			assert.MustEqual(t, ok, true, "test %d: %s", i, err)
+			assert.Equal(t, closeErr.Code, test.code, "test %d", i)
+		}
+	}
+}
+
+func TestWSClose(t *testing.T) {
+	type Test struct {
+		payload string
+		code    int
+		reason  string
+	}
+	var tests = []Test{
+		{"", WSCloseNoStatus, ""},
+		{"\x03", WSCloseProtocolError, "invalid close frame"},
+		{"\x03\xe8", WSCloseNormal, ""},
+		{"\x03\xe8bye", WSCloseNormal, "bye"},
+		{"\x0f\xa0app", 4000, "app"},
+		{"\x03\xed", WSCloseProtocolError, "invalid close code 1005"},
+		{"\x03\xe8\xff", WSCloseInvalidData, "invalid utf-8 close reason"},
+	}
+	for i, test := range tests {
+		err := parseWSClose([]byte(test.payload))
+		assert.Equal(t, err.Code, test.code, "test %d", i)
+		assert.Equal(t, err.Reason, test.reason, "test %d", i)
+	}
+
+	assert.Equal(t, wsClosePayload(WSCloseNoStatus, "ignored"), []byte(nil))
+	assert.Equal(t, string(wsClosePayload(WSCloseNormal, "bye")), "\x03\xe8bye")
+	long := wsClosePayload(WSCloseNormal, strings.Repeat("a", 122)+"世界")
+	assert.Equal(t, len(long), 2+122)
+	assert.Equal(t, (&WSCloseError{1000, ""}).Error(), "websocket closed: 1000")
+	assert.Equal(t, (&WSCloseError{1000, "bye"}).Error(), "websocket closed: 1000 bye")
+}
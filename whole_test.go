@@ -98,7 +98,7 @@ func TestWholeRest(t *testing.T) {
 		assert.Equal(t, string(b), "\"str\"\n")
 		assert.Equal(t, rest.lastCall, "call handler1 with 1, id 123")
 		assert.Equal(t, resp.Header.Get("Return-Header"), "return")
-		assert.Equal(t, resp.Header.Get("Content-Type"), "application/json")
+		assert.Equal(t, resp.Header.Get("Content-Type"), "application/json; charset=utf-8")
 	}
 
 	{
@@ -125,7 +125,7 @@ func TestWholeRest(t *testing.T) {
 		assert.Equal(t, err, nil)
 		assert.Equal(t, string(b), "1\n")
 		assert.Equal(t, rest.lastCall, "call handler2 with str, header custom, id abc")
-		assert.Equal(t, resp.Header.Get("Content-Type"), "application/json")
+		assert.Equal(t, resp.Header.Get("Content-Type"), "application/json; charset=utf-8")
 	}
 
 	{
@@ -140,7 +140,7 @@ func TestWholeRest(t *testing.T) {
 		assert.Equal(t, err, nil)
 		assert.Equal(t, string(b), "1\n")
 		assert.Equal(t, rest.lastCall, "call handler2 with str, header custom, id abc")
-		assert.Equal(t, resp.Header.Get("Content-Type"), "application/json")
+		assert.Equal(t, resp.Header.Get("Content-Type"), "application/json; charset=utf-8")
 	}
 
 	{
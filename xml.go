@@ -0,0 +1,492 @@
+package rest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// XMLMarshaller is Marshaller using xml.
+// Struct is marshalled with encoding/xml, other values like slices, maps and scalars are wrapped
+// in a root element named with the handler name:
+//  - slice is marshalled as <Name><item>...</item><item>...</item></Name>.
+//  - map with string key is marshalled as <Name><key>...</key></Name>,
+//    or <entry key="...">...</entry> if the key isn't a valid element name.
+//  - map in struct fields, slices or maps is marshalled the same way, with the field name as element name.
+// Unmarshal decodes the same format.
+type XMLMarshaller struct{}
+
+// Marshal will marshal v and write to w, with the handler function name as root element.
+func (x XMLMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	if name == "" {
+		name = "response"
+	}
+	encoder := xml.NewEncoder(w)
+	rv := reflect.ValueOf(v)
+	for rv.IsValid() && (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	var err error
+	if rv.Kind() == reflect.Struct {
+		if st := xmlStructOf(rv.Type()); st != nil {
+			err = st.encode(encoder, rv)
+		} else {
+			err = encoder.Encode(rv.Interface())
+		}
+	} else {
+		err = encodeXMLValue(encoder, xml.StartElement{Name: xml.Name{Local: name}}, rv)
+	}
+	if err != nil {
+		return err
+	}
+	return encoder.Flush()
+}
+
+// Unmarshal will read r and unmarshal to v.
+func (x XMLMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("xml: unmarshal to non-pointer %T", v)
+	}
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return decodeXMLValue(decoder, start, rv.Elem())
+		}
+	}
+}
+
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', c == '_':
+		case i > 0 && ('0' <= c && c <= '9' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func encodeXMLValue(encoder *xml.Encoder, start xml.StartElement, v reflect.Value) error {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return encoder.EncodeElement("", start)
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return encoder.EncodeElement("", start)
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("xml: unsupported map key type %s", v.Type().Key())
+		}
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			child := xml.StartElement{Name: xml.Name{Local: key.String()}}
+			if !isXMLName(key.String()) {
+				child = xml.StartElement{
+					Name: xml.Name{Local: "entry"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key.String()}},
+				}
+			}
+			if err := encodeXMLValue(encoder, child, v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return encoder.EncodeElement(v.Interface(), start)
+		}
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		for i, n := 0, v.Len(); i < n; i++ {
+			if err := encodeXMLValue(encoder, xml.StartElement{Name: xml.Name{Local: "item"}}, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	case reflect.Struct:
+		if st := xmlStructOf(v.Type()); st != nil {
+			return encoder.EncodeElement(st.shadow(v).Interface(), start)
+		}
+	}
+	return encoder.EncodeElement(v.Interface(), start)
+}
+
+func decodeXMLValue(decoder *xml.Decoder, start xml.StartElement, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeXMLValue(decoder, start, v.Elem())
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("xml: unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		return decodeXMLChildren(decoder, func(child xml.StartElement) error {
+			key := child.Name.Local
+			if key == "entry" {
+				for _, attr := range child.Attr {
+					if attr.Name.Local == "key" {
+						key = attr.Value
+					}
+				}
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeXMLValue(decoder, child, elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+			return nil
+		})
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		return decodeXMLChildren(decoder, func(child xml.StartElement) error {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeXMLValue(decoder, child, elem); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, elem))
+			return nil
+		})
+	case reflect.Struct:
+		if st := xmlStructOf(v.Type()); st != nil {
+			return st.decode(decoder, start, v)
+		}
+	}
+	return decoder.DecodeElement(v.Addr().Interface(), &start)
+}
+
+// decodeXMLChildren calls f with each child element until the end of current element.
+func decodeXMLChildren(decoder *xml.Decoder, f func(child xml.StartElement) error) error {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if err := f(t); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// xmlStruct is the shadow of a struct type containing maps, which encoding/xml doesn't support.
+// Fields of embedded structs are promoted into the shadow, and fields containing maps are replaced
+// with xmlField, so encoding/xml still handles tags of other fields.
+type xmlStruct struct {
+	typ      reflect.Type
+	fields   []xmlStructField
+	xmlName  bool
+	typeName string
+}
+
+type xmlStructField struct {
+	index     []int
+	wrap      bool
+	omitEmpty bool
+}
+
+var xmlStructs sync.Map
+
+var xmlMarshalerType = reflect.TypeOf((*xml.Marshaler)(nil)).Elem()
+
+// xmlStructOf returns the shadow of struct type t, or nil if t doesn't contain maps.
+func xmlStructOf(t reflect.Type) *xmlStruct {
+	if st, ok := xmlStructs.Load(t); ok {
+		return st.(*xmlStruct)
+	}
+	var st *xmlStruct
+	if hasXMLMap(t, map[reflect.Type]bool{}) {
+		st = newXMLStruct(t)
+	}
+	xmlStructs.Store(t, st)
+	return st
+}
+
+// hasXMLMap returns whether values of type t contain maps, not handled by their own MarshalXML.
+func hasXMLMap(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if t.Implements(xmlMarshalerType) || reflect.PtrTo(t).Implements(xmlMarshalerType) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return hasXMLMap(t.Elem(), visiting)
+	case reflect.Struct:
+		if visiting[t] {
+			return false
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Tag.Get("xml") == "-" || (f.PkgPath != "" && embeddedXMLStruct(f) == nil) {
+				continue
+			}
+			if hasXMLMap(f.Type, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// embeddedXMLStruct returns the struct type of field f if it's an embedded struct or struct pointer.
+func embeddedXMLStruct(f reflect.StructField) reflect.Type {
+	if !f.Anonymous {
+		return nil
+	}
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+type xmlStructCandidate struct {
+	field reflect.StructField
+	index []int
+	depth int
+	name  string
+	tag   string
+	opts  string
+}
+
+func newXMLStruct(t reflect.Type) *xmlStruct {
+	var candidates []xmlStructCandidate
+	collectXMLFields(t, nil, map[reflect.Type]bool{}, &candidates)
+
+	// Drop fields hidden by another one with the same name and less depth, like encoding/xml.
+	depths := make(map[string]int)
+	for _, c := range candidates {
+		if d, ok := depths[c.name]; c.name != "" && (!ok || c.depth < d) {
+			depths[c.name] = c.depth
+		}
+	}
+	st := &xmlStruct{typeName: t.Name()}
+	var fields []reflect.StructField
+	for _, c := range candidates {
+		if c.name != "" && depths[c.name] < c.depth {
+			continue
+		}
+		field := xmlStructField{
+			index:     c.index,
+			wrap:      hasXMLMap(c.field.Type, map[reflect.Type]bool{}),
+			omitEmpty: strings.Contains(c.opts+",", ",omitempty,"),
+		}
+		shadow := reflect.StructField{
+			Name: "F" + strconv.Itoa(len(fields)),
+			Type: c.field.Type,
+			Tag:  reflect.StructTag(`xml:"` + c.tag + `"`),
+		}
+		if c.field.Name == "XMLName" {
+			if st.xmlName {
+				continue
+			}
+			st.xmlName = true
+			shadow.Name = "XMLName"
+		}
+		if field.wrap {
+			shadow.Type = reflect.TypeOf(xmlField{})
+		}
+		st.fields = append(st.fields, field)
+		fields = append(fields, shadow)
+	}
+	st.typ = reflect.StructOf(fields)
+	return st
+}
+
+// collectXMLFields collects fields of struct type t, promoting fields of embedded structs in place.
+func collectXMLFields(t reflect.Type, index []int, visiting map[reflect.Type]bool, candidates *[]xmlStructCandidate) {
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("xml")
+		if tag == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int{}, index...), i)
+		if et := embeddedXMLStruct(f); et != nil {
+			if !visiting[et] {
+				collectXMLFields(et, fieldIndex, visiting, candidates)
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+		if name == "" && f.Name != "XMLName" && isXMLNamedOptions(opts) {
+			name = f.Name
+		}
+		key := name
+		if f.Name == "XMLName" {
+			key = ""
+		}
+		if key != "" && strings.Contains(opts+",", ",attr,") {
+			key += ",attr"
+		}
+		*candidates = append(*candidates, xmlStructCandidate{
+			field: f,
+			index: fieldIndex,
+			depth: len(index),
+			name:  key,
+			tag:   name + opts,
+			opts:  opts,
+		})
+	}
+}
+
+// isXMLNamedOptions returns whether a field with tag options opts is named, unlike chardata, innerxml, comment or any.
+func isXMLNamedOptions(opts string) bool {
+	for _, opt := range strings.Split(opts, ",") {
+		switch opt {
+		case "", "attr", "omitempty":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// shadow returns the shadow of struct value v for encoding.
+func (st *xmlStruct) shadow(v reflect.Value) reflect.Value {
+	ret := reflect.New(st.typ).Elem()
+	for i, f := range st.fields {
+		fv, ok := structFieldValue(v, f.index)
+		if !ok {
+			continue
+		}
+		if f.wrap {
+			fv = reflect.ValueOf(xmlField{fv, f.omitEmpty})
+		}
+		ret.Field(i).Set(fv)
+	}
+	return ret
+}
+
+// encode encodes struct value v as root element, named with XMLName field or the type name.
+func (st *xmlStruct) encode(encoder *xml.Encoder, v reflect.Value) error {
+	shadow := st.shadow(v).Interface()
+	if st.xmlName {
+		return encoder.Encode(shadow)
+	}
+	return encoder.EncodeElement(shadow, xml.StartElement{Name: xml.Name{Local: st.typeName}})
+}
+
+// decode decodes element start to struct value v through the shadow.
+// Fields containing maps are decoded to v directly, and other fields are copied back after decoding.
+func (st *xmlStruct) decode(decoder *xml.Decoder, start xml.StartElement, v reflect.Value) error {
+	shadow := st.shadow(v)
+	for i, f := range st.fields {
+		if !f.wrap {
+			continue
+		}
+		fv, err := structFieldAlloc(v, f.index)
+		if err != nil {
+			return fmt.Errorf("xml: %s", err)
+		}
+		shadow.Field(i).Set(reflect.ValueOf(xmlField{v: fv}))
+	}
+	if err := decoder.DecodeElement(shadow.Addr().Interface(), &start); err != nil {
+		return err
+	}
+	for i, f := range st.fields {
+		if f.wrap || shadow.Field(i).IsZero() {
+			continue
+		}
+		fv, err := structFieldAlloc(v, f.index)
+		if err != nil {
+			return fmt.Errorf("xml: %s", err)
+		}
+		fv.Set(shadow.Field(i))
+	}
+	return nil
+}
+
+// xmlField is a field of xmlStruct containing maps. It encodes and decodes the field value v like
+// encoding/xml, except that maps are handled by encodeXMLValue and decodeXMLValue:
+//  - nil pointer, or empty value with omitempty option, is omitted;
+//  - each item of slice is an element with the field name.
+type xmlField struct {
+	v         reflect.Value
+	omitEmpty bool
+}
+
+func (f xmlField) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	v := f.v
+	if f.omitEmpty && isEmptyValue(v) {
+		return nil
+	}
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8 {
+		for i, n := 0, v.Len(); i < n; i++ {
+			if err := encodeXMLValue(encoder, start, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return encodeXMLValue(encoder, start, v)
+}
+
+func (f xmlField) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	v := f.v
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := decodeXMLValue(decoder, start, elem); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, elem))
+		return nil
+	}
+	return decodeXMLValue(decoder, start, v)
+}
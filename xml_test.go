@@ -0,0 +1,158 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/googollee/go-assert"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type xmlUser struct {
+	XMLName xml.Name `xml:"user"`
+	ID      int      `xml:"id,attr"`
+	Name    string   `xml:"name"`
+}
+
+type xmlLabels struct {
+	Name     string `xml:"name,attr"`
+	Attrs    map[string]string
+	Extra    map[string]int `xml:"extra,omitempty"`
+	Children []xmlLabels    `xml:"child"`
+}
+
+type xmlEmbedLabels struct {
+	XMLName xml.Name `xml:"embed"`
+	xmlLabels
+	ID int `xml:"id"`
+}
+
+func TestXMLMarshallerMarshal(t *testing.T) {
+	str := "str"
+	type Test struct {
+		name string
+		v    interface{}
+		xml  string
+	}
+	var tests = []Test{
+		{"GetUser", xmlUser{ID: 1, Name: "rest"}, `<user id="1"><name>rest</name></user>`},
+		{"GetUser", &xmlUser{ID: 1, Name: "rest"}, `<user id="1"><name>rest</name></user>`},
+		{"Count", 10, `<Count>10</Count>`},
+		{"Name", &str, `<Name>str</Name>`},
+		{"Escape", "<a&b>", `<Escape>&lt;a&amp;b&gt;</Escape>`},
+		{"", "str", `<response>str</response>`},
+		{"Nil", nil, `<Nil></Nil>`},
+		{"List", []int{1, 2}, `<List><item>1</item><item>2</item></List>`},
+		{"Users", []xmlUser{{ID: 1, Name: "a"}}, `<Users><item id="1"><name>a</name></item></Users>`},
+		{"Map", map[string]int{"b": 2, "a": 1, "1st": 0}, `<Map><entry key="1st">0</entry><a>1</a><b>2</b></Map>`},
+		{"Nested", map[string][]string{"tags": {"x", "y"}}, `<Nested><tags><item>x</item><item>y</item></tags></Nested>`},
+		{"GetLabels", xmlLabels{Name: "a", Attrs: map[string]string{"k": "v"}}, `<xmlLabels name="a"><Attrs><k>v</k></Attrs></xmlLabels>`},
+		{"List", []xmlLabels{{Name: "a", Attrs: map[string]string{"k": "v"}}}, `<List><item name="a"><Attrs><k>v</k></Attrs></item></List>`},
+		{"Tree", &xmlLabels{Name: "a", Attrs: map[string]string{}, Extra: map[string]int{"n": 1}, Children: []xmlLabels{{Name: "b", Attrs: map[string]string{"x": "1"}}}},
+			`<xmlLabels name="a"><Attrs></Attrs><extra><n>1</n></extra><child name="b"><Attrs><x>1</x></Attrs></child></xmlLabels>`},
+		{"Embed", xmlEmbedLabels{xmlLabels: xmlLabels{Name: "a", Attrs: map[string]string{"k": "v"}}, ID: 1}, `<embed name="a"><Attrs><k>v</k></Attrs><id>1</id></embed>`},
+		{"Map", map[string]xmlLabels{"x": {Name: "a", Attrs: map[string]string{"k": "v"}}}, `<Map><x name="a"><Attrs><k>v</k></Attrs></x></Map>`},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		err := XMLMarshaller{}.Marshal(&buf, test.name, test.v)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		assert.Equal(t, buf.String(), test.xml, "test %d", i)
+	}
+
+	var buf bytes.Buffer
+	err := XMLMarshaller{}.Marshal(&buf, "Map", map[int]int{1: 1})
+	assert.NotEqual(t, err, nil)
+}
+
+func TestXMLMarshallerUnmarshal(t *testing.T) {
+	type Test struct {
+		xml    string
+		t      reflect.Type
+		ok     bool
+		target interface{}
+	}
+	var tests = []Test{
+		{`<user id="1"><name>rest</name></user>`, reflect.TypeOf(xmlUser{}), true, xmlUser{XMLName: xml.Name{Local: "user"}, ID: 1, Name: "rest"}},
+		{`<?xml version="1.0"?><Count>10</Count>`, reflect.TypeOf(0), true, 10},
+		{`<Name>str</Name>`, reflect.TypeOf(""), true, "str"},
+		{`<List><item>1</item><item>2</item></List>`, reflect.TypeOf([]int{}), true, []int{1, 2}},
+		{`<Map><entry key="1st">0</entry><a>1</a><b>2</b></Map>`, reflect.TypeOf(map[string]int{}), true, map[string]int{"a": 1, "b": 2, "1st": 0}},
+		{`<Nested><tags><item>x</item><item>y</item></tags></Nested>`, reflect.TypeOf(map[string][]string{}), true, map[string][]string{"tags": {"x", "y"}}},
+		{`<xmlLabels name="a"><Attrs><k>v</k></Attrs></xmlLabels>`, reflect.TypeOf(xmlLabels{}), true, xmlLabels{Name: "a", Attrs: map[string]string{"k": "v"}}},
+		{`<List><item name="a"><Attrs><k>v</k></Attrs></item></List>`, reflect.TypeOf([]xmlLabels{}), true, []xmlLabels{{Name: "a", Attrs: map[string]string{"k": "v"}}}},
+		{`<xmlLabels name="a"><Attrs></Attrs><extra><n>1</n></extra><child name="b"><Attrs><x>1</x></Attrs></child><child name="c"></child></xmlLabels>`, reflect.TypeOf(xmlLabels{}), true,
+			xmlLabels{Name: "a", Attrs: map[string]string{}, Extra: map[string]int{"n": 1}, Children: []xmlLabels{{Name: "b", Attrs: map[string]string{"x": "1"}}, {Name: "c"}}}},
+		{`<embed name="a"><Attrs><k>v</k></Attrs><id>1</id></embed>`, reflect.TypeOf(xmlEmbedLabels{}), true,
+			xmlEmbedLabels{XMLName: xml.Name{Local: "embed"}, xmlLabels: xmlLabels{Name: "a", Attrs: map[string]string{"k": "v"}}, ID: 1}},
+		{`<xmlLabels><Attrs><k>v</k>`, reflect.TypeOf(xmlLabels{}), false, nil},
+		{`<Count>abc</Count>`, reflect.TypeOf(0), false, nil},
+		{`<List><item>1</item>`, reflect.TypeOf([]int{}), false, nil},
+		{``, reflect.TypeOf(""), false, nil},
+	}
+	for i, test := range tests {
+		v := reflect.New(test.t)
+		err := XMLMarshaller{}.Unmarshal(strings.NewReader(test.xml), v.Interface())
+		assert.MustEqual(t, err == nil, test.ok, "test %d", i)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, v.Elem().Interface(), test.target, "test %d", i)
+	}
+}
+
+func TestXMLHandler(t *testing.T) {
+	f := reflect.ValueOf(func(ctx Context, ids []int) map[string]int {
+		return map[string]int{"count": len(ids)}
+	})
+	handler := &baseHandler{
+		name:       "Count",
+		mime:       "application/json",
+		marshaller: jsonMarshaller,
+		inputType:  f.Type().In(1),
+		f:          f,
+	}
+	req, err := http.NewRequest("POST", "http://domain/", strings.NewReader(`<ids><item>1</item><item>2</item></ids>`))
+	assert.MustEqual(t, err, nil)
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Accept", "text/xml")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req, nil)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Header().Get("Content-Type"), "text/xml; charset=utf-8")
+	assert.Equal(t, resp.Body.String(), `<Count><count>2</count></Count>`)
+}
+
+func TestXMLHandlerBrowserAccept(t *testing.T) {
+	f := reflect.ValueOf(func(ctx Context) map[string]int {
+		return map[string]int{"count": 2}
+	})
+	handler := &baseHandler{
+		name:       "Count",
+		mime:       "application/json",
+		marshaller: jsonMarshaller,
+		f:          f,
+	}
+	type Test struct {
+		accept      string
+		contentType string
+		body        string
+	}
+	var tests = []Test{
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "application/json; charset=utf-8", "{\"count\":2}\n"},
+		{"application/xml", "application/xml; charset=utf-8", `<Count><count>2</count></Count>`},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain/", nil)
+		assert.MustEqual(t, err, nil, "test %d", i)
+		req.Header.Set("Accept", test.accept)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req, nil)
+		assert.Equal(t, resp.Code, http.StatusOK, "test %d", i)
+		assert.Equal(t, resp.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		assert.Equal(t, resp.Body.String(), test.body, "test %d", i)
+	}
+}